@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+
+	"streaming-platform/config"
+	"streaming-platform/internal/catalog"
+	"streaming-platform/internal/health"
+	"streaming-platform/internal/scratch"
+	"streaming-platform/internal/services"
+	"streaming-platform/internal/storage"
+	"streaming-platform/utils"
+)
+
+// newHealthChecker registra as verificações de prontidão do servidor.
+func newHealthChecker(cfg config.Config, s3Client *storage.S3Client, catalogStore *catalog.Store, processor *utils.Processor, scratchManager *scratch.Manager) *health.Checker {
+	checker := health.NewChecker()
+
+	checker.Register("storage", func(ctx context.Context) (health.Result, error) {
+		return health.Result{Details: map[string]interface{}{"bucket": s3Client.BucketName}}, s3Client.Ping(ctx)
+	})
+
+	checker.Register("catalog", func(ctx context.Context) (health.Result, error) {
+		return health.Result{}, catalogStore.Ping(ctx)
+	})
+
+	// As dependências de transcodificação só são exigidas de quem processa
+	if cfg.RunsWorker() {
+		registerWorkerChecks(checker, cfg, processor, scratchManager)
+	}
+
+	return checker
+}
+
+// registerWorkerChecks registra as verificações de ffmpeg, disco e CPU.
+func registerWorkerChecks(checker *health.Checker, cfg config.Config, processor *utils.Processor, scratchManager *scratch.Manager) {
+	for _, binary := range []string{"ffmpeg", "ffprobe"} {
+		binary := binary
+		checker.Register(binary, func(ctx context.Context) (health.Result, error) {
+			version, err := services.BinaryVersion(ctx, binary)
+			if err != nil {
+				return health.Result{}, err
+			}
+			return health.Result{Details: map[string]interface{}{"version": version}}, nil
+		})
+	}
+
+	checker.Register("tempDir", health.TempDirCheck(scratchManager.Root, cfg.TempMinFreeMB<<20))
+
+	// Jobs esperando disco não tiram a instância do ar, mas ficam visíveis
+	checker.Register("scratch", func(ctx context.Context) (health.Result, error) {
+		reserved, active, waiting := scratchManager.Status()
+		result := health.Result{Details: map[string]interface{}{
+			"reservedBytes": reserved,
+			"active":        active,
+			"waiting":       waiting,
+		}}
+		if waiting > 0 {
+			result.Status = health.StatusWarn
+		}
+		return result, nil
+	})
+
+	// CPU saturada não tira a instância do ar, mas fica visível no relatório
+	checker.Register("workerPool", func(ctx context.Context) (health.Result, error) {
+		busy, queued, threadsUsed, threadsTotal := processor.PoolStatus()
+		result := health.Result{Details: map[string]interface{}{
+			"busy":         busy,
+			"queued":       queued,
+			"threadsUsed":  threadsUsed,
+			"threadsTotal": threadsTotal,
+		}}
+		if queued > 0 && busy > 0 {
+			result.Status = health.StatusWarn
+		}
+		return result, nil
+	})
+}
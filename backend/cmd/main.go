@@ -1,54 +1,212 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"path/filepath"
 	"time"
 
 	"streaming-platform/config"
+	"streaming-platform/internal/auth"
+	"streaming-platform/internal/catalog"
+	"streaming-platform/internal/fsck"
 	"streaming-platform/internal/handlers"
+	"streaming-platform/internal/keystore"
+	"streaming-platform/internal/lease"
+	"streaming-platform/internal/logging"
+	"streaming-platform/internal/metrics"
+	"streaming-platform/internal/poster"
+	"streaming-platform/internal/publish"
+	"streaming-platform/internal/scheduler"
+	"streaming-platform/internal/scratch"
+	"streaming-platform/internal/services"
+	"streaming-platform/internal/signing"
 	"streaming-platform/internal/storage"
+	"streaming-platform/internal/telemetry"
+	"streaming-platform/internal/webhook"
 	"streaming-platform/routes"
 	"streaming-platform/utils"
 )
 
 func main() {
-	// Carregar variáveis de ambiente
-	config := config.LoadConfig()
+	// Logs estruturados em JSON desde o início
+	if err := logging.Setup(os.Getenv("LOG_LEVEL")); err != nil {
+		logging.Fatal("erro ao configurar logs", "error", err)
+	}
+
+	// Carregar configuração: padrão, arquivo, variáveis de ambiente e flags
+	cfg, _, err := config.Load(os.Args[0], os.Args[1:])
+	if errors.Is(err, config.ErrPrintConfig) {
+		cfg.Dump(os.Stdout)
+		os.Exit(0)
+	}
+	if err == nil {
+		err = cfg.RequireBucket()
+	}
+	if err != nil {
+		logging.Fatal("configuração inválida", "error", err)
+	}
+	if err := cfg.EnsureSigningSecret(); err != nil {
+		logging.Fatal("erro ao configurar assinatura de URLs", "error", err)
+	}
+	if err := logging.SetLevel(cfg.LogLevel); err != nil {
+		logging.Fatal("erro ao configurar logs", "error", err)
+	}
+
+	slog.Info("iniciando servidor", "mode", cfg.Mode, "config", cfg.Redacted())
+
+	// Diretórios locais de trabalho
+	utils.EnsureDirectoryExists(filepath.Join(cfg.StoragePath, cfg.HLSBaseDir))
+	utils.EnsureDirectoryExists(filepath.Join(cfg.StoragePath, cfg.VideoBaseDir))
+	scratchManager, err := scratch.NewManager(cfg.ScratchDir, cfg.TempMinFreeMB<<20)
+	if err != nil {
+		logging.Fatal("erro ao preparar diretório de trabalho", "error", err)
+	}
+	metrics.SetTempDir(scratchManager.Root)
 
-	log.Printf("Iniciando servidor com as seguintes configurações básicas...")
+	// Configurar tracing (OpenTelemetry)
+	shutdownTracing, err := telemetry.SetupTracing(context.Background(), cfg.TracesExporter)
+	if err != nil {
+		logging.Fatal("erro ao configurar tracing", "error", err)
+	}
 
 	// Criar cliente S3
-	s3Client, err := storage.NewS3Client(config.S3Bucket, config.S3Region)
+	s3Client, err := storage.NewS3Client(cfg.S3Bucket, cfg.S3Region)
 	if err != nil {
-		log.Fatalf("Erro ao inicializar cliente S3: %v", err)
+		logging.Fatal("erro ao inicializar cliente S3", "error", err)
 	}
 
+	// Armazenamento das chaves de cifragem, separado do bucket de vídeos
+	keyStore, err := keystore.Open(cfg.KeyStoreBucket, cfg.S3Region, cfg.KeyStorePath)
+	if err != nil {
+		logging.Fatal("erro ao inicializar armazenamento de chaves", "error", err)
+	}
+	encryptor := &services.Encryptor{
+		Store:            keyStore,
+		Mode:             cfg.HLSEncryption,
+		RotationSegments: cfg.KeyRotation,
+	}
+	signer := signing.NewSigner(cfg.URLSigningSecret, cfg.URLExpiry)
+	catalogStore := catalog.NewStore(s3Client)
+	webhooks := webhook.NewDispatcher(catalogStore, cfg.WebhookTimeout, cfg.WebhookMaxAttempts, cfg.WebhookBackoff)
+
 	// Configurar handlers
-	uploadHandler := handlers.NewUploadHandler()
-	processHandler := handlers.NewProcessHandler(s3Client)
-
-	// Configurar rotas
-	router := routes.SetupRoutes(uploadHandler, processHandler)
-
-	// Loop de processamento otimizado
-	go func() {
-		for {
-			log.Println("Processando vídeos...")
-			if err := utils.ProcessVideos(s3Client, config.Qualities); err != nil {
-				log.Printf("Erro no processamento: %v", err)
-			}
-			time.Sleep(25 * time.Minute) // Intervalo maior para economizar recursos
+	playbackHandler := handlers.NewPlaybackHandler(s3Client, signer, catalogStore)
+	keyHandler := handlers.NewKeyHandler(keyStore, signer)
+	instanceID := cfg.InstanceID
+	if instanceID == "" {
+		instanceID = lease.DefaultHolder()
+	}
+	publisher := publish.NewPublisher(s3Client, catalogStore, keyStore, cfg.VersionsKeep)
+	posters := poster.NewManager(s3Client, catalogStore, cfg.PosterCandidates, cfg.ThumbnailWidths())
+	processor := utils.NewProcessor(s3Client, catalogStore, publisher, scratchManager, cfg.Qualities, encryptor, scheduler.NewCPUBudget(cfg.CPUBudget, cfg.WorkerCount), scheduler.NewQueue(cfg.OwnerMaxJobs), lease.NewManager(s3Client, instanceID, cfg.LeaseTTL), webhooks, posters, services.NewTrickplayOptions(cfg.TrickplayInterval, cfg.TrickplayWidth), services.PreviewOptions{Clips: cfg.PreviewClips, ClipLength: cfg.PreviewClipLength, Width: cfg.PreviewWidth}, cfg.JobTimeout, cfg.JobMaxAttempts)
+	// Onde há worker, o upload transcodifica na própria requisição
+	var uploadProcessor *utils.Processor
+	if cfg.RunsWorker() {
+		uploadProcessor = processor
+	}
+	uploadHandler := handlers.NewUploadHandler(s3Client, catalogStore, cfg.PriorityOwners, webhooks, uploadProcessor)
+	processHandler := handlers.NewProcessHandler(processor)
+	versionsHandler := handlers.NewVersionsHandler(publisher)
+	webhooksHandler := handlers.NewWebhooksHandler(webhooks)
+	postersHandler := handlers.NewPostersHandler(posters, signer)
+	healthHandler := handlers.NewHealthHandler(newHealthChecker(cfg, s3Client, catalogStore, processor, scratchManager))
+
+	// Configurar rotas: o modo worker expõe só as sondas e as métricas
+	router := routes.SetupWorkerRoutes(healthHandler)
+	if cfg.RunsAPI() {
+		authenticator, err := auth.NewAuthenticator(cfg.APIKeys)
+		if err != nil {
+			logging.Fatal("API_KEYS inválido", "error", err)
 		}
-	}()
+		if len(cfg.APIKeys) == 0 {
+			slog.Warn("API_KEYS não definido: as rotas de envio e de administração ficam abertas, sem autenticação")
+		}
+		router = routes.SetupRoutes(uploadHandler, processHandler, playbackHandler, keyHandler, healthHandler, versionsHandler, webhooksHandler, postersHandler, authenticator)
+	}
+
+	if cfg.RunsWorker() {
+		startWorker(cfg, processor, scratchManager, s3Client, catalogStore, keyStore)
+	}
 
 	// Configuração da porta pelo Railway
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080" // Padrão
+	server := &http.Server{
+		Addr:              fmt.Sprintf(":%d", cfg.Port),
+		Handler:           router,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+	slog.Info("servidor iniciado", "port", cfg.Port, "mode", cfg.Mode)
+	err = server.ListenAndServe()
+	shutdownTracing(context.Background())
+	logging.Fatal("servidor encerrado", "error", err)
+}
+
+// startWorker inicia o processamento da fila compartilhada de jobs e as
+// tarefas de manutenção que só fazem sentido onde há transcodificação.
+func startWorker(cfg config.Config, processor *utils.Processor, scratchManager *scratch.Manager, s3Client *storage.S3Client, catalogStore *catalog.Store, keyStore keystore.Store) {
+	go processor.Run(context.Background(), cfg.PollInterval)
+
+	// Novas tentativas das entregas de webhook que falharam. Só nos workers:
+	// as réplicas da API não disputam a varredura com eles
+	go processor.Webhooks.Run(context.Background(), min(cfg.WebhookBackoff, time.Minute), cfg.WebhookRetention)
+
+	// Limpeza dos diretórios de trabalho deixados por processos que caíram
+	if cfg.ScratchJanitorInterval > 0 {
+		go func() {
+			for {
+				sweepScratch(context.Background(), processor.Leases, scratchManager, cfg.ScratchMaxAge)
+				time.Sleep(cfg.ScratchJanitorInterval)
+			}
+		}()
+	}
+
+	// Verificação periódica de consistência do bucket
+	if cfg.FsckInterval > 0 {
+		checker := fsck.NewChecker(s3Client, catalogStore, keyStore, processor.Leases, cfg.MaxJobDuration())
+		go func() {
+			for {
+				time.Sleep(cfg.FsckInterval)
+				report, err := checker.Run(context.Background(), cfg.FsckRepair)
+				if errors.Is(err, lease.ErrHeld) {
+					slog.Info("verificação de consistência em andamento em outra réplica", "error", err)
+					continue
+				}
+				if err != nil {
+					slog.Error("erro na verificação de consistência", "error", err)
+					continue
+				}
+				slog.Info("verificação de consistência concluída",
+					"dry_run", report.DryRun, "issues", len(report.Issues), "counts", report.Counts(), "duration", report.Duration)
+			}
+		}()
+	}
+}
+
+// sweepScratch limpa o diretório de trabalho com o lease da máquina: réplicas
+// no mesmo host dividem a raiz, e só uma deve varrê-la por vez.
+func sweepScratch(ctx context.Context, leases *lease.Manager, scratchManager *scratch.Manager, maxAge time.Duration) {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "desconhecido"
+	}
+	l, err := leases.Acquire(ctx, "tasks/scratch-janitor/"+host)
+	if errors.Is(err, lease.ErrHeld) {
+		slog.Debug("limpeza do diretório de trabalho em andamento em outro processo", "host", host)
+		return
+	}
+	if err != nil {
+		slog.Error("erro ao obter o lease da limpeza do diretório de trabalho", "error", err)
+		return
+	}
+	defer l.Release(context.WithoutCancel(ctx))
+	if _, err := scratchManager.Sweep(maxAge); err != nil {
+		slog.Error("erro na limpeza do diretório de trabalho", "error", err)
 	}
-	log.Printf("Servidor iniciado na porta %s", port)
-	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%s", port), router))
 }
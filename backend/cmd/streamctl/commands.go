@@ -0,0 +1,634 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"streaming-platform/config"
+	"streaming-platform/internal/catalog"
+	"streaming-platform/internal/keystore"
+	"streaming-platform/internal/lease"
+	"streaming-platform/internal/poster"
+	"streaming-platform/internal/publish"
+	"streaming-platform/internal/quality"
+	"streaming-platform/internal/scheduler"
+	"streaming-platform/internal/scratch"
+	"streaming-platform/internal/services"
+	"streaming-platform/internal/storage"
+	"streaming-platform/internal/webhook"
+	"streaming-platform/utils"
+)
+
+// app reúne as dependências usadas pelos comandos.
+type app struct {
+	Config    config.Config
+	S3Client  *storage.S3Client
+	Catalog   *catalog.Store
+	Keys      keystore.Store
+	Publisher *publish.Publisher
+	Processor *utils.Processor
+	Scratch   *scratch.Manager
+	CPU       *scheduler.CPUBudget
+	Webhooks  *webhook.Dispatcher
+	Posters   *poster.Manager
+}
+
+func newApp(cfg config.Config, remote bool) (*app, error) {
+	scratchManager, err := scratch.NewManager(cfg.ScratchDir, cfg.TempMinFreeMB<<20)
+	if err != nil {
+		return nil, err
+	}
+	// Um job por vez: o streamctl processa no próprio terminal
+	a := &app{Config: cfg, Scratch: scratchManager, CPU: scheduler.NewCPUBudget(cfg.CPUBudget, 1)}
+	if !remote {
+		return a, nil
+	}
+
+	s3Client, err := storage.NewS3Client(cfg.S3Bucket, cfg.S3Region)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao inicializar cliente S3: %v", err)
+	}
+	keyStore, err := keystore.Open(cfg.KeyStoreBucket, cfg.S3Region, cfg.KeyStorePath)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao inicializar armazenamento de chaves: %v", err)
+	}
+	encryptor := &services.Encryptor{
+		Store:            keyStore,
+		Mode:             cfg.HLSEncryption,
+		RotationSegments: cfg.KeyRotation,
+	}
+
+	// O streamctl disputa os jobs com os servidores como qualquer réplica
+	holder := "streamctl@" + lease.DefaultHolder()
+	if cfg.InstanceID != "" {
+		holder = cfg.InstanceID
+	}
+
+	a.S3Client = s3Client
+	a.Catalog = catalog.NewStore(s3Client)
+	a.Keys = keyStore
+	a.Publisher = publish.NewPublisher(s3Client, a.Catalog, keyStore, cfg.VersionsKeep)
+	a.Webhooks = webhook.NewDispatcher(a.Catalog, cfg.WebhookTimeout, cfg.WebhookMaxAttempts, cfg.WebhookBackoff)
+	a.Posters = poster.NewManager(s3Client, a.Catalog, cfg.PosterCandidates, cfg.ThumbnailWidths())
+	a.Processor = utils.NewProcessor(s3Client, a.Catalog, a.Publisher, a.Scratch, cfg.Qualities, encryptor, a.CPU, scheduler.NewQueue(0), lease.NewManager(s3Client, holder, cfg.LeaseTTL), a.Webhooks, a.Posters, services.NewTrickplayOptions(cfg.TrickplayInterval, cfg.TrickplayWidth), services.PreviewOptions{Clips: cfg.PreviewClips, ClipLength: cfg.PreviewClipLength, Width: cfg.PreviewWidth}, cfg.JobTimeout, cfg.JobMaxAttempts)
+	return a, nil
+}
+
+// newFlagSet cria o conjunto de flags de um comando, com uso padronizado.
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "uso: streamctl %s\n", commands[name].usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// videoArg valida o único argumento posicional esperado por um comando.
+func videoArg(fs *flag.FlagSet) (string, error) {
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return "", errors.New("informe exatamente um argumento")
+	}
+	return fs.Arg(0), nil
+}
+
+// runTranscode transcodifica um arquivo local com os mesmos perfis do
+// servidor, sem tocar no bucket.
+func runTranscode(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("transcode")
+	output := fs.String("o", "", "diretório de saída (padrão: <arquivo>-hls ao lado do original)")
+	thumbnail := fs.Bool("thumbnail", false, "gera também a miniatura (thumbnail.jpg), escolhida entre os candidatos em poster/")
+	profileName := fs.String("profile", services.DefaultProfile, "perfil de transcodificação ("+profileNames()+")")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	input, err := videoArg(fs)
+	if err != nil {
+		return err
+	}
+	profile, ok := services.LookupProfile(*profileName)
+	if !ok {
+		return fmt.Errorf("perfil desconhecido '%s' (use %s)", *profileName, profileNames())
+	}
+	qualities := profile.Qualities(a.Config.Qualities)
+
+	for _, q := range a.Config.Qualities {
+		if !quality.IsSupported(q) {
+			return fmt.Errorf("qualidade desconhecida '%s' (use %s)", q, strings.Join(quality.Supported, ", "))
+		}
+	}
+	info, err := os.Stat(input)
+	if err != nil {
+		return err
+	}
+
+	videoID := filepath.Base(input)
+	// O original já está no disco: a reserva cobre só as saídas
+	lease, err := a.Scratch.Acquire(ctx, videoID, scratch.Estimate(info.Size(), len(a.Config.Qualities))-uint64(info.Size()))
+	if err != nil {
+		return err
+	}
+	defer lease.Release()
+	workspace := lease.Workspace
+
+	threads := scheduler.JobThreads(qualities, a.CPU.Total)
+
+	start := time.Now()
+	manifest, err := services.TranscodeVideoToHLS(ctx, workspace, videoID, input, qualities, threads, profile)
+	if err != nil {
+		return err
+	}
+
+	// Sem -o a saída fica em um diretório novo ao lado do arquivo
+	outputDir := *output
+	if outputDir == "" {
+		outputDir = strings.TrimSuffix(input, filepath.Ext(input)) + "-hls"
+	}
+	if err := os.MkdirAll(filepath.Dir(outputDir), 0755); err != nil {
+		return err
+	}
+	if err := moveDir(manifest.Dir, outputDir); err != nil {
+		return fmt.Errorf("erro ao mover saída para %s: %v", outputDir, err)
+	}
+	manifest.Dir = outputDir
+
+	if *thumbnail {
+		if err := localPoster(ctx, input, outputDir, a.Config.PosterCandidates); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("%s transcodificado em %s: %s (%d arquivos)\n", input, time.Since(start).Round(time.Second), manifest.LocalPath(manifest.Master), len(manifest.Files()))
+	return nil
+}
+
+// localPoster escolhe a capa entre os candidatos, que ficam em poster/ com
+// a pontuação impressa para comparação.
+func localPoster(ctx context.Context, input, outputDir string, candidates int) error {
+	frames, err := services.SamplePosterFrames(ctx, input, filepath.Join(outputDir, "poster"), candidates)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "CANDIDATO\tTEMPO\tNOTA\tBRILHO\tPRETO\tNITIDEZ\tTROCA DE CENA")
+	for _, frame := range frames {
+		fmt.Fprintf(tw, "%s\t%.1fs\t%.3f\t%.2f\t%.2f\t%.1f\t%.3f\n", filepath.Base(frame.Path), frame.Time,
+			frame.Score, frame.Luminance, frame.Blackness, frame.Sharpness, frame.SceneChange)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	// Os candidatos saem da melhor para a pior nota
+	best, err := os.ReadFile(frames[0].Path)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(outputDir, "thumbnail.jpg"), best, 0644)
+}
+
+// runUpload envia um arquivo local para videos/ e registra o job, como o
+// POST /upload. Com -process o vídeo é processado na hora.
+func runUpload(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("upload")
+	name := fs.String("name", "", "nome do vídeo no bucket, antes do sufixo aleatório (padrão: nome do arquivo)")
+	process := fs.Bool("process", false, "processa o vídeo agora em vez de esperar o servidor")
+	owner := fs.String("owner", "", "dono do vídeo, para o limite de processamentos simultâneos por dono")
+	priority := fs.String("priority", "normal", "prioridade na fila: low, normal, high, urgent ou um número")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	input, err := videoArg(fs)
+	if err != nil {
+		return err
+	}
+	jobPriority, err := catalog.ParsePriority(*priority)
+	if err != nil {
+		return err
+	}
+
+	fileName := filepath.Base(input)
+	if *name != "" {
+		fileName = *name
+	}
+	// Como no POST /upload, o sufixo aleatório impede que um envio com o
+	// mesmo nome sobrescreva outro vídeo
+	videoKey, err := catalog.NewVideoKey(fileName)
+	if err != nil {
+		return err
+	}
+
+	if err := a.S3Client.UploadFileFromPath(ctx, videoKey, input); err != nil {
+		return fmt.Errorf("erro ao enviar %s: %v", input, err)
+	}
+	job := catalog.NewJob(videoKey)
+	job.Owner = *owner
+	job.Priority = jobPriority
+	if err := a.Catalog.PutJob(ctx, job); err != nil {
+		return err
+	}
+	fmt.Printf("%s enviado como %s (job %s)\n", input, videoKey, job.ID)
+	if !*process {
+		touchQueue(ctx, a, "upload")
+	}
+	a.Webhooks.Publish(ctx, webhook.EventUploaded, webhook.VideoFromJob(job))
+
+	if *process {
+		return processNow(ctx, a, job)
+	}
+	return nil
+}
+
+// runList cruza os originais em videos/ com os jobs do catálogo.
+func runList(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("list")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	videoKeys, err := a.S3Client.ListFiles(ctx, "videos/")
+	if err != nil {
+		return fmt.Errorf("erro ao listar vídeos: %v", err)
+	}
+	jobs, err := a.Catalog.ListJobs(ctx)
+	if err != nil {
+		return err
+	}
+	byID := make(map[string]*catalog.Job, len(jobs))
+	for _, job := range jobs {
+		byID[job.ID] = job
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tESTADO\tTENTATIVAS\tATUALIZADO")
+	for _, videoKey := range videoKeys {
+		if strings.HasSuffix(videoKey, "/") {
+			continue
+		}
+		id := catalog.JobID(videoKey)
+		job, ok := byID[id]
+		if !ok {
+			fmt.Fprintf(tw, "%s\t-\t-\t-\n", id)
+			continue
+		}
+		delete(byID, id)
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\n", id, job.State, job.Attempts, job.UpdatedAt.Local().Format(time.DateTime))
+	}
+	// Jobs cujo original não existe mais
+	for id, job := range byID {
+		fmt.Fprintf(tw, "%s\t%s (sem original)\t%d\t%s\n", id, job.State, job.Attempts, job.UpdatedAt.Local().Format(time.DateTime))
+	}
+	return tw.Flush()
+}
+
+// runInspect mostra tudo o que existe no bucket para um vídeo.
+func runInspect(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("inspect")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	id, err := videoArg(fs)
+	if err != nil {
+		return err
+	}
+
+	info := map[string]interface{}{"id": id}
+	found := false
+
+	job, err := a.Catalog.GetJob(ctx, id)
+	switch {
+	case err == nil:
+		info["job"], found = job, true
+	case !errors.Is(err, catalog.ErrNotFound):
+		return err
+	}
+
+	if source, err := a.S3Client.StatObject(ctx, "videos/"+id, storage.ObjectOptions{}); err == nil {
+		info["source"] = map[string]interface{}{"key": "videos/" + id, "size": source.ContentLength, "lastModified": source.LastModified}
+		found = true
+	} else if !errors.Is(err, storage.ErrNotFound) {
+		return err
+	}
+
+	video, err := a.Catalog.GetVideo(ctx, id)
+	switch {
+	case err == nil:
+		info["video"], found = video, true
+	case !errors.Is(err, catalog.ErrNotFound):
+		return err
+	}
+
+	livePrefix, err := publish.LivePrefix(ctx, a.Catalog, id)
+	if err != nil {
+		return err
+	}
+	resolutions, err := a.S3Client.ListDirectories(ctx, livePrefix)
+	if err != nil {
+		return err
+	}
+	info["livePrefix"] = livePrefix
+	info["resolutions"] = resolutions
+
+	thumbnailKey := poster.Key(id)
+	if _, err := a.S3Client.StatObject(ctx, thumbnailKey, storage.ObjectOptions{}); err == nil {
+		info["thumbnail"], found = thumbnailKey, true
+	} else if !errors.Is(err, storage.ErrNotFound) {
+		return err
+	}
+
+	if !found && len(resolutions) == 0 {
+		return fmt.Errorf("vídeo %s não encontrado", id)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(info)
+}
+
+// runDelete remove o original, as saídas, as chaves, a miniatura e o job de
+// um vídeo.
+func runDelete(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("delete")
+	yes := fs.Bool("yes", false, "não pede confirmação")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	id, err := videoArg(fs)
+	if err != nil {
+		return err
+	}
+
+	if !*yes && !confirm(fmt.Sprintf("Remover o vídeo %s e todas as suas saídas? Digite o ID para confirmar: ", id), id) {
+		return errors.New("cancelado")
+	}
+
+	removed, err := a.S3Client.DeletePrefix(ctx, "videos-transcoded/"+id+"/")
+	if err != nil {
+		return err
+	}
+	if err := a.S3Client.Delete(ctx, "videos/"+id); err != nil {
+		return err
+	}
+	if err := a.Posters.Delete(ctx, id); err != nil {
+		return err
+	}
+	if err := a.Keys.DeleteVideo(ctx, id); err != nil {
+		return err
+	}
+	job, err := a.Catalog.GetJob(ctx, id)
+	if errors.Is(err, catalog.ErrNotFound) {
+		job, err = catalog.NewJob("videos/"+id), nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := a.Catalog.DeleteJob(ctx, id); err != nil {
+		return err
+	}
+	if err := a.Catalog.DeleteVideo(ctx, id); err != nil {
+		return err
+	}
+	deleted := webhook.VideoFromJob(job)
+	deleted.State = ""
+	a.Webhooks.Publish(ctx, webhook.EventDeleted, deleted)
+
+	fmt.Printf("vídeo %s removido (%d arquivos transcodificados)\n", id, removed)
+	return nil
+}
+
+// runReprocess processa um vídeo de novo. Com -queue o job só volta para
+// pendente e o servidor o pega na próxima varredura.
+func runReprocess(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("reprocess")
+	queue := fs.Bool("queue", false, "apenas devolve o job à fila do servidor")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	id, err := videoArg(fs)
+	if err != nil {
+		return err
+	}
+
+	job, err := a.Catalog.GetJob(ctx, id)
+	created := false
+	if errors.Is(err, catalog.ErrNotFound) {
+		// Vídeo enviado direto ao bucket, ainda sem job
+		if _, statErr := a.S3Client.StatObject(ctx, "videos/"+id, storage.ObjectOptions{}); statErr != nil {
+			return fmt.Errorf("vídeo %s não encontrado: %v", id, statErr)
+		}
+		job, err, created = catalog.NewJob("videos/"+id), nil, true
+	}
+	if err != nil {
+		return err
+	}
+
+	if *queue {
+		if created {
+			err = a.Catalog.PutJob(ctx, job)
+		} else {
+			// Escrita condicional: um worker pode estar com o job agora
+			job, err = a.Catalog.UpdateJob(ctx, id, requeue)
+		}
+		if err != nil {
+			return err
+		}
+		touchQueue(ctx, a, "reprocess")
+		fmt.Printf("job %s devolvido à fila\n", job.ID)
+		return nil
+	}
+	return processNow(ctx, a, job)
+}
+
+// requeue devolve o job à fila com as tentativas zeradas. Jobs em
+// processamento não são alterados, e os da dead-letter voltam por retry,
+// que escolhe o perfil.
+func requeue(job *catalog.Job) error {
+	switch job.State {
+	case catalog.JobProcessing:
+		return utils.ErrJobProcessing
+	case catalog.JobDeadLetter, catalog.JobDismissed:
+		return fmt.Errorf("job %s na dead-letter: use streamctl retry", job.ID)
+	}
+	job.State = catalog.JobPending
+	job.Attempts = 0
+	job.Error = ""
+	return nil
+}
+
+// runStatus mostra o estado de um job, ou a contagem de jobs por estado.
+func runStatus(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("status")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() > 0 {
+		job, err := a.Catalog.GetJob(ctx, fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s: %s (tentativas: %d, prioridade: %d, atualizado em %s)\n", job.ID, job.State, job.Attempts, job.Priority, job.UpdatedAt.Local().Format(time.DateTime))
+		if job.Owner != "" {
+			fmt.Printf("dono: %s\n", job.Owner)
+		}
+		if record, err := a.Processor.Leases.Get(ctx, job.ID); err == nil {
+			state := "válido"
+			if record.Expired() {
+				state = "expirado"
+			}
+			fmt.Printf("lease: %s, %s até %s\n", record.Holder, state, record.ExpiresAt.Local().Format(time.DateTime))
+		}
+		if job.Profile != "" {
+			fmt.Printf("perfil: %s\n", job.Profile)
+		}
+		if job.Error != "" {
+			fmt.Printf("erro: %s\n", job.Error)
+		}
+		if job.FFmpegStage != "" {
+			fmt.Printf("ffmpeg: etapa %s, código de saída %d\n", job.FFmpegStage, job.FFmpegExitCode)
+		}
+		if job.FFmpegStderr != "" {
+			fmt.Printf("saída do ffmpeg:\n%s\n", job.FFmpegStderr)
+		}
+		return nil
+	}
+
+	jobs, err := a.Catalog.ListJobs(ctx)
+	if err != nil {
+		return err
+	}
+	counts := map[string]int{}
+	for _, job := range jobs {
+		counts[job.State]++
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, state := range []string{catalog.JobPending, catalog.JobProcessing, catalog.JobSucceeded, catalog.JobFailed, catalog.JobDeadLetter, catalog.JobDismissed} {
+		fmt.Fprintf(tw, "%s\t%d\n", state, counts[state])
+	}
+	fmt.Fprintf(tw, "total\t%d\n", len(jobs))
+	return tw.Flush()
+}
+
+// runPriority muda a prioridade de um job pendente. O servidor aplica a nova
+// prioridade na próxima varredura; para mudar a posição de um job que já
+// está na fila do servidor, use POST /jobs/{id}/priority.
+func runPriority(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("priority")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return errors.New("informe o job e a prioridade")
+	}
+	priority, err := catalog.ParsePriority(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	job, err := a.Processor.SetPriority(ctx, fs.Arg(0), priority)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s: prioridade %d\n", job.ID, job.Priority)
+	return nil
+}
+
+// processNow processa o job neste processo, com o mesmo pipeline do servidor.
+func processNow(ctx context.Context, a *app, job *catalog.Job) error {
+	fmt.Printf("processando %s...\n", job.ID)
+	start := time.Now()
+	if err := a.Processor.RunJob(ctx, job); err != nil {
+		return err
+	}
+	fmt.Printf("%s processado em %s\n", job.ID, time.Since(start).Round(time.Second))
+	return nil
+}
+
+// touchQueue avisa os workers do servidor de que há job novo na fila. Uma
+// falha não desfaz o comando: o job entra na próxima sincronização completa.
+func touchQueue(ctx context.Context, a *app, reason string) {
+	if err := a.Catalog.TouchQueue(ctx, reason); err != nil {
+		fmt.Fprintf(os.Stderr, "aviso: os workers verão o job só na próxima varredura: %v\n", err)
+	}
+}
+
+// moveDir move um diretório. Entre sistemas de arquivos diferentes, copia
+// para um diretório temporário ao lado do destino e só então o renomeia, para
+// que uma cópia interrompida não deixe um destino pela metade.
+func moveDir(src, dst string) error {
+	if _, err := os.Stat(dst); err == nil {
+		return fmt.Errorf("destino %s já existe: remova-o ou escolha outro com -o", dst)
+	}
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	tmp, err := os.MkdirTemp(filepath.Dir(dst), "."+filepath.Base(dst)+"-")
+	if err != nil {
+		return err
+	}
+	if err := copyDir(src, tmp); err != nil {
+		os.RemoveAll(tmp)
+		return err
+	}
+	if err := os.Chmod(tmp, 0755); err != nil {
+		os.RemoveAll(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		os.RemoveAll(tmp)
+		return err
+	}
+	return nil
+}
+
+// copyDir copia o conteúdo de src para dst, que já existe.
+func copyDir(src, dst string) error {
+	return filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if d.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+
+		in, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		out, err := os.Create(target)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(out, in); err != nil {
+			out.Close()
+			return err
+		}
+		return out.Close()
+	})
+}
+
+// confirm pede que o operador digite o texto esperado.
+func confirm(prompt, expected string) bool {
+	fmt.Fprint(os.Stderr, prompt)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	return strings.TrimSpace(answer) == expected
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"streaming-platform/internal/services"
+)
+
+// runDeadLetter lista os jobs que esgotaram as tentativas.
+func runDeadLetter(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("dead-letter")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	jobs, err := a.Processor.DeadLetters(ctx)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "JOB\tTENTATIVAS\tPERFIL\tETAPA\tSAÍDA\tATUALIZADO EM\tERRO")
+	for _, job := range jobs {
+		profile := job.Profile
+		if profile == "" {
+			profile = services.DefaultProfile
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%d\t%s\t%s\n", job.ID, job.Attempts, profile, job.FFmpegStage,
+			job.FFmpegExitCode, job.UpdatedAt.Local().Format(time.DateTime), job.Error)
+	}
+	return tw.Flush()
+}
+
+// runRetry devolve à fila um job da dead-letter, opcionalmente com outro
+// perfil de transcodificação.
+func runRetry(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("retry")
+	profile := fs.String("profile", services.DefaultProfile, "perfil de transcodificação ("+profileNames()+")")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	id, err := videoArg(fs)
+	if err != nil {
+		return err
+	}
+
+	job, err := a.Processor.RetryDeadLetter(ctx, id, *profile)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("job %s devolvido à fila com o perfil %s\n", job.ID, *profile)
+	return nil
+}
+
+// runDismiss descarta um job da dead-letter.
+func runDismiss(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("dismiss")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	id, err := videoArg(fs)
+	if err != nil {
+		return err
+	}
+
+	job, err := a.Processor.DismissDeadLetter(ctx, id)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("job %s descartado\n", job.ID)
+	return nil
+}
+
+// profileNames lista os perfis de transcodificação para as mensagens de uso.
+func profileNames() string {
+	var names []string
+	for _, profile := range services.Profiles() {
+		names = append(names, profile.Name)
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"streaming-platform/internal/fsck"
+	"streaming-platform/internal/lease"
+)
+
+// runFsck verifica a consistência do bucket. Sem -repair nada é alterado.
+func runFsck(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("fsck")
+	repair := fs.Bool("repair", false, "aplica as correções (devolve vídeos à fila e remove órfãos)")
+	asJSON := fs.Bool("json", false, "imprime o relatório em JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	report, err := fsck.NewChecker(a.S3Client, a.Catalog, a.Keys, a.Processor.Leases, a.Config.MaxJobDuration()).Run(ctx, *repair)
+	if errors.Is(err, lease.ErrHeld) {
+		return fmt.Errorf("outra verificação em andamento: %v", err)
+	}
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+
+	fmt.Printf("originais: %d, saídas: %d, miniaturas: %d, jobs: %d (%s)\n",
+		report.Sources, report.Outputs, report.Thumbnails, report.Jobs, report.Duration)
+	if len(report.Issues) == 0 {
+		fmt.Println("nenhuma inconsistência encontrada")
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "TIPO\tVÍDEO\tCHAVE\tCORREÇÃO\tDETALHE")
+	failed := 0
+	for _, issue := range report.Issues {
+		action := issue.Repair
+		switch {
+		case issue.Error != "":
+			action += " (falhou: " + issue.Error + ")"
+			failed++
+		case issue.Repaired:
+			action += " (feito)"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", issue.Kind, issue.VideoID, issue.Key, action, issue.Detail)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if report.DryRun {
+		fmt.Printf("\n%d inconsistência(s); nada foi alterado (use -repair para corrigir)\n", len(report.Issues))
+	} else if failed > 0 {
+		return fmt.Errorf("%d correção(ões) falharam", failed)
+	}
+	return nil
+}
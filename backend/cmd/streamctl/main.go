@@ -0,0 +1,133 @@
+// streamctl é a ferramenta de linha de comando para operar a plataforma sem
+// passar pela API: transcodificação local, envio de vídeos e administração do
+// catálogo.
+//
+// Uso:
+//
+//	streamctl [flags de configuração] <comando> [flags do comando] [argumentos]
+//
+// As flags de configuração são as mesmas do servidor (veja streamctl -h) e
+// também podem vir das variáveis de ambiente ou de um arquivo -config.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+
+	"streaming-platform/config"
+	"streaming-platform/internal/logging"
+)
+
+// command é um subcomando do streamctl.
+type command struct {
+	usage  string
+	remote bool // precisa do bucket configurado
+	run    func(ctx context.Context, app *app, args []string) error
+}
+
+var commands map[string]command
+
+// Preenchido em init porque os comandos consultam o próprio mapa para o uso.
+func init() {
+	commands = map[string]command{
+		"transcode":   {usage: "transcode [-o dir] [-thumbnail] [-profile p] <arquivo>  transcodifica um arquivo local para HLS", run: runTranscode},
+		"upload":      {usage: "upload [-name nome] [-owner dono] [-priority p] [-process] <arquivo>  envia um vídeo para videos/ e registra o job", remote: true, run: runUpload},
+		"list":        {usage: "list                                       lista os vídeos e o estado dos jobs", remote: true, run: runList},
+		"inspect":     {usage: "inspect <id>                               mostra job, original, resoluções e miniatura", remote: true, run: runInspect},
+		"delete":      {usage: "delete [-yes] <id>                         remove o vídeo, as saídas, a miniatura e o job", remote: true, run: runDelete},
+		"reprocess":   {usage: "reprocess [-queue] <id>                    processa o vídeo de novo (ou só devolve à fila)", remote: true, run: runReprocess},
+		"priority":    {usage: "priority <id> <low|normal|high|urgent|n>  muda a prioridade de um job pendente", remote: true, run: runPriority},
+		"status":      {usage: "status [id]                                mostra o estado de um job ou o resumo da fila", remote: true, run: runStatus},
+		"versions":    {usage: "versions <id>                              lista as versões publicadas e qual está no ar", remote: true, run: runVersions},
+		"rollback":    {usage: "rollback <id> <versão>                     coloca no ar uma versão já publicada", remote: true, run: runRollback},
+		"prune":       {usage: "prune [-keep n] <id>                       remove versões antigas, mantendo a que está no ar", remote: true, run: runPrune},
+		"dead-letter": {usage: "dead-letter                                lista os jobs que esgotaram as tentativas", remote: true, run: runDeadLetter},
+		"retry":       {usage: "retry [-profile p] <id>                    devolve à fila um job da dead-letter", remote: true, run: runRetry},
+		"dismiss":     {usage: "dismiss <id>                               descarta um job da dead-letter", remote: true, run: runDismiss},
+		"fsck":        {usage: "fsck [-repair] [-json]                     verifica a consistência do bucket (dry-run por padrão)", remote: true, run: runFsck},
+	}
+}
+
+func main() {
+	if err := logging.Setup(os.Getenv("LOG_LEVEL")); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	cfg, args, err := config.Load("streamctl", os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		printUsage()
+		os.Exit(0)
+	}
+	if errors.Is(err, config.ErrPrintConfig) {
+		cfg.Dump(os.Stdout)
+		os.Exit(0)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if err := logging.SetLevel(cfg.LogLevel); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	if len(args) == 0 {
+		printUsage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "comando desconhecido: %s\n\n", args[0])
+		printUsage()
+		os.Exit(2)
+	}
+
+	if cmd.remote {
+		if err := cfg.RequireBucket(); err != nil {
+			fmt.Fprintf(os.Stderr, "configuração inválida:\n%v\n", err)
+			os.Exit(2)
+		}
+	}
+
+	// Ctrl+C cancela o comando em andamento (e mata o ffmpeg)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	app, err := newApp(cfg, cmd.remote)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	err = cmd.run(ctx, app, args[1:])
+	// Entregas de webhook disparadas pelo comando terminam antes de sair
+	app.Webhooks.Wait()
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", args[0], err)
+		os.Exit(1)
+	}
+}
+
+func printUsage() {
+	fmt.Fprintln(os.Stderr, "uso: streamctl [flags de configuração] <comando> [flags do comando] [argumentos]")
+	fmt.Fprintln(os.Stderr, "\ncomandos:")
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %s\n", commands[name].usage)
+	}
+	fmt.Fprintln(os.Stderr, "\nflags de configuração: streamctl -h")
+}
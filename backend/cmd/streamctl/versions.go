@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// runVersions lista as versões publicadas de um vídeo.
+func runVersions(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("versions")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	id, err := videoArg(fs)
+	if err != nil {
+		return err
+	}
+
+	video, err := a.Catalog.GetVideo(ctx, id)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSÃO\tQUALIDADES\tARQUIVOS\tBYTES\tCRIADA EM\t")
+	for _, version := range video.Versions {
+		live := ""
+		if version.Number == video.LiveVersion {
+			live = "no ar"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%s\t%s\n", version.Dir(), strings.Join(version.Qualities, ","),
+			version.Files, version.Bytes, version.CreatedAt.Local().Format(time.DateTime), live)
+	}
+	return tw.Flush()
+}
+
+// runRollback coloca no ar uma versão já publicada.
+func runRollback(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("rollback")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return errors.New("informe o vídeo e a versão")
+	}
+	number, err := strconv.Atoi(strings.TrimPrefix(fs.Arg(1), "v"))
+	if err != nil {
+		return fmt.Errorf("versão inválida: %s", fs.Arg(1))
+	}
+
+	video, err := a.Publisher.Rollback(ctx, fs.Arg(0), number)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s: v%d no ar\n", video.ID, video.LiveVersion)
+	return nil
+}
+
+// runPrune remove as versões antigas de um vídeo, mantendo a versão no ar.
+func runPrune(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("prune")
+	keep := fs.Int("keep", 2, "quantas versões recentes manter")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	id, err := videoArg(fs)
+	if err != nil {
+		return err
+	}
+	if *keep < 2 {
+		return errors.New("-keep deve ser pelo menos 2")
+	}
+
+	removed, err := a.Publisher.Prune(ctx, id, *keep)
+	if err != nil {
+		return err
+	}
+	if len(removed) == 0 {
+		fmt.Println("nenhuma versão removida")
+		return nil
+	}
+	for _, number := range removed {
+		fmt.Printf("removida v%d\n", number)
+	}
+	return nil
+}
@@ -1,65 +1,549 @@
 package config
 
 import (
-	"log"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
 	"os"
 	"path/filepath"
-	"streaming-platform/utils"
+	"reflect"
+	"strconv"
 	"strings"
+	"time"
+
+	"streaming-platform/internal/quality"
 
 	"github.com/joho/godotenv"
 )
 
+// redacted substitui os valores secretos no dump da configuração.
+const redacted = "[REDACTED]"
+
+// ErrPrintConfig é retornado por Load quando -print-config foi pedido; quem
+// chama imprime a configuração retornada (Dump) e encerra.
+var ErrPrintConfig = errors.New("impressão da configuração pedida")
+
+// Config é a configuração do servidor. Cada campo pode vir, em ordem
+// crescente de prioridade, do valor padrão, do arquivo JSON (chave json), da
+// variável de ambiente (env) e da flag de linha de comando (flag).
 type Config struct {
-	StoragePath  string
-	VideoBaseDir string
-	HLSBaseDir   string
-	Qualities    []string
-	S3Bucket     string
-	S3Region     string
+	Mode string `json:"mode" env:"MODE" flag:"mode" usage:"papel do processo: api (só HTTP), worker (só processamento) ou all"`
+
+	StoragePath  string   `json:"storagePath" env:"STORAGE_PATH" flag:"storage-path" usage:"diretório local de trabalho"`
+	VideoBaseDir string   `json:"videoBaseDir" env:"VIDEO_BASE_DIR" flag:"video-base-dir" usage:"subdiretório dos vídeos originais"`
+	HLSBaseDir   string   `json:"hlsBaseDir" env:"HLS_BASE_DIR" flag:"hls-base-dir" usage:"subdiretório das saídas HLS"`
+	Qualities    []string `json:"qualities" env:"VIDEO_QUALITIES" flag:"qualities" usage:"qualidades geradas, separadas por vírgula"`
+
+	S3Bucket string `json:"s3Bucket" env:"S3_BUCKET_NAME" flag:"s3-bucket" usage:"bucket S3 dos vídeos"`
+	S3Region string `json:"s3Region" env:"AWS_REGION" flag:"s3-region" usage:"região AWS do bucket"`
+
+	URLSigningSecret string        `json:"urlSigningSecret" env:"URL_SIGNING_SECRET" flag:"url-signing-secret" usage:"segredo HMAC das URLs de reprodução (obrigatório com MODE=api; sem ele, um segredo aleatório por processo)" secret:"true"`
+	URLExpiry        time.Duration `json:"urlExpiry" env:"URL_EXPIRY" flag:"url-expiry" usage:"validade das URLs de reprodução"`
+
+	APIKeys []string `json:"apiKeys" env:"API_KEYS" flag:"api-keys" usage:"chaves de API das rotas de escrita e administração, no formato dono:papel:chave (papel: uploader, editor ou admin), separadas por vírgula; vazio desliga a autenticação" secret:"true"`
+
+	HLSEncryption string `json:"hlsEncryption" env:"HLS_ENCRYPTION" flag:"hls-encryption" usage:"cifragem dos segmentos: none, per-video ou rotating"`
+	KeyRotation   int    `json:"keyRotation" env:"HLS_KEY_ROTATION" flag:"hls-key-rotation" usage:"segmentos por chave no modo rotating"`
+	KeyStorePath  string `json:"keyStorePath" env:"KEY_STORE_PATH" flag:"key-store-path" usage:"diretório das chaves, sem KEY_STORE_BUCKET (padrão: <storage-path>/keys); só serve com MODE=all"`
+	// Com as réplicas separadas (MODE=api e MODE=worker), as chaves precisam
+	// estar num lugar que todas alcançam
+	KeyStoreBucket string `json:"keyStoreBucket" env:"KEY_STORE_BUCKET" flag:"key-store-bucket" usage:"bucket S3 privado das chaves, compartilhado entre as réplicas e diferente do bucket dos vídeos"`
+
+	TracesExporter string `json:"tracesExporter" env:"OTEL_TRACES_EXPORTER" flag:"traces-exporter" usage:"exportador de traces: none, otlp ou stdout"`
+	LogLevel       string `json:"logLevel" env:"LOG_LEVEL" flag:"log-level" usage:"nível dos logs: debug, info, warn ou error"`
+
+	Port              int           `json:"port" env:"PORT" flag:"port" usage:"porta HTTP"`
+	ReadHeaderTimeout time.Duration `json:"readHeaderTimeout" env:"HTTP_READ_HEADER_TIMEOUT" flag:"read-header-timeout" usage:"tempo máximo para ler os cabeçalhos da requisição"`
+	ReadTimeout       time.Duration `json:"readTimeout" env:"HTTP_READ_TIMEOUT" flag:"read-timeout" usage:"tempo máximo para ler a requisição (0 = sem limite, para uploads grandes)"`
+	WriteTimeout      time.Duration `json:"writeTimeout" env:"HTTP_WRITE_TIMEOUT" flag:"write-timeout" usage:"tempo máximo para escrever a resposta (0 = sem limite)"`
+	IdleTimeout       time.Duration `json:"idleTimeout" env:"HTTP_IDLE_TIMEOUT" flag:"idle-timeout" usage:"tempo máximo de conexões ociosas"`
+
+	WorkerCount    int           `json:"workerCount" env:"WORKER_COUNT" flag:"workers" usage:"máximo de vídeos processados em paralelo (0 = limitado só pelo orçamento de CPU)"`
+	CPUBudget      int           `json:"cpuBudget" env:"CPU_BUDGET" flag:"cpu-budget" usage:"threads de CPU disponíveis para o ffmpeg (0 = todos os núcleos)"`
+	OwnerMaxJobs   int           `json:"ownerMaxJobs" env:"OWNER_MAX_JOBS" flag:"owner-max-jobs" usage:"máximo de vídeos de um mesmo dono processados em paralelo, somando todas as réplicas (0 = sem limite; jobs sem dono não entram no limite)"`
+	PriorityOwners []string      `json:"priorityOwners" env:"PRIORITY_OWNERS" flag:"priority-owners" usage:"donos (clientes pagantes) cujos envios entram com prioridade alta, separados por vírgula"`
+	PollInterval   time.Duration `json:"pollInterval" env:"POLL_INTERVAL" flag:"poll-interval" usage:"intervalo entre as varreduras de vídeos novos"`
+	JobTimeout     time.Duration `json:"jobTimeout" env:"JOB_TIMEOUT" flag:"job-timeout" usage:"tempo máximo de processamento de um vídeo (0 = sem limite)"`
+	JobMaxAttempts int           `json:"jobMaxAttempts" env:"JOB_MAX_ATTEMPTS" flag:"job-max-attempts" usage:"falhas seguidas até o job ir para a dead-letter (0 = tenta sempre)"`
+	InstanceID     string        `json:"instanceId" env:"INSTANCE_ID" flag:"instance-id" usage:"identificação desta réplica nos leases de jobs (padrão: hostname:pid)"`
+	LeaseTTL       time.Duration `json:"leaseTTL" env:"LEASE_TTL" flag:"lease-ttl" usage:"validade do lease de um job sem renovação; depois disso outra réplica pode assumi-lo"`
+	TempMinFreeMB  uint64        `json:"tempMinFreeMB" env:"TEMP_MIN_FREE_MB" flag:"temp-min-free-mb" usage:"espaço livre mínimo no diretório de trabalho, em MB; novos jobs esperam abaixo disso"`
+
+	ScratchDir             string        `json:"scratchDir" env:"SCRATCH_DIR" flag:"scratch-dir" usage:"diretório de trabalho dos processamentos (padrão: diretório temporário do sistema)"`
+	ScratchMaxAge          time.Duration `json:"scratchMaxAge" env:"SCRATCH_MAX_AGE" flag:"scratch-max-age" usage:"idade a partir da qual diretórios de trabalho sem job são removidos"`
+	ScratchJanitorInterval time.Duration `json:"scratchJanitorInterval" env:"SCRATCH_JANITOR_INTERVAL" flag:"scratch-janitor-interval" usage:"intervalo da limpeza de diretórios de trabalho abandonados (0 = desligada)"`
+
+	TrickplayInterval time.Duration `json:"trickplayInterval" env:"TRICKPLAY_INTERVAL" flag:"trickplay-interval" usage:"intervalo entre os quadros das prévias de navegação (0 = não gera)"`
+	TrickplayWidth    int           `json:"trickplayWidth" env:"TRICKPLAY_WIDTH" flag:"trickplay-width" usage:"largura, em pixels, de cada quadro das prévias de navegação"`
+
+	PosterCandidates int      `json:"posterCandidates" env:"POSTER_CANDIDATES" flag:"poster-candidates" usage:"quadros avaliados na escolha da capa de cada vídeo"`
+	ThumbnailSizes   []string `json:"thumbnailSizes" env:"THUMBNAIL_SIZES" flag:"thumbnail-sizes" usage:"larguras da capa redimensionada (em WebP e JPEG), separadas por vírgula, como 320w"`
+
+	PreviewClips      int           `json:"previewClips" env:"PREVIEW_CLIPS" flag:"preview-clips" usage:"trechos emendados na prévia animada de cada vídeo (0 = não gera)"`
+	PreviewClipLength time.Duration `json:"previewClipLength" env:"PREVIEW_CLIP_LENGTH" flag:"preview-clip-length" usage:"duração de cada trecho da prévia animada"`
+	PreviewWidth      int           `json:"previewWidth" env:"PREVIEW_WIDTH" flag:"preview-width" usage:"largura, em pixels, da prévia animada"`
+
+	VersionsKeep int `json:"versionsKeep" env:"VERSIONS_KEEP" flag:"versions-keep" usage:"versões de cada vídeo mantidas após publicar (0 = todas)"`
+
+	FsckInterval time.Duration `json:"fsckInterval" env:"FSCK_INTERVAL" flag:"fsck-interval" usage:"intervalo da verificação de consistência do bucket (0 = desligada)"`
+	FsckRepair   bool          `json:"fsckRepair" env:"FSCK_REPAIR" flag:"fsck-repair" usage:"corrige as inconsistências na verificação agendada (padrão: só relata)"`
+
+	WebhookTimeout     time.Duration `json:"webhookTimeout" env:"WEBHOOK_TIMEOUT" flag:"webhook-timeout" usage:"tempo máximo de resposta do receptor de um webhook"`
+	WebhookMaxAttempts int           `json:"webhookMaxAttempts" env:"WEBHOOK_MAX_ATTEMPTS" flag:"webhook-max-attempts" usage:"tentativas de entrega de um webhook antes de desistir"`
+	WebhookBackoff     time.Duration `json:"webhookBackoff" env:"WEBHOOK_BACKOFF" flag:"webhook-backoff" usage:"espera antes da segunda tentativa de um webhook; dobra a cada falha"`
+	WebhookRetention   time.Duration `json:"webhookRetention" env:"WEBHOOK_RETENTION" flag:"webhook-retention" usage:"por quanto tempo o log guarda as entregas encerradas (0 = para sempre)"`
+}
+
+// Default retorna a configuração padrão.
+func Default() Config {
+	return Config{
+		StoragePath:            "/app/videos", // Ajustado para funcionar no Railway
+		VideoBaseDir:           "videos",
+		HLSBaseDir:             "hls",
+		Qualities:              []string{"1080p", "720p", "480p"},
+		URLExpiry:              2 * time.Hour,
+		HLSEncryption:          "none",
+		KeyRotation:            10,
+		TracesExporter:         "none",
+		LogLevel:               "info",
+		Mode:                   ModeAll,
+		Port:                   8080,
+		ReadHeaderTimeout:      10 * time.Second,
+		IdleTimeout:            2 * time.Minute,
+		WorkerCount:            5,
+		PollInterval:           25 * time.Minute, // Intervalo maior para economizar recursos
+		OwnerMaxJobs:           2,
+		LeaseTTL:               2 * time.Minute,
+		JobTimeout:             2 * time.Hour,
+		JobMaxAttempts:         3,
+		TempMinFreeMB:          1024,
+		ScratchMaxAge:          6 * time.Hour,
+		ScratchJanitorInterval: 15 * time.Minute,
+		TrickplayInterval:      10 * time.Second,
+		TrickplayWidth:         160,
+		PosterCandidates:       8,
+		ThumbnailSizes:         []string{"160w", "320w", "640w", "1280w"},
+		PreviewClips:           4,
+		PreviewClipLength:      1500 * time.Millisecond,
+		PreviewWidth:           320,
+		VersionsKeep:           3,
+		FsckInterval:           24 * time.Hour,
+		WebhookTimeout:         10 * time.Second,
+		WebhookMaxAttempts:     8,
+		WebhookBackoff:         30 * time.Second,
+		WebhookRetention:       7 * 24 * time.Hour,
+	}
 }
 
-func LoadConfig() Config {
+// Load monta a configuração a partir do padrão, do arquivo (-config ou
+// CONFIG_FILE), das variáveis de ambiente (inclusive de um .env, se existir) e
+// das flags em args e valida os valores (Validate). Retorna os argumentos
+// posicionais que sobraram. O bucket é verificado à parte (RequireBucket), já
+// que nem todo comando do streamctl precisa dele.
+func Load(name string, args []string) (Config, []string, error) {
 	// Tenta carregar o .env apenas se existir
 	_ = godotenv.Load(".env")
 
-	// Pega as variáveis de ambiente ou usa valores padrão
-	storagePath := os.Getenv("STORAGE_PATH")
-	if storagePath == "" {
-		storagePath = "/app/videos" // Ajustado para funcionar no Railway
+	cfg := Default()
+
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	configFile := fs.String("config", os.Getenv("CONFIG_FILE"), "arquivo de configuração JSON")
+	printConfig := fs.Bool("print-config", false, "imprime a configuração efetiva (sem segredos) e encerra")
+
+	// As flags são aplicadas por último; aqui só guardamos os valores
+	flagValues := map[string]string{}
+	for _, f := range fields() {
+		f := f
+		if f.flag == "" {
+			continue
+		}
+		store := func(v string) error {
+			flagValues[f.flag] = v
+			return nil
+		}
+		if f.kind == boolKind {
+			fs.BoolFunc(f.flag, f.usage+" ("+f.env+")", store)
+		} else {
+			fs.Func(f.flag, f.usage+" ("+f.env+")", store)
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return cfg, nil, err
 	}
 
-	// Criar diretórios necessários
-	utils.EnsureDirectoryExists(filepath.Join(storagePath, "hls"))
-	utils.EnsureDirectoryExists(filepath.Join(storagePath, "videos"))
+	if *configFile != "" {
+		if err := cfg.loadFile(*configFile); err != nil {
+			return cfg, nil, err
+		}
+	}
+
+	for _, f := range fields() {
+		if v, ok := os.LookupEnv(f.env); ok && v != "" {
+			if err := cfg.set(f, v); err != nil {
+				return cfg, nil, fmt.Errorf("%s: %v", f.env, err)
+			}
+		}
+	}
 
-	videoBaseDir := os.Getenv("VIDEO_BASE_DIR")
-	if videoBaseDir == "" {
-		videoBaseDir = "videos"
+	for _, f := range fields() {
+		if v, ok := flagValues[f.flag]; ok {
+			if err := cfg.set(f, v); err != nil {
+				return cfg, nil, fmt.Errorf("-%s: %v", f.flag, err)
+			}
+		}
 	}
 
-	hlsBaseDir := os.Getenv("HLS_BASE_DIR")
-	if hlsBaseDir == "" {
-		hlsBaseDir = "hls"
+	// A variável padrão do OpenTelemetry liga o exportador OTLP
+	if cfg.TracesExporter == "none" && os.Getenv("OTEL_TRACES_EXPORTER") == "" && os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" {
+		cfg.TracesExporter = "otlp"
 	}
 
-	qualities := os.Getenv("VIDEO_QUALITIES")
-	if qualities == "" {
-		qualities = "1080p,720p,480p"
+	// Sem KEY_STORE_BUCKET, as chaves ficam fora do bucket, em um diretório
+	// local (ou volume montado)
+	if cfg.KeyStorePath == "" {
+		cfg.KeyStorePath = filepath.Join(cfg.StoragePath, "keys")
 	}
 
-	s3Bucket := os.Getenv("S3_BUCKET_NAME")
-	s3Region := os.Getenv("AWS_REGION")
+	if err := cfg.Validate(); err != nil {
+		return cfg, nil, err
+	}
 
-	log.Printf("Configuração carregada: StoragePath=%s, VideoBaseDir=%s, HLSBaseDir=%s, Qualities=%s",
-		storagePath, videoBaseDir, hlsBaseDir, qualities)
+	if *printConfig {
+		return cfg, fs.Args(), ErrPrintConfig
+	}
 
-	return Config{
-		StoragePath:  storagePath,
-		VideoBaseDir: videoBaseDir,
-		HLSBaseDir:   hlsBaseDir,
-		Qualities:    strings.Split(qualities, ","),
-		S3Bucket:     s3Bucket,
-		S3Region:     s3Region,
+	return cfg, fs.Args(), nil
+}
+
+// EnsureSigningSecret gera um segredo aleatório para assinar as URLs de
+// reprodução quando nenhum foi configurado.
+func (c *Config) EnsureSigningSecret() error {
+	if c.URLSigningSecret != "" {
+		return nil
+	}
+	secret, err := randomSecret()
+	if err != nil {
+		return err
+	}
+	c.URLSigningSecret = secret
+	slog.Warn("URL_SIGNING_SECRET não definido: usando segredo aleatório (URLs deixam de valer ao reiniciar)")
+	return nil
+}
+
+// Papéis do processo
+const (
+	ModeAPI    = "api"
+	ModeWorker = "worker"
+	ModeAll    = "all"
+)
+
+// RunsAPI indica se o processo atende a API HTTP.
+func (c Config) RunsAPI() bool {
+	return c.Mode == ModeAPI || c.Mode == ModeAll
+}
+
+// RunsWorker indica se o processo transcodifica vídeos.
+func (c Config) RunsWorker() bool {
+	return c.Mode == ModeWorker || c.Mode == ModeAll
+}
+
+// MaxJobDuration retorna quanto um job pode durar: JOB_TIMEOUT ou, sem
+// limite configurado, SCRATCH_MAX_AGE. Saídas e diretórios mais novos que
+// isso podem estar em uso por outra réplica.
+func (c Config) MaxJobDuration() time.Duration {
+	if c.JobTimeout > 0 {
+		return c.JobTimeout
+	}
+	return c.ScratchMaxAge
+}
+
+// Validate verifica campos obrigatórios e faixas de valores, retornando todos
+// os problemas encontrados de uma vez.
+func (c Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(oneOf(c.Mode, ModeAPI, ModeWorker, ModeAll), "MODE inválido '%s': use api, worker ou all", c.Mode)
+	check(c.StoragePath != "", "STORAGE_PATH é obrigatório")
+
+	check(len(c.Qualities) > 0, "VIDEO_QUALITIES precisa de ao menos uma qualidade")
+	seen := map[string]bool{}
+	for _, q := range c.Qualities {
+		check(quality.IsSupported(q), "VIDEO_QUALITIES: qualidade desconhecida '%s' (use %s)",
+			q, strings.Join(quality.Supported, ", "))
+		check(!seen[q], "VIDEO_QUALITIES: qualidade repetida '%s'", q)
+		seen[q] = true
+	}
+
+	// URLs pré-assinadas do S3 valem no máximo 7 dias
+	check(c.URLExpiry >= time.Minute && c.URLExpiry <= 7*24*time.Hour, "URL_EXPIRY deve estar entre 1m e 168h")
+	check(oneOf(c.HLSEncryption, "none", "per-video", "rotating"), "HLS_ENCRYPTION inválido '%s': use none, per-video ou rotating", c.HLSEncryption)
+	check(c.KeyRotation >= 1, "HLS_KEY_ROTATION deve ser maior que zero")
+	// Em KEY_STORE_PATH, as chaves gravadas por um worker não existem para a
+	// API nem para as outras réplicas
+	check(c.HLSEncryption == "none" || c.KeyStoreBucket != "" || c.Mode == ModeAll,
+		"HLS_ENCRYPTION '%s' com MODE=%s exige KEY_STORE_BUCKET: as chaves em KEY_STORE_PATH ficam só na máquina que as gravou", c.HLSEncryption, c.Mode)
+	check(c.KeyStoreBucket == "" || c.KeyStoreBucket != c.S3Bucket, "KEY_STORE_BUCKET deve ser diferente de S3_BUCKET_NAME: as chaves não ficam junto dos segmentos")
+	// Cada réplica geraria o próprio segredo, e as URLs assinadas por uma
+	// não valeriam nas outras
+	check(c.Mode != ModeAPI || c.URLSigningSecret != "", "URL_SIGNING_SECRET é obrigatório com MODE=api")
+	check(oneOf(c.TracesExporter, "none", "otlp", "stdout"), "OTEL_TRACES_EXPORTER inválido '%s': use none, otlp ou stdout", c.TracesExporter)
+	check(oneOf(strings.ToLower(c.LogLevel), "debug", "info", "warn", "error"), "LOG_LEVEL inválido '%s'", c.LogLevel)
+
+	check(c.Port > 0 && c.Port < 65536, "PORT fora da faixa: %d", c.Port)
+	check(c.ReadHeaderTimeout > 0, "HTTP_READ_HEADER_TIMEOUT deve ser maior que zero")
+	check(c.ReadTimeout >= 0 && c.WriteTimeout >= 0 && c.IdleTimeout >= 0, "timeouts HTTP não podem ser negativos")
+
+	check(c.WorkerCount >= 0 && c.WorkerCount <= 64, "WORKER_COUNT deve estar entre 0 e 64")
+	check(c.CPUBudget >= 0, "CPU_BUDGET não pode ser negativo")
+	check(c.OwnerMaxJobs >= 0, "OWNER_MAX_JOBS não pode ser negativo")
+	check(c.LeaseTTL >= 15*time.Second, "LEASE_TTL deve ser de pelo menos 15s")
+	check(c.PollInterval >= time.Second, "POLL_INTERVAL deve ser de pelo menos 1s")
+	check(c.JobTimeout >= 0, "JOB_TIMEOUT não pode ser negativo")
+	check(c.JobMaxAttempts >= 0, "JOB_MAX_ATTEMPTS não pode ser negativo")
+	check(c.ScratchJanitorInterval >= 0, "SCRATCH_JANITOR_INTERVAL não pode ser negativo")
+	// Um diretório mais novo que o tempo máximo de um job pode estar em uso
+	// por outro processo
+	check(c.ScratchMaxAge > 0 && (c.JobTimeout == 0 || c.ScratchMaxAge > c.JobTimeout), "SCRATCH_MAX_AGE deve ser maior que JOB_TIMEOUT")
+	check(c.TrickplayInterval == 0 || c.TrickplayInterval >= time.Second, "TRICKPLAY_INTERVAL deve ser 0 ou de pelo menos 1s")
+	check(c.TrickplayWidth >= 32 && c.TrickplayWidth <= 640, "TRICKPLAY_WIDTH deve estar entre 32 e 640")
+	check(c.PosterCandidates >= 1 && c.PosterCandidates <= 24, "POSTER_CANDIDATES deve estar entre 1 e 24")
+	check(len(c.ThumbnailSizes) > 0, "THUMBNAIL_SIZES precisa de ao menos uma largura")
+	for _, size := range c.ThumbnailSizes {
+		width := thumbnailWidth(size)
+		check(width >= 16 && width <= 3840, "THUMBNAIL_SIZES: largura inválida '%s' (use de 16w a 3840w)", size)
+	}
+	check(c.PreviewClips >= 0 && c.PreviewClips <= 10, "PREVIEW_CLIPS deve estar entre 0 e 10")
+	check(c.PreviewClipLength >= 500*time.Millisecond && c.PreviewClipLength <= 5*time.Second, "PREVIEW_CLIP_LENGTH deve estar entre 500ms e 5s")
+	check(c.PreviewWidth >= 64 && c.PreviewWidth <= 854 && c.PreviewWidth%2 == 0, "PREVIEW_WIDTH deve ser par e estar entre 64 e 854")
+	// A versão anterior precisa sobreviver para quem ainda está assistindo
+	check(c.VersionsKeep == 0 || c.VersionsKeep >= 2, "VERSIONS_KEEP deve ser 0 (todas) ou pelo menos 2")
+	check(c.FsckInterval == 0 || c.FsckInterval >= time.Minute, "FSCK_INTERVAL deve ser 0 ou de pelo menos 1m")
+	check(c.WebhookTimeout >= time.Second, "WEBHOOK_TIMEOUT deve ser de pelo menos 1s")
+	check(c.WebhookMaxAttempts >= 1 && c.WebhookMaxAttempts <= 20, "WEBHOOK_MAX_ATTEMPTS deve estar entre 1 e 20")
+	check(c.WebhookBackoff >= time.Second, "WEBHOOK_BACKOFF deve ser de pelo menos 1s")
+	check(c.WebhookRetention >= 0, "WEBHOOK_RETENTION não pode ser negativo")
+
+	return errors.Join(errs...)
+}
+
+// RequireBucket verifica se o bucket S3 está configurado.
+func (c Config) RequireBucket() error {
+	var errs []error
+	if strings.TrimSpace(c.S3Bucket) == "" {
+		errs = append(errs, errors.New("S3_BUCKET_NAME é obrigatório"))
+	}
+	if strings.TrimSpace(c.S3Region) == "" {
+		errs = append(errs, errors.New("AWS_REGION é obrigatório"))
+	}
+	return errors.Join(errs...)
+}
+
+// Dump escreve a configuração efetiva em JSON, com os segredos ocultos.
+func (c Config) Dump(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(c.Redacted())
+}
+
+// Redacted retorna a configuração como mapa (chaves json), com os segredos
+// ocultos, para logs e dumps.
+func (c Config) Redacted() map[string]interface{} {
+	out := map[string]interface{}{}
+	value := reflect.ValueOf(c)
+	for _, f := range fields() {
+		v := value.Field(f.index).Interface()
+		switch {
+		case f.secret && !value.Field(f.index).IsZero():
+			v = redacted
+		case f.kind == durationKind:
+			v = v.(time.Duration).String()
+		}
+		out[f.json] = v
+	}
+	return out
+}
+
+// loadFile aplica os valores do arquivo JSON sobre a configuração atual.
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("erro ao ler arquivo de configuração: %v", err)
+	}
+
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return fmt.Errorf("arquivo de configuração inválido %s: %v", path, err)
+	}
+
+	known := map[string]field{}
+	for _, f := range fields() {
+		known[f.json] = f
+	}
+
+	for key, v := range raw {
+		f, ok := known[key]
+		if !ok {
+			return fmt.Errorf("%s: chave desconhecida '%s'", path, key)
+		}
+
+		var s string
+		switch typed := v.(type) {
+		case []interface{}:
+			parts := make([]string, len(typed))
+			for i, item := range typed {
+				parts[i] = fmt.Sprint(item)
+			}
+			s = strings.Join(parts, ",")
+		case float64:
+			s = strconv.FormatFloat(typed, 'f', -1, 64)
+		default:
+			s = fmt.Sprint(typed)
+		}
+
+		if err := c.set(f, s); err != nil {
+			return fmt.Errorf("%s: %s: %v", path, key, err)
+		}
+	}
+	return nil
+}
+
+const (
+	stringKind = iota
+	stringsKind
+	intKind
+	uintKind
+	durationKind
+	boolKind
+)
+
+// field descreve um campo de Config a partir das suas tags.
+type field struct {
+	index  int
+	kind   int
+	json   string
+	env    string
+	flag   string
+	usage  string
+	secret bool
+}
+
+func fields() []field {
+	t := reflect.TypeOf(Config{})
+	out := make([]field, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		f := field{
+			index:  i,
+			json:   sf.Tag.Get("json"),
+			env:    sf.Tag.Get("env"),
+			flag:   sf.Tag.Get("flag"),
+			usage:  sf.Tag.Get("usage"),
+			secret: sf.Tag.Get("secret") == "true",
+		}
+		switch {
+		case sf.Type == reflect.TypeOf(time.Duration(0)):
+			f.kind = durationKind
+		case sf.Type.Kind() == reflect.Slice:
+			f.kind = stringsKind
+		case sf.Type.Kind() == reflect.Int:
+			f.kind = intKind
+		case sf.Type.Kind() == reflect.Uint64:
+			f.kind = uintKind
+		case sf.Type.Kind() == reflect.Bool:
+			f.kind = boolKind
+		default:
+			f.kind = stringKind
+		}
+		out = append(out, f)
+	}
+	return out
+}
+
+// set converte o texto e grava no campo correspondente.
+func (c *Config) set(f field, s string) error {
+	target := reflect.ValueOf(c).Elem().Field(f.index)
+	s = strings.TrimSpace(s)
+
+	switch f.kind {
+	case durationKind:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("duração inválida '%s'", s)
+		}
+		target.SetInt(int64(d))
+	case stringsKind:
+		var items []string
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		target.Set(reflect.ValueOf(items))
+	case intKind:
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return fmt.Errorf("número inválido '%s'", s)
+		}
+		target.SetInt(int64(n))
+	case uintKind:
+		n, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return fmt.Errorf("número inválido '%s'", s)
+		}
+		target.SetUint(n)
+	case boolKind:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("booleano inválido '%s'", s)
+		}
+		target.SetBool(b)
+	default:
+		target.SetString(s)
+	}
+	return nil
+}
+
+func oneOf(v string, options ...string) bool {
+	for _, option := range options {
+		if v == option {
+			return true
+		}
+	}
+	return false
+}
+
+func randomSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("erro ao gerar segredo aleatório: %v", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// ThumbnailWidths retorna as larguras de THUMBNAIL_SIZES em pixels.
+func (c Config) ThumbnailWidths() []int {
+	widths := make([]int, 0, len(c.ThumbnailSizes))
+	for _, size := range c.ThumbnailSizes {
+		widths = append(widths, thumbnailWidth(size))
+	}
+	return widths
+}
+
+// thumbnailWidth aceita "320w" ou "320"; retorna 0 se inválida.
+func thumbnailWidth(size string) int {
+	width, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(size), "w"))
+	if err != nil {
+		return 0
 	}
+	return width
 }
@@ -0,0 +1,207 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeConfigFile grava o arquivo JSON de configuração num diretório
+// temporário e retorna o caminho.
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	file := writeConfigFile(t, `{"port": 9000, "qualities": ["720p", "480p"], "urlExpiry": "1h", "fsckRepair": true}`)
+	tests := []struct {
+		name  string
+		env   map[string]string
+		args  []string
+		check func(t *testing.T, cfg Config)
+	}{
+		{"padrão", nil, nil, func(t *testing.T, cfg Config) {
+			if cfg.Port != 8080 || cfg.Mode != ModeAll || len(cfg.Qualities) != 3 {
+				t.Errorf("port = %d, mode = %s, qualities = %v", cfg.Port, cfg.Mode, cfg.Qualities)
+			}
+		}},
+		{"arquivo sobre o padrão", nil, []string{"-config", file}, func(t *testing.T, cfg Config) {
+			if cfg.Port != 9000 || strings.Join(cfg.Qualities, ",") != "720p,480p" || cfg.URLExpiry != time.Hour || !cfg.FsckRepair {
+				t.Errorf("port = %d, qualities = %v, urlExpiry = %s, fsckRepair = %v", cfg.Port, cfg.Qualities, cfg.URLExpiry, cfg.FsckRepair)
+			}
+		}},
+		{"arquivo por CONFIG_FILE", map[string]string{"CONFIG_FILE": file}, nil, func(t *testing.T, cfg Config) {
+			if cfg.Port != 9000 {
+				t.Errorf("port = %d, esperado 9000", cfg.Port)
+			}
+		}},
+		{"ambiente sobre o arquivo", map[string]string{"PORT": "9100", "URL_EXPIRY": "30m"}, []string{"-config", file}, func(t *testing.T, cfg Config) {
+			if cfg.Port != 9100 || cfg.URLExpiry != 30*time.Minute || strings.Join(cfg.Qualities, ",") != "720p,480p" {
+				t.Errorf("port = %d, urlExpiry = %s, qualities = %v", cfg.Port, cfg.URLExpiry, cfg.Qualities)
+			}
+		}},
+		{"variável vazia ignorada", map[string]string{"PORT": ""}, []string{"-config", file}, func(t *testing.T, cfg Config) {
+			if cfg.Port != 9000 {
+				t.Errorf("port = %d, esperado 9000", cfg.Port)
+			}
+		}},
+		{"flag sobre o ambiente", map[string]string{"PORT": "9100"}, []string{"-config", file, "-port", "9200", "-qualities", "1080p, 720p"}, func(t *testing.T, cfg Config) {
+			if cfg.Port != 9200 || strings.Join(cfg.Qualities, ",") != "1080p,720p" {
+				t.Errorf("port = %d, qualities = %v", cfg.Port, cfg.Qualities)
+			}
+		}},
+		{"flag booleana sem valor", nil, []string{"-fsck-repair"}, func(t *testing.T, cfg Config) {
+			if !cfg.FsckRepair {
+				t.Error("fsckRepair = false")
+			}
+		}},
+		{"endpoint OTLP liga o exportador", map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4318"}, nil, func(t *testing.T, cfg Config) {
+			if cfg.TracesExporter != "otlp" {
+				t.Errorf("tracesExporter = %s, esperado otlp", cfg.TracesExporter)
+			}
+		}},
+		{"diretório de chaves derivado", map[string]string{"STORAGE_PATH": "/dados"}, nil, func(t *testing.T, cfg Config) {
+			if cfg.KeyStorePath != filepath.Join("/dados", "keys") {
+				t.Errorf("keyStorePath = %s", cfg.KeyStorePath)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CONFIG_FILE", "")
+			t.Setenv("PORT", "")
+			t.Setenv("URL_EXPIRY", "")
+			t.Setenv("STORAGE_PATH", "")
+			t.Setenv("OTEL_TRACES_EXPORTER", "")
+			t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+
+			cfg, rest, err := Load("teste", append(tt.args, "video.mp4"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rest) != 1 || rest[0] != "video.mp4" {
+				t.Errorf("argumentos restantes = %v", rest)
+			}
+			tt.check(t, cfg)
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		file string
+		args []string
+		want string
+	}{
+		{"chave desconhecida no arquivo", nil, `{"porta": 9000}`, nil, "chave desconhecida 'porta'"},
+		{"arquivo inválido", nil, `{`, nil, "arquivo de configuração inválido"},
+		{"duração inválida no ambiente", map[string]string{"URL_EXPIRY": "duas horas"}, "", nil, "URL_EXPIRY: duração inválida"},
+		{"número inválido na flag", nil, "", []string{"-port", "oito"}, "-port: número inválido"},
+		{"valor fora da faixa", map[string]string{"PORT": "70000"}, "", nil, "PORT fora da faixa"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CONFIG_FILE", "")
+			t.Setenv("PORT", "")
+			t.Setenv("URL_EXPIRY", "")
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			args := tt.args
+			if tt.file != "" {
+				args = append([]string{"-config", writeConfigFile(t, tt.file)}, args...)
+			}
+
+			_, _, err := Load("teste", args)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Load() = %v, esperado erro com %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadPrintConfig(t *testing.T) {
+	t.Setenv("CONFIG_FILE", "")
+	if _, _, err := Load("teste", []string{"-print-config"}); !errors.Is(err, ErrPrintConfig) {
+		t.Errorf("Load() = %v, esperado %v", err, ErrPrintConfig)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(c *Config)
+		want   []string
+	}{
+		{"padrão", func(*Config) {}, nil},
+		{"modo desconhecido", func(c *Config) { c.Mode = "batch" }, []string{"MODE inválido 'batch'"}},
+		{"qualidade desconhecida", func(c *Config) { c.Qualities = []string{"720p", "4k"} }, []string{"qualidade desconhecida '4k'"}},
+		{"qualidade repetida", func(c *Config) { c.Qualities = []string{"720p", "720p"} }, []string{"qualidade repetida '720p'"}},
+		{"sem qualidades", func(c *Config) { c.Qualities = nil }, []string{"ao menos uma qualidade"}},
+		{"cifragem desconhecida", func(c *Config) { c.HLSEncryption = "aes" }, []string{"HLS_ENCRYPTION inválido"}},
+		{"cifragem com as réplicas separadas", func(c *Config) { c.Mode = ModeWorker; c.HLSEncryption = "per-video" }, []string{"exige KEY_STORE_BUCKET"}},
+		{"cifragem com bucket de chaves", func(c *Config) { c.Mode = ModeWorker; c.HLSEncryption = "per-video"; c.KeyStoreBucket = "chaves" }, nil},
+		{"chaves no bucket dos vídeos", func(c *Config) { c.S3Bucket = "videos"; c.KeyStoreBucket = "videos" }, []string{"KEY_STORE_BUCKET deve ser diferente"}},
+		{"API sem segredo de assinatura", func(c *Config) { c.Mode = ModeAPI }, []string{"URL_SIGNING_SECRET é obrigatório"}},
+		{"API com segredo de assinatura", func(c *Config) { c.Mode = ModeAPI; c.URLSigningSecret = "segredo" }, nil},
+		{"diretório de trabalho mais novo que o job", func(c *Config) { c.ScratchMaxAge = time.Hour }, []string{"SCRATCH_MAX_AGE deve ser maior que JOB_TIMEOUT"}},
+		{"jobs sem limite de tempo", func(c *Config) { c.JobTimeout = 0; c.ScratchMaxAge = time.Hour }, nil},
+		{"uma única versão mantida", func(c *Config) { c.VersionsKeep = 1 }, []string{"VERSIONS_KEEP"}},
+		{"largura de capa inválida", func(c *Config) { c.ThumbnailSizes = []string{"320w", "grande"} }, []string{"largura inválida 'grande'"}},
+		{"largura de prévia ímpar", func(c *Config) { c.PreviewWidth = 321 }, []string{"PREVIEW_WIDTH"}},
+		{
+			"todos os problemas de uma vez",
+			func(c *Config) { c.Port = 0; c.LeaseTTL = time.Second; c.WebhookMaxAttempts = 0 },
+			[]string{"PORT fora da faixa", "LEASE_TTL", "WEBHOOK_MAX_ATTEMPTS"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			tt.change(&cfg)
+
+			err := cfg.Validate()
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Errorf("Validate() = %v, esperado nil", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Validate() = nil, esperado erros com %q", tt.want)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Validate() = %v, esperado erro com %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	cfg := Default()
+	cfg.URLSigningSecret = "segredo"
+	cfg.APIKeys = []string{"dono:admin:chave"}
+
+	out := cfg.Redacted()
+	if out["urlSigningSecret"] != redacted || out["apiKeys"] != redacted {
+		t.Errorf("segredos expostos: %v, %v", out["urlSigningSecret"], out["apiKeys"])
+	}
+	if out["urlExpiry"] != "2h0m0s" {
+		t.Errorf("urlExpiry = %v, esperado 2h0m0s", out["urlExpiry"])
+	}
+}
@@ -0,0 +1,170 @@
+// Package auth identifica quem chama as rotas de escrita e de administração
+// da API. Cada chave de API pertence a um dono e tem um papel; o cliente a
+// envia no cabeçalho Authorization: Bearer <chave>. As rotas de leitura e de
+// reprodução continuam abertas (a reprodução usa as URLs assinadas). Sem
+// chaves configuradas não há autenticação: todas as rotas ficam abertas, como
+// antes das chaves existirem.
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// Role é o papel de uma chave de API. Cada papel pode tudo o que os
+// anteriores podem.
+type Role int
+
+const (
+	RoleUploader Role = iota + 1 // envia vídeos
+	RoleEditor                   // também escolhe capas e troca versões
+	RoleAdmin                    // também administra jobs e webhooks
+)
+
+var roleNames = map[Role]string{
+	RoleUploader: "uploader",
+	RoleEditor:   "editor",
+	RoleAdmin:    "admin",
+}
+
+func (r Role) String() string {
+	if name, ok := roleNames[r]; ok {
+		return name
+	}
+	return fmt.Sprintf("Role(%d)", int(r))
+}
+
+// ParseRole aceita uploader, editor ou admin.
+func ParseRole(name string) (Role, error) {
+	for role, roleName := range roleNames {
+		if strings.EqualFold(strings.TrimSpace(name), roleName) {
+			return role, nil
+		}
+	}
+	return 0, fmt.Errorf("papel inválido '%s': use uploader, editor ou admin", name)
+}
+
+var (
+	ErrUnauthenticated = errors.New("chave de API ausente ou inválida")
+	ErrForbidden       = errors.New("chave de API sem permissão para esta operação")
+)
+
+// Identity é quem fez a requisição.
+type Identity struct {
+	Owner string
+	Role  Role
+}
+
+// anonymous é a identidade das requisições quando não há chaves
+// configuradas: sem dono e com todas as permissões.
+var anonymous = Identity{Role: RoleAdmin}
+
+// Can indica se a identidade tem o papel informado (ou um acima dele).
+func (i Identity) Can(role Role) bool {
+	return i.Role >= role
+}
+
+// Anonymous indica uma requisição sem autenticação, feita sem chaves
+// configuradas.
+func (i Identity) Anonymous() bool {
+	return i.Owner == ""
+}
+
+// ParseKey lê uma chave de API no formato dono:papel:chave.
+func ParseKey(entry string) (string, Identity, error) {
+	parts := strings.SplitN(strings.TrimSpace(entry), ":", 3)
+	if len(parts) != 3 || strings.TrimSpace(parts[0]) == "" {
+		return "", Identity{}, errors.New("chave de API inválida: use dono:papel:chave")
+	}
+	role, err := ParseRole(parts[1])
+	if err != nil {
+		return "", Identity{}, err
+	}
+	// Chaves curtas podem ser adivinhadas
+	if len(parts[2]) < 16 {
+		return "", Identity{}, fmt.Errorf("chave de API de %s curta demais: use ao menos 16 caracteres", parts[0])
+	}
+	return parts[2], Identity{Owner: strings.TrimSpace(parts[0]), Role: role}, nil
+}
+
+// Authenticator reconhece as chaves de API configuradas.
+type Authenticator struct {
+	// Indexadas pelo SHA-256 da chave, para não guardar nem comparar as
+	// chaves em si
+	keys map[[sha256.Size]byte]Identity
+}
+
+// NewAuthenticator cria o Authenticator com as chaves no formato
+// dono:papel:chave. Sem chaves, a autenticação fica desligada.
+func NewAuthenticator(entries []string) (*Authenticator, error) {
+	a := &Authenticator{keys: make(map[[sha256.Size]byte]Identity, len(entries))}
+	for _, entry := range entries {
+		key, identity, err := ParseKey(entry)
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256([]byte(key))
+		if _, ok := a.keys[sum]; ok {
+			return nil, fmt.Errorf("chave de API de %s repetida", identity.Owner)
+		}
+		a.keys[sum] = identity
+	}
+	return a, nil
+}
+
+// Authenticate retorna a identidade da chave enviada na requisição.
+func (a *Authenticator) Authenticate(r *http.Request) (Identity, error) {
+	scheme, key, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || key == "" {
+		return Identity{}, ErrUnauthenticated
+	}
+	identity, ok := a.keys[sha256.Sum256([]byte(strings.TrimSpace(key)))]
+	if !ok {
+		return Identity{}, ErrUnauthenticated
+	}
+	return identity, nil
+}
+
+// Enabled indica se há chaves configuradas.
+func (a *Authenticator) Enabled() bool {
+	return len(a.keys) > 0
+}
+
+// Require só deixa passar requisições com uma chave de papel role ou acima;
+// a identidade fica no contexto (FromContext). Com a autenticação desligada,
+// todas passam com uma identidade anônima.
+func (a *Authenticator) Require(role Role) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !a.Enabled() {
+				next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), identityKey{}, anonymous)))
+				return
+			}
+			identity, err := a.Authenticate(r)
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="streaming-platform"`)
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+			if !identity.Can(role) {
+				slog.WarnContext(r.Context(), "requisição sem permissão", "owner", identity.Owner, "role", identity.Role, "required", role)
+				http.Error(w, ErrForbidden.Error(), http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), identityKey{}, identity)))
+		})
+	}
+}
+
+type identityKey struct{}
+
+// FromContext retorna a identidade guardada por Require.
+func FromContext(ctx context.Context) (Identity, bool) {
+	identity, ok := ctx.Value(identityKey{}).(Identity)
+	return identity, ok
+}
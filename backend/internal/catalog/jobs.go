@@ -0,0 +1,328 @@
+package catalog
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"streaming-platform/internal/storage"
+)
+
+// Estados de um job de processamento
+const (
+	JobPending    = "pending"
+	JobProcessing = "processing"
+	JobSucceeded  = "succeeded"
+	JobFailed     = "failed"
+	// JobDeadLetter é o job que falhou em todas as tentativas: sai da fila
+	// até alguém tentar de novo (possivelmente com outro perfil) ou descartá-lo
+	JobDeadLetter = "dead_letter"
+	JobDismissed  = "dismissed"
+)
+
+// Prioridades de um job: maior sai da fila primeiro. Qualquer inteiro é
+// aceito; os nomes cobrem os casos comuns.
+const (
+	PriorityLow    = -10 // migrações de acervo e envios em massa
+	PriorityNormal = 0
+	PriorityHigh   = 10 // clientes pagantes
+	PriorityUrgent = 20 // clipes de notícia urgentes
+)
+
+var priorityNames = map[string]int{
+	"low":    PriorityLow,
+	"normal": PriorityNormal,
+	"high":   PriorityHigh,
+	"urgent": PriorityUrgent,
+}
+
+// ParsePriority aceita um nome (low, normal, high, urgent) ou um inteiro.
+func ParsePriority(value string) (int, error) {
+	if priority, ok := priorityNames[strings.ToLower(strings.TrimSpace(value))]; ok {
+		return priority, nil
+	}
+	priority, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("prioridade inválida '%s': use low, normal, high, urgent ou um número", value)
+	}
+	return priority, nil
+}
+
+const jobsPrefix = "catalog/jobs/"
+
+var (
+	ErrNotFound = errors.New("registro não encontrado")
+	// ErrConflict indica que o registro continuou mudando por outros
+	// processos em todas as tentativas de uma atualização condicional.
+	ErrConflict = errors.New("registro alterado por outro processo")
+)
+
+// maxUpdateAttempts limita as releituras de uma atualização condicional.
+const maxUpdateAttempts = 5
+
+// Job é o registro de processamento de um vídeo enviado para videos/.
+type Job struct {
+	ID        string    `json:"id"`
+	VideoKey  string    `json:"videoKey"`
+	State     string    `json:"state"`
+	Error     string    `json:"error,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	// Attempts conta as falhas seguidas causadas pelo original (ffmpeg ou
+	// ffprobe). Zera no sucesso e sempre que o job é devolvido à fila.
+	Attempts int `json:"attempts"`
+
+	// Owner é quem enviou o vídeo: jobs do mesmo dono dividem um limite de
+	// processamentos simultâneos. Priority ordena a fila (maior primeiro).
+	Owner    string `json:"owner,omitempty"`
+	Priority int    `json:"priority"`
+
+	// FFmpegStderr guarda o final da saída de erro do ffmpeg na última falha,
+	// com a etapa e o código de saída.
+	FFmpegStderr   string `json:"ffmpegStderr,omitempty"`
+	FFmpegStage    string `json:"ffmpegStage,omitempty"`
+	FFmpegExitCode int    `json:"ffmpegExitCode,omitempty"`
+
+	// Probe é a saída do ffprobe (JSON) do original na última falha de
+	// transcodificação, para a triagem de arquivos corrompidos.
+	Probe json.RawMessage `json:"probe,omitempty"`
+
+	// Profile é o perfil de transcodificação (vazio = padrão), escolhido ao
+	// tentar de novo um job da dead-letter.
+	Profile string `json:"profile,omitempty"`
+
+	// TraceContext guarda o contexto de trace (W3C traceparent) da requisição
+	// que originou o job, para que o processamento assíncrono seja ligado a ela.
+	TraceContext map[string]string `json:"traceContext,omitempty"`
+}
+
+// Finished indica se o job não volta mais sozinho para a fila: concluído,
+// na dead-letter ou descartado.
+func (j *Job) Finished() bool {
+	return j.State == JobSucceeded || j.State == JobDeadLetter || j.State == JobDismissed
+}
+
+// JobID retorna o ID do job (e do vídeo) para uma chave em videos/.
+func JobID(videoKey string) string {
+	return path.Base(videoKey)
+}
+
+// NewVideoKey retorna uma chave nova em videos/ para um envio com o nome de
+// arquivo informado. Um sufixo aleatório evita que um envio com o mesmo nome
+// sobrescreva o original (e as saídas) de outro vídeo.
+func NewVideoKey(fileName string) (string, error) {
+	name := path.Base(strings.ReplaceAll(fileName, `\`, "/"))
+	if name == "." || name == "/" || name == ".." {
+		name = "video"
+	}
+	ext := path.Ext(name)
+	suffix := make([]byte, 6)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", fmt.Errorf("erro ao gerar nome do vídeo: %v", err)
+	}
+	return "videos/" + strings.TrimSuffix(name, ext) + "-" + hex.EncodeToString(suffix) + ext, nil
+}
+
+// NewJob cria um job pendente para o vídeo informado.
+func NewJob(videoKey string) *Job {
+	now := time.Now().UTC()
+	return &Job{
+		ID:        JobID(videoKey),
+		VideoKey:  videoKey,
+		State:     JobPending,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+// Store guarda os registros do catálogo como documentos JSON no bucket, sem
+// exigir um banco de dados à parte.
+type Store struct {
+	S3Client *storage.S3Client
+}
+
+func NewStore(s3Client *storage.S3Client) *Store {
+	return &Store{S3Client: s3Client}
+}
+
+// Ping verifica se os registros do catálogo podem ser lidos.
+func (s *Store) Ping(ctx context.Context) error {
+	return s.S3Client.ProbePrefix(ctx, jobsPrefix)
+}
+
+// GetJob retorna o job com o ID informado, ou ErrNotFound.
+func (s *Store) GetJob(ctx context.Context, id string) (*Job, error) {
+	var job Job
+	if err := s.get(ctx, jobsPrefix+id+".json", &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// PutJob grava o job, atualizando UpdatedAt.
+func (s *Store) PutJob(ctx context.Context, job *Job) error {
+	job.UpdatedAt = time.Now().UTC()
+	return s.put(ctx, jobsPrefix+job.ID+".json", job)
+}
+
+// UpdateJob lê o job, aplica update e grava só se ninguém o alterou no meio
+// tempo (escrita condicional pelo ETag); caso contrário lê de novo e repete.
+// Um erro de update cancela a atualização e é retornado como está.
+func (s *Store) UpdateJob(ctx context.Context, id string, update func(*Job) error) (*Job, error) {
+	return updateRecord(ctx, s, jobsPrefix+id+".json", func(job *Job) error {
+		if err := update(job); err != nil {
+			return err
+		}
+		job.UpdatedAt = time.Now().UTC()
+		return nil
+	})
+}
+
+// DeleteJob remove o registro do job.
+func (s *Store) DeleteJob(ctx context.Context, id string) error {
+	if err := s.S3Client.Delete(ctx, jobsPrefix+id+".json"); err != nil {
+		return fmt.Errorf("erro ao remover job %s: %v", id, err)
+	}
+	return nil
+}
+
+// ListJobs retorna todos os jobs registrados.
+func (s *Store) ListJobs(ctx context.Context) ([]*Job, error) {
+	keys, err := s.S3Client.ListFiles(ctx, jobsPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao listar jobs: %v", err)
+	}
+
+	jobs := make([]*Job, 0, len(keys))
+	for _, key := range keys {
+		if !strings.HasSuffix(key, ".json") {
+			continue
+		}
+		var job Job
+		if err := s.get(ctx, key, &job); err != nil {
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		jobs = append(jobs, &job)
+	}
+	return jobs, nil
+}
+
+func (s *Store) get(ctx context.Context, key string, v interface{}) error {
+	data, err := s.S3Client.DownloadFile(ctx, key)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("erro ao ler %s: %v", key, err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("registro corrompido %s: %v", key, err)
+	}
+	return nil
+}
+
+// getWithETag lê o registro e retorna o ETag da versão lida.
+func (s *Store) getWithETag(ctx context.Context, key string, v interface{}) (string, error) {
+	object, err := s.S3Client.GetObject(ctx, key, storage.ObjectOptions{})
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return "", ErrNotFound
+		}
+		return "", fmt.Errorf("erro ao ler %s: %v", key, err)
+	}
+	defer object.Body.Close()
+	data, err := io.ReadAll(object.Body)
+	if err != nil {
+		return "", fmt.Errorf("erro ao ler %s: %v", key, err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return "", fmt.Errorf("registro corrompido %s: %v", key, err)
+	}
+	return object.ETag, nil
+}
+
+// putIfMatch grava o registro só se a versão no bucket ainda tem o ETag
+// informado; sem ETag, só se o registro não existe. Retorna
+// storage.ErrPreconditionFailed se outro processo gravou antes.
+func (s *Store) putIfMatch(ctx context.Context, key string, v interface{}, etag string) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if etag == "" {
+		_, err = s.S3Client.PutIfAbsent(ctx, key, data)
+	} else {
+		_, err = s.S3Client.PutIfMatch(ctx, key, data, etag)
+	}
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		// Removido depois da leitura
+		return ErrNotFound
+	case err != nil && !errors.Is(err, storage.ErrPreconditionFailed):
+		return fmt.Errorf("erro ao gravar %s: %w", key, err)
+	}
+	return err
+}
+
+// updateRecord aplica update ao registro em key com escrita condicional,
+// repetindo com a versão atual enquanto outro processo gravar no meio.
+func updateRecord[T any](ctx context.Context, s *Store, key string, update func(*T) error) (*T, error) {
+	return modifyRecord(ctx, s, key, false, update)
+}
+
+// upsertRecord é como updateRecord, mas um registro inexistente é criado:
+// update recebe o valor zero e a gravação só vale se ninguém criou o
+// registro no meio tempo.
+func upsertRecord[T any](ctx context.Context, s *Store, key string, update func(*T) error) (*T, error) {
+	return modifyRecord(ctx, s, key, true, update)
+}
+
+func modifyRecord[T any](ctx context.Context, s *Store, key string, create bool, update func(*T) error) (*T, error) {
+	for attempt := 0; attempt < maxUpdateAttempts; attempt++ {
+		record := new(T)
+		etag, err := s.getWithETag(ctx, key, record)
+		if errors.Is(err, ErrNotFound) && create {
+			// Sem ETag, putIfMatch só grava se o registro continuar ausente
+			record, etag, err = new(T), "", nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := update(record); err != nil {
+			return nil, err
+		}
+		err = s.putIfMatch(ctx, key, record, etag)
+		if errors.Is(err, storage.ErrPreconditionFailed) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return record, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrConflict, key)
+}
+
+func (s *Store) put(ctx context.Context, key string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := s.S3Client.Put(ctx, key, bytes.NewReader(data)); err != nil {
+		return fmt.Errorf("erro ao gravar %s: %v", key, err)
+	}
+	return nil
+}
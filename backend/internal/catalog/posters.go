@@ -0,0 +1,87 @@
+package catalog
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const postersPrefix = "catalog/posters/"
+
+// Quem escolheu a capa de um vídeo
+const (
+	PosterAuto   = "auto"   // o candidato de maior pontuação
+	PosterEditor = "editor" // escolhido pela API
+)
+
+// PosterCandidate é um quadro candidato a capa, com a pontuação e as medidas
+// que a compõem. Widths são as larguras em que o candidato já foi
+// redimensionado, para que escolhê-lo não exija o ffmpeg.
+type PosterCandidate struct {
+	Index       int     `json:"index"`
+	Key         string  `json:"key"`
+	Time        float64 `json:"time"`
+	Score       float64 `json:"score"`
+	Luminance   float64 `json:"luminance"`
+	Blackness   float64 `json:"blackness"`
+	Sharpness   float64 `json:"sharpness"`
+	SceneChange float64 `json:"sceneChange"`
+	Widths      []int   `json:"widths,omitempty"`
+}
+
+// Poster registra os candidatos a capa de um vídeo e qual deles está em
+// thumbnails/{id}.jpg. Widths são as larguras em que a capa foi
+// redimensionada (em WebP e JPEG) e Previews as chaves da prévia animada.
+type Poster struct {
+	VideoID    string            `json:"videoId"`
+	Selected   int               `json:"selected"`
+	SelectedBy string            `json:"selectedBy"`
+	Candidates []PosterCandidate `json:"candidates"`
+	Widths     []int             `json:"widths,omitempty"`
+	Previews   []string          `json:"previews,omitempty"`
+	UpdatedAt  time.Time         `json:"updatedAt"`
+}
+
+// Candidate retorna o candidato de índice n, ou nil se ele não existe.
+func (p *Poster) Candidate(n int) *PosterCandidate {
+	for i := range p.Candidates {
+		if p.Candidates[i].Index == n {
+			return &p.Candidates[i]
+		}
+	}
+	return nil
+}
+
+// GetPoster retorna o registro da capa do vídeo, ou ErrNotFound.
+func (s *Store) GetPoster(ctx context.Context, videoID string) (*Poster, error) {
+	var poster Poster
+	if err := s.get(ctx, postersPrefix+videoID+".json", &poster); err != nil {
+		return nil, err
+	}
+	return &poster, nil
+}
+
+// UpdatePoster aplica update ao registro da capa com escrita condicional,
+// como UpdateJob, criando-o se ainda não existe. Cada etapa (publicação dos
+// candidatos, escolha do editor, prévia animada) altera só os próprios
+// campos, sem apagar o que outra gravou no meio tempo.
+func (s *Store) UpdatePoster(ctx context.Context, videoID string, update func(*Poster) error) (*Poster, error) {
+	return upsertRecord(ctx, s, postersPrefix+videoID+".json", func(poster *Poster) error {
+		if poster.VideoID == "" {
+			poster.VideoID, poster.SelectedBy = videoID, PosterAuto
+		}
+		if err := update(poster); err != nil {
+			return err
+		}
+		poster.UpdatedAt = time.Now().UTC()
+		return nil
+	})
+}
+
+// DeletePoster remove o registro da capa.
+func (s *Store) DeletePoster(ctx context.Context, videoID string) error {
+	if err := s.S3Client.Delete(ctx, postersPrefix+videoID+".json"); err != nil {
+		return fmt.Errorf("erro ao remover capa %s: %v", videoID, err)
+	}
+	return nil
+}
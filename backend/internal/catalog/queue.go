@@ -0,0 +1,39 @@
+package catalog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"streaming-platform/internal/storage"
+)
+
+// queueMarkerKey é regravado a cada job que entra (ou volta) na fila. Os
+// workers consultam só o ETag dele entre as sincronizações completas, o que
+// custa um HEAD em vez de listar videos/ e ler todos os jobs.
+const queueMarkerKey = "catalog/queue.json"
+
+type queueMarker struct {
+	Reason    string    `json:"reason"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// TouchQueue avisa os workers de que a fila mudou (envio, nova tentativa,
+// mudança de prioridade), para que a sincronizem sem esperar o intervalo.
+func (s *Store) TouchQueue(ctx context.Context, reason string) error {
+	return s.put(ctx, queueMarkerKey, queueMarker{Reason: reason, UpdatedAt: time.Now().UTC()})
+}
+
+// QueueVersion retorna o ETag do marcador da fila; vazio se ele ainda não
+// existe.
+func (s *Store) QueueVersion(ctx context.Context) (string, error) {
+	object, err := s.S3Client.StatObject(ctx, queueMarkerKey, storage.ObjectOptions{})
+	if errors.Is(err, storage.ErrNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("erro ao ler %s: %v", queueMarkerKey, err)
+	}
+	return object.ETag, nil
+}
@@ -0,0 +1,137 @@
+package catalog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const videosPrefix = "catalog/videos/"
+
+// Version é um conjunto de saídas publicado de um vídeo, guardado em
+// videos-transcoded/{id}/v{n}/ e nunca alterado depois de publicado.
+type Version struct {
+	Number    int       `json:"number"`
+	Qualities []string  `json:"qualities"`
+	Files     int       `json:"files"`
+	Bytes     int64     `json:"bytes"`
+	CreatedAt time.Time `json:"createdAt"`
+
+	// Trickplay é o caminho, dentro da versão, do índice WebVTT das prévias
+	// de navegação (vazio se não foram geradas)
+	Trickplay string `json:"trickplay,omitempty"`
+
+	// Keys são os IDs das chaves de cifragem da versão, removidas com ela
+	Keys []string `json:"keys,omitempty"`
+}
+
+// Dir retorna o diretório da versão dentro das saídas do vídeo.
+func (v Version) Dir() string {
+	return VersionDir(v.Number)
+}
+
+// VersionDir retorna o diretório da versão n: "v{n}".
+func VersionDir(n int) string {
+	return "v" + strconv.Itoa(n)
+}
+
+// Video registra as versões publicadas de um vídeo e qual delas está no ar.
+// Trocar LiveVersion é o que publica (ou reverte) uma transcodificação: o
+// master servido em /stream passa a apontar para ela, enquanto quem já estava
+// assistindo continua na versão anterior.
+type Video struct {
+	ID          string    `json:"id"`
+	LiveVersion int       `json:"liveVersion"`
+	Versions    []Version `json:"versions"`
+	PublishedAt time.Time `json:"publishedAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// Version retorna a versão n, ou nil se ela não existe.
+func (v *Video) Version(n int) *Version {
+	for i := range v.Versions {
+		if v.Versions[i].Number == n {
+			return &v.Versions[i]
+		}
+	}
+	return nil
+}
+
+// NextVersion retorna o número da próxima versão a ser publicada.
+func (v *Video) NextVersion() int {
+	next := 1
+	for _, version := range v.Versions {
+		if version.Number >= next {
+			next = version.Number + 1
+		}
+	}
+	return next
+}
+
+// GetVideo retorna o registro do vídeo, ou ErrNotFound se ele nunca foi
+// publicado com versões.
+func (s *Store) GetVideo(ctx context.Context, id string) (*Video, error) {
+	var video Video
+	if err := s.get(ctx, videosPrefix+id+".json", &video); err != nil {
+		return nil, err
+	}
+	return &video, nil
+}
+
+// PutVideo grava o registro do vídeo, atualizando UpdatedAt.
+func (s *Store) PutVideo(ctx context.Context, video *Video) error {
+	video.UpdatedAt = time.Now().UTC()
+	return s.put(ctx, videosPrefix+video.ID+".json", video)
+}
+
+// UpdateVideo aplica update ao registro do vídeo com escrita condicional,
+// como UpdateJob, criando-o se ainda não existe (a primeira publicação).
+// Publicar, reverter e remover versões ao mesmo tempo não perdem a alteração
+// um do outro.
+func (s *Store) UpdateVideo(ctx context.Context, id string, update func(*Video) error) (*Video, error) {
+	return upsertRecord(ctx, s, videosPrefix+id+".json", func(video *Video) error {
+		if video.ID == "" {
+			video.ID = id
+		}
+		if err := update(video); err != nil {
+			return err
+		}
+		video.UpdatedAt = time.Now().UTC()
+		return nil
+	})
+}
+
+// DeleteVideo remove o registro do vídeo.
+func (s *Store) DeleteVideo(ctx context.Context, id string) error {
+	if err := s.S3Client.Delete(ctx, videosPrefix+id+".json"); err != nil {
+		return fmt.Errorf("erro ao remover vídeo %s: %v", id, err)
+	}
+	return nil
+}
+
+// ListVideos retorna todos os vídeos com versões publicadas.
+func (s *Store) ListVideos(ctx context.Context) ([]*Video, error) {
+	keys, err := s.S3Client.ListFiles(ctx, videosPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao listar vídeos: %v", err)
+	}
+
+	videos := make([]*Video, 0, len(keys))
+	for _, key := range keys {
+		if !strings.HasSuffix(key, ".json") {
+			continue
+		}
+		var video Video
+		if err := s.get(ctx, key, &video); err != nil {
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		videos = append(videos, &video)
+	}
+	return videos, nil
+}
@@ -0,0 +1,271 @@
+package catalog
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	webhooksPrefix   = "catalog/webhooks/"
+	deliveriesPrefix = "catalog/deliveries/"
+	// pendingPrefix indexa as entregas pendentes (um marcador vazio por ID),
+	// para que a varredura de novas tentativas não leia o log inteiro
+	pendingPrefix = "catalog/deliveries-pending/"
+)
+
+// Estados de uma entrega de webhook
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed" // esgotou as tentativas
+)
+
+// Subscription é uma inscrição de webhook: os eventos listados em Events (ou
+// todos, se vazio) são enviados por POST para URL, assinados com Secret.
+type Subscription struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events,omitempty"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Wants indica se a inscrição recebe o evento.
+func (s *Subscription) Wants(event string) bool {
+	if len(s.Events) == 0 {
+		return true
+	}
+	for _, e := range s.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// DeliveryAttempt registra uma tentativa de entrega.
+type DeliveryAttempt struct {
+	At         time.Time `json:"at"`
+	StatusCode int       `json:"statusCode,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs int64     `json:"durationMs"`
+}
+
+// Delivery é o envio de um evento para uma inscrição, com o corpo exato que é
+// assinado e o histórico das tentativas. Os registros formam o log de
+// entregas e permitem reenviar o mesmo corpo depois.
+type Delivery struct {
+	ID             string            `json:"id"`
+	SubscriptionID string            `json:"subscriptionId"`
+	EventID        string            `json:"eventId"`
+	Event          string            `json:"event"`
+	Payload        json.RawMessage   `json:"payload"`
+	State          string            `json:"state"`
+	Attempts       []DeliveryAttempt `json:"attempts,omitempty"`
+	NextAttemptAt  time.Time         `json:"nextAttemptAt,omitempty"`
+	ReplayOf       string            `json:"replayOf,omitempty"`
+	CreatedAt      time.Time         `json:"createdAt"`
+	UpdatedAt      time.Time         `json:"updatedAt"`
+}
+
+// GetSubscription retorna a inscrição com o ID informado, ou ErrNotFound.
+func (s *Store) GetSubscription(ctx context.Context, id string) (*Subscription, error) {
+	var sub Subscription
+	if err := s.get(ctx, webhooksPrefix+id+".json", &sub); err != nil {
+		return nil, err
+	}
+	return &sub, nil
+}
+
+// PutSubscription grava a inscrição.
+func (s *Store) PutSubscription(ctx context.Context, sub *Subscription) error {
+	return s.put(ctx, webhooksPrefix+sub.ID+".json", sub)
+}
+
+// DeleteSubscription remove a inscrição. O log de entregas é mantido até
+// expirar.
+func (s *Store) DeleteSubscription(ctx context.Context, id string) error {
+	if err := s.S3Client.Delete(ctx, webhooksPrefix+id+".json"); err != nil {
+		return fmt.Errorf("erro ao remover inscrição %s: %v", id, err)
+	}
+	return nil
+}
+
+// ListSubscriptions retorna todas as inscrições de webhook.
+func (s *Store) ListSubscriptions(ctx context.Context) ([]*Subscription, error) {
+	var subs []*Subscription
+	err := s.list(ctx, webhooksPrefix, func(key string) error {
+		var sub Subscription
+		if err := s.get(ctx, key, &sub); err != nil {
+			return err
+		}
+		subs = append(subs, &sub)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("erro ao listar inscrições: %w", err)
+	}
+	return subs, nil
+}
+
+// GetDelivery retorna a entrega com o ID informado, ou ErrNotFound.
+func (s *Store) GetDelivery(ctx context.Context, id string) (*Delivery, error) {
+	var delivery Delivery
+	if err := s.get(ctx, deliveriesPrefix+id+".json", &delivery); err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+// PutDelivery grava a entrega, atualizando UpdatedAt e o índice das
+// pendentes.
+func (s *Store) PutDelivery(ctx context.Context, delivery *Delivery) error {
+	delivery.UpdatedAt = time.Now().UTC()
+	if delivery.State == DeliveryPending {
+		// O índice vem antes: uma queda no meio nunca deixa uma entrega
+		// pendente fora da varredura
+		if err := s.put(ctx, pendingPrefix+delivery.ID, struct{}{}); err != nil {
+			return err
+		}
+	}
+	if err := s.put(ctx, deliveriesPrefix+delivery.ID+".json", delivery); err != nil {
+		return err
+	}
+	if delivery.State != DeliveryPending {
+		return s.unindexDelivery(ctx, delivery.ID)
+	}
+	return nil
+}
+
+// UpdateDelivery aplica update à entrega com escrita condicional, como
+// UpdateJob. É o que impede duas réplicas de assumirem a mesma tentativa.
+func (s *Store) UpdateDelivery(ctx context.Context, id string, update func(*Delivery) error) (*Delivery, error) {
+	delivery, err := updateRecord(ctx, s, deliveriesPrefix+id+".json", func(delivery *Delivery) error {
+		if err := update(delivery); err != nil {
+			return err
+		}
+		delivery.UpdatedAt = time.Now().UTC()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if delivery.State != DeliveryPending {
+		return delivery, s.unindexDelivery(ctx, id)
+	}
+	return delivery, nil
+}
+
+// DeleteDelivery remove o registro da entrega.
+func (s *Store) DeleteDelivery(ctx context.Context, id string) error {
+	if err := s.S3Client.Delete(ctx, deliveriesPrefix+id+".json"); err != nil {
+		return fmt.Errorf("erro ao remover entrega %s: %v", id, err)
+	}
+	return s.unindexDelivery(ctx, id)
+}
+
+func (s *Store) unindexDelivery(ctx context.Context, id string) error {
+	if err := s.S3Client.Delete(ctx, pendingPrefix+id); err != nil {
+		return fmt.Errorf("erro ao atualizar índice da entrega %s: %v", id, err)
+	}
+	return nil
+}
+
+// ListPendingDeliveries retorna as entregas pendentes pelo índice, sem ler
+// as encerradas. Marcadores de entregas removidas ou já encerradas (sobras
+// de uma queda entre as duas gravações) são apagados.
+func (s *Store) ListPendingDeliveries(ctx context.Context) ([]*Delivery, error) {
+	keys, err := s.S3Client.ListFiles(ctx, pendingPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao listar entregas pendentes: %v", err)
+	}
+	var deliveries []*Delivery
+	for _, key := range keys {
+		id := strings.TrimPrefix(key, pendingPrefix)
+		delivery, err := s.GetDelivery(ctx, id)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return nil, err
+		}
+		if err != nil || delivery.State != DeliveryPending {
+			if err := s.unindexDelivery(ctx, id); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, nil
+}
+
+// ExpireDeliveries apaga as entregas encerradas que não mudam desde antes de
+// before, pela data do objeto na listagem, sem ler os registros. Retorna
+// quantas foram apagadas.
+func (s *Store) ExpireDeliveries(ctx context.Context, before time.Time) (int, error) {
+	pending, err := s.S3Client.ListFiles(ctx, pendingPrefix)
+	if err != nil {
+		return 0, fmt.Errorf("erro ao listar entregas pendentes: %v", err)
+	}
+	isPending := make(map[string]bool, len(pending))
+	for _, key := range pending {
+		isPending[strings.TrimPrefix(key, pendingPrefix)] = true
+	}
+
+	objects, err := s.S3Client.ListObjects(ctx, deliveriesPrefix)
+	if err != nil {
+		return 0, fmt.Errorf("erro ao listar entregas: %v", err)
+	}
+	expired := 0
+	for _, object := range objects {
+		id := strings.TrimSuffix(strings.TrimPrefix(object.Key, deliveriesPrefix), ".json")
+		if !strings.HasSuffix(object.Key, ".json") || isPending[id] || !object.LastModified.Before(before) {
+			continue
+		}
+		if err := s.S3Client.Delete(ctx, object.Key); err != nil {
+			return expired, fmt.Errorf("erro ao remover entrega %s: %v", id, err)
+		}
+		expired++
+	}
+	return expired, nil
+}
+
+// ListDeliveries retorna as entregas da inscrição informada, ou de todas se
+// subscriptionID for vazio, na ordem dos IDs (a de criação).
+func (s *Store) ListDeliveries(ctx context.Context, subscriptionID string) ([]*Delivery, error) {
+	var deliveries []*Delivery
+	err := s.list(ctx, deliveriesPrefix, func(key string) error {
+		var delivery Delivery
+		if err := s.get(ctx, key, &delivery); err != nil {
+			return err
+		}
+		if subscriptionID == "" || delivery.SubscriptionID == subscriptionID {
+			deliveries = append(deliveries, &delivery)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("erro ao listar entregas: %w", err)
+	}
+	return deliveries, nil
+}
+
+// list chama fn para cada registro JSON sob o prefixo, ignorando os que
+// somem durante a listagem.
+func (s *Store) list(ctx context.Context, prefix string, fn func(key string) error) error {
+	keys, err := s.S3Client.ListFiles(ctx, prefix)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if !strings.HasSuffix(key, ".json") {
+			continue
+		}
+		if err := fn(key); err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+	}
+	return nil
+}
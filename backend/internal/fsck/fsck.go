@@ -0,0 +1,475 @@
+// Package fsck verifica a consistência entre os originais (videos/), as
+// saídas transcodificadas (videos-transcoded/), as miniaturas (thumbnails/) e
+// os jobs do catálogo, e opcionalmente corrige o que encontrar.
+package fsck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"streaming-platform/internal/catalog"
+	"streaming-platform/internal/hls"
+	"streaming-platform/internal/keystore"
+	"streaming-platform/internal/lease"
+	"streaming-platform/internal/metrics"
+	"streaming-platform/internal/poster"
+	"streaming-platform/internal/publish"
+	"streaming-platform/internal/services"
+	"streaming-platform/internal/storage"
+)
+
+const (
+	sourcesPrefix    = "videos/"
+	outputsPrefix    = publish.OutputsPrefix
+	thumbnailsPrefix = poster.ThumbnailsPrefix
+)
+
+// Tipos de inconsistência
+const (
+	// Original sem saídas e sem job pendente
+	KindUntranscoded = "untranscoded"
+	// Saídas sem master playlist
+	KindMissingMaster = "missing-master"
+	// Playlist que referencia um arquivo inexistente
+	KindMissingFile = "missing-file"
+	// Saídas de um vídeo cujo original não existe mais
+	KindOrphanOutput = "orphan-output"
+	// Miniatura de um vídeo cujo original não existe mais
+	KindOrphanThumbnail = "orphan-thumbnail"
+	// Job de um vídeo cujo original não existe mais
+	KindOrphanJob = "orphan-job"
+	// Saídas fora das versões registradas (publicação interrompida ou
+	// layout antigo)
+	KindStaleOutput = "stale-output"
+)
+
+// Kinds lista todos os tipos de inconsistência.
+var Kinds = []string{KindUntranscoded, KindMissingMaster, KindMissingFile, KindOrphanOutput, KindOrphanThumbnail, KindOrphanJob, KindStaleOutput}
+
+// Ações de correção
+const (
+	RepairRequeue = "requeue"
+	RepairDelete  = "delete"
+)
+
+// Issue é uma inconsistência encontrada, com a correção proposta.
+type Issue struct {
+	Kind     string `json:"kind"`
+	VideoID  string `json:"videoId"`
+	Key      string `json:"key"`
+	Detail   string `json:"detail,omitempty"`
+	Repair   string `json:"repair"`
+	Repaired bool   `json:"repaired"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Report é o resultado de uma verificação.
+type Report struct {
+	StartedAt  time.Time `json:"startedAt"`
+	Duration   string    `json:"duration"`
+	DryRun     bool      `json:"dryRun"`
+	Sources    int       `json:"sources"`
+	Outputs    int       `json:"outputs"`
+	Thumbnails int       `json:"thumbnails"`
+	Jobs       int       `json:"jobs"`
+	Issues     []Issue   `json:"issues"`
+}
+
+// Counts retorna a quantidade de inconsistências por tipo.
+func (r *Report) Counts() map[string]int {
+	counts := make(map[string]int, len(Kinds))
+	for _, kind := range Kinds {
+		counts[kind] = 0
+	}
+	for _, issue := range r.Issues {
+		counts[issue.Kind]++
+	}
+	return counts
+}
+
+// LeaseID identifica o lease que impede duas verificações simultâneas,
+// entre as réplicas e o streamctl. Não colide com os leases de jobs, cujos
+// IDs não têm barra.
+const LeaseID = "tasks/fsck"
+
+// Checker percorre o bucket e o catálogo procurando inconsistências. Ao
+// remover as saídas de um vídeo sem original, remove também as chaves dele
+// em Keys. Sobras (saídas fora das versões registradas, e saídas, miniaturas
+// e jobs sem original) só são tratadas depois de MinAge (o tempo máximo de
+// um job): uma publicação em andamento grava a versão antes de registrá-la, e
+// um envio feito durante a verificação não aparece na listagem dos originais.
+type Checker struct {
+	S3Client *storage.S3Client
+	Catalog  *catalog.Store
+	Keys     keystore.Store
+	Leases   *lease.Manager
+	MinAge   time.Duration
+}
+
+func NewChecker(s3Client *storage.S3Client, store *catalog.Store, keys keystore.Store, leases *lease.Manager, minAge time.Duration) *Checker {
+	return &Checker{
+		S3Client: s3Client,
+		Catalog:  store,
+		Keys:     keys,
+		Leases:   leases,
+		MinAge:   minAge,
+	}
+}
+
+// Run verifica o bucket. Com repair falso nada é alterado (dry-run): o
+// relatório apenas descreve o que seria corrigido. Só uma verificação roda
+// por vez: se outra detém o lease, retorna lease.ErrHeld.
+func (c *Checker) Run(ctx context.Context, repair bool) (*Report, error) {
+	l, err := c.Leases.Acquire(ctx, LeaseID)
+	if err != nil {
+		return nil, err
+	}
+	defer l.Release(context.WithoutCancel(ctx))
+	ctx = l.Keep(ctx)
+
+	report := &Report{StartedAt: time.Now().UTC(), DryRun: !repair}
+
+	sources, _, err := c.listIDs(ctx, sourcesPrefix, func(rest string) string {
+		if strings.Contains(rest, "/") {
+			return ""
+		}
+		return rest
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Saídas agrupadas por vídeo: videos-transcoded/{id}/...
+	outputObjects, err := c.S3Client.ListObjects(ctx, outputsPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao listar %s: %v", outputsPrefix, err)
+	}
+	outputs := map[string]map[string]bool{}
+	modified := make(map[string]time.Time, len(outputObjects))
+	outputsModified := map[string]time.Time{}
+	for _, object := range outputObjects {
+		id, _, ok := strings.Cut(strings.TrimPrefix(object.Key, outputsPrefix), "/")
+		if !ok || id == "" {
+			continue
+		}
+		if outputs[id] == nil {
+			outputs[id] = map[string]bool{}
+		}
+		outputs[id][object.Key] = true
+		modified[object.Key] = object.LastModified
+		if object.LastModified.After(outputsModified[id]) {
+			outputsModified[id] = object.LastModified
+		}
+	}
+
+	// A capa fica em thumbnails/{id}.jpg e os candidatos em thumbnails/{id}/
+	thumbnails, thumbnailsModified, err := c.listIDs(ctx, thumbnailsPrefix, func(rest string) string {
+		if id, _, ok := strings.Cut(rest, "/"); ok {
+			return id
+		}
+		return strings.TrimSuffix(rest, path.Ext(rest))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	jobList, err := c.Catalog.ListJobs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	jobs := make(map[string]*catalog.Job, len(jobList))
+	for _, job := range jobList {
+		jobs[job.ID] = job
+	}
+
+	videoList, err := c.Catalog.ListVideos(ctx)
+	if err != nil {
+		return nil, err
+	}
+	videos := make(map[string]*catalog.Video, len(videoList))
+	for _, video := range videoList {
+		videos[video.ID] = video
+	}
+
+	report.Sources, report.Outputs, report.Thumbnails, report.Jobs = len(sources), len(outputs), len(thumbnails), len(jobs)
+
+	add := func(issue Issue) {
+		report.Issues = append(report.Issues, issue)
+	}
+
+	for _, id := range sortedKeys(sources) {
+		job := jobs[id]
+		// Vídeos na fila ou em processamento ainda não têm saídas completas, e
+		// os da dead-letter aguardam triagem: não voltam à fila pelo fsck
+		if job != nil && (job.State == catalog.JobPending || job.State == catalog.JobProcessing ||
+			job.State == catalog.JobDeadLetter || job.State == catalog.JobDismissed) {
+			continue
+		}
+
+		files, ok := outputs[id]
+		if !ok {
+			add(Issue{Kind: KindUntranscoded, VideoID: id, Key: sources[id], Repair: RepairRequeue})
+			continue
+		}
+
+		// Vídeos sem registro no catálogo ainda estão no layout sem versões
+		livePrefix := publish.OutputPrefix(id)
+		kept := map[string]bool{}
+		if video := videos[id]; video != nil {
+			livePrefix = publish.VersionPrefix(id, video.LiveVersion)
+			for _, version := range video.Versions {
+				kept[version.Dir()] = true
+			}
+		}
+
+		master := livePrefix + services.MasterPlaylistName
+		if !files[master] {
+			add(Issue{Kind: KindMissingMaster, VideoID: id, Key: master, Repair: RepairRequeue})
+			continue
+		}
+
+		live := map[string]bool{}
+		stale := map[string]int{}
+		recent := map[string]bool{}
+		for key := range files {
+			if strings.HasPrefix(key, livePrefix) {
+				live[key] = true
+			}
+			if len(kept) > 0 {
+				entry, _, _ := strings.Cut(strings.TrimPrefix(key, publish.OutputPrefix(id)), "/")
+				if !kept[entry] {
+					stale[entry]++
+					if time.Since(modified[key]) < c.MinAge {
+						recent[entry] = true
+					}
+				}
+			}
+		}
+
+		missing, err := c.missingReferences(ctx, live)
+		if err != nil {
+			return nil, err
+		}
+		if len(missing) > 0 {
+			add(Issue{
+				Kind:    KindMissingFile,
+				VideoID: id,
+				Key:     missing[0],
+				Detail:  fmt.Sprintf("%d arquivo(s) referenciado(s) não existem", len(missing)),
+				Repair:  RepairRequeue,
+			})
+		}
+
+		for _, entry := range sortedKeys(stale) {
+			// Pode ser uma versão que outra réplica ainda está publicando
+			if recent[entry] {
+				continue
+			}
+			add(Issue{
+				Kind:    KindStaleOutput,
+				VideoID: id,
+				Key:     publish.OutputPrefix(id) + entry,
+				Detail:  fmt.Sprintf("%d arquivo(s)", stale[entry]),
+				Repair:  RepairDelete,
+			})
+		}
+	}
+
+	// Sem original há pelo menos MinAge: um vídeo enviado depois da listagem
+	// dos originais ainda pode estar gravando as saídas, a capa ou o job
+	for _, id := range sortedKeys(outputs) {
+		if _, ok := sources[id]; !ok && time.Since(outputsModified[id]) >= c.MinAge {
+			add(Issue{Kind: KindOrphanOutput, VideoID: id, Key: outputsPrefix + id + "/", Detail: fmt.Sprintf("%d arquivo(s)", len(outputs[id])), Repair: RepairDelete})
+		}
+	}
+	for _, id := range sortedKeys(thumbnails) {
+		if _, ok := sources[id]; !ok && time.Since(thumbnailsModified[id]) >= c.MinAge {
+			add(Issue{Kind: KindOrphanThumbnail, VideoID: id, Key: thumbnails[id], Repair: RepairDelete})
+		}
+	}
+	for _, id := range sortedKeys(jobs) {
+		if _, ok := sources[id]; !ok && jobs[id].State != catalog.JobProcessing && time.Since(jobs[id].UpdatedAt) >= c.MinAge {
+			add(Issue{Kind: KindOrphanJob, VideoID: id, Key: id, Detail: "estado " + jobs[id].State, Repair: RepairDelete})
+		}
+	}
+
+	if repair {
+		requeued := false
+		for i := range report.Issues {
+			issue := &report.Issues[i]
+			if err := c.repair(ctx, issue, jobs[issue.VideoID], sources[issue.VideoID]); err != nil {
+				issue.Error = err.Error()
+				slog.WarnContext(ctx, "erro ao corrigir inconsistência", "kind", issue.Kind, "video_id", issue.VideoID, "error", err)
+				continue
+			}
+			issue.Repaired = true
+			requeued = requeued || issue.Repair == RepairRequeue
+		}
+		if requeued {
+			if err := c.Catalog.TouchQueue(ctx, "fsck"); err != nil {
+				slog.WarnContext(ctx, "erro ao avisar os workers", "error", err)
+			}
+		}
+	}
+
+	report.Duration = time.Since(report.StartedAt).Round(time.Millisecond).String()
+	for kind, count := range report.Counts() {
+		metrics.FsckIssues.WithLabelValues(kind).Set(float64(count))
+	}
+	metrics.FsckLastRun.SetToCurrentTime()
+	return report, nil
+}
+
+// repair aplica a correção proposta para a inconsistência.
+func (c *Checker) repair(ctx context.Context, issue *Issue, job *catalog.Job, sourceKey string) error {
+	switch issue.Kind {
+	case KindUntranscoded, KindMissingMaster, KindMissingFile:
+		// Devolver à fila: o loop de processamento pega jobs que não tiveram sucesso
+		if job == nil {
+			return c.Catalog.PutJob(ctx, catalog.NewJob(sourceKey))
+		}
+		_, err := c.Catalog.UpdateJob(ctx, job.ID, func(current *catalog.Job) error {
+			// Um worker ou o upload pode ter pego o job desde a listagem
+			if current.State == catalog.JobPending || current.State == catalog.JobProcessing {
+				return fmt.Errorf("job em estado %s, correção desnecessária", current.State)
+			}
+			current.State = catalog.JobPending
+			current.Attempts = 0
+			current.Error = ""
+			return nil
+		})
+		return err
+	case KindOrphanOutput, KindOrphanThumbnail, KindOrphanJob:
+		// O original pode ter sido enviado depois da listagem
+		if err := c.ensureNoSource(ctx, issue.VideoID); err != nil {
+			return err
+		}
+		return c.removeOrphan(ctx, issue)
+	case KindStaleOutput:
+		// O vídeo pode ter voltado ao processamento desde a listagem
+		current, err := c.Catalog.GetJob(ctx, issue.VideoID)
+		if err != nil && !errors.Is(err, catalog.ErrNotFound) {
+			return err
+		}
+		if current != nil && current.State == catalog.JobProcessing {
+			return fmt.Errorf("vídeo em processamento, correção adiada")
+		}
+		// Um diretório (versão ou qualidade do layout antigo) ou um arquivo solto
+		if _, err := c.S3Client.DeletePrefix(ctx, issue.Key+"/"); err != nil {
+			return err
+		}
+		return c.S3Client.Delete(ctx, issue.Key)
+	}
+	return fmt.Errorf("correção desconhecida para %s", issue.Kind)
+}
+
+// ensureNoSource confirma que o vídeo continua sem original antes de remover
+// o que sobrou dele.
+func (c *Checker) ensureNoSource(ctx context.Context, videoID string) error {
+	_, err := c.S3Client.StatObject(ctx, sourcesPrefix+videoID, storage.ObjectOptions{})
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("erro ao verificar o original: %v", err)
+	}
+	return fmt.Errorf("original enviado durante a verificação, correção cancelada")
+}
+
+// removeOrphan remove as saídas, a miniatura ou o job de um vídeo sem original.
+func (c *Checker) removeOrphan(ctx context.Context, issue *Issue) error {
+	switch issue.Kind {
+	case KindOrphanOutput:
+		if _, err := c.S3Client.DeletePrefix(ctx, issue.Key); err != nil {
+			return err
+		}
+		if err := c.Keys.DeleteVideo(ctx, issue.VideoID); err != nil {
+			return err
+		}
+		return c.Catalog.DeleteVideo(ctx, issue.VideoID)
+	case KindOrphanThumbnail:
+		if _, err := c.S3Client.DeletePrefix(ctx, poster.Prefix(issue.VideoID)); err != nil {
+			return err
+		}
+		if err := c.S3Client.Delete(ctx, poster.Key(issue.VideoID)); err != nil {
+			return err
+		}
+		return c.Catalog.DeletePoster(ctx, issue.VideoID)
+	}
+	return c.Catalog.DeleteJob(ctx, issue.VideoID)
+}
+
+// missingReferences lê as playlists de um vídeo e retorna os arquivos
+// referenciados que não existem no bucket.
+func (c *Checker) missingReferences(ctx context.Context, files map[string]bool) ([]string, error) {
+	var missing []string
+	for _, key := range sortedKeys(files) {
+		if !hls.IsPlaylist(key) {
+			continue
+		}
+
+		data, err := c.S3Client.DownloadFile(ctx, key)
+		if errors.Is(err, storage.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		uris, err := hls.URIs(data)
+		if err != nil {
+			return nil, fmt.Errorf("playlist inválida %s: %v", key, err)
+		}
+
+		for _, uri := range uris {
+			if strings.Contains(uri, "://") || strings.HasPrefix(uri, services.KeyURIPrefix) {
+				continue
+			}
+			uri, _, _ = strings.Cut(uri, "?")
+			ref := path.Join(path.Dir(key), uri)
+			if !files[ref] {
+				missing = append(missing, ref)
+			}
+		}
+	}
+	return missing, nil
+}
+
+// listIDs lista as chaves de um prefixo indexadas pelo ID do vídeo, com a
+// modificação mais recente de cada vídeo; toID recebe a chave sem o prefixo e
+// retorna "" para ignorá-la.
+func (c *Checker) listIDs(ctx context.Context, prefix string, toID func(rest string) string) (map[string]string, map[string]time.Time, error) {
+	objects, err := c.S3Client.ListObjects(ctx, prefix)
+	if err != nil {
+		return nil, nil, fmt.Errorf("erro ao listar %s: %v", prefix, err)
+	}
+	ids := make(map[string]string, len(objects))
+	modified := make(map[string]time.Time, len(objects))
+	for _, object := range objects {
+		rest := strings.TrimPrefix(object.Key, prefix)
+		if rest == "" || strings.HasSuffix(rest, "/") {
+			continue
+		}
+		if id := toID(rest); id != "" {
+			ids[id] = object.Key
+			if object.LastModified.After(modified[id]) {
+				modified[id] = object.LastModified
+			}
+		}
+	}
+	return ids, modified, nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"streaming-platform/internal/health"
+)
+
+// HealthHandler expõe as sondas de liveness (/healthz) e readiness (/readyz).
+type HealthHandler struct {
+	Checker   *health.Checker
+	StartedAt time.Time
+}
+
+func NewHealthHandler(checker *health.Checker) *HealthHandler {
+	return &HealthHandler{
+		Checker:   checker,
+		StartedAt: time.Now(),
+	}
+}
+
+// HandleLiveness indica apenas que o processo está de pé e respondendo.
+func (h *HealthHandler) HandleLiveness(w http.ResponseWriter, r *http.Request) {
+	writeHealthJSON(w, http.StatusOK, map[string]interface{}{
+		"status":        health.StatusOK,
+		"uptimeSeconds": int64(time.Since(h.StartedAt).Seconds()),
+	})
+}
+
+// HandleReadiness verifica as dependências e responde 503 se alguma falhar,
+// para que o orquestrador pare de enviar tráfego para a instância.
+func (h *HealthHandler) HandleReadiness(w http.ResponseWriter, r *http.Request) {
+	report := h.Checker.Run(r.Context())
+
+	status := http.StatusOK
+	if report.Status == health.StatusFail {
+		status = http.StatusServiceUnavailable
+	}
+	writeHealthJSON(w, status, report)
+}
+
+func writeHealthJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"streaming-platform/internal/keystore"
+	"streaming-platform/internal/services"
+	"streaming-platform/internal/signing"
+
+	"github.com/gorilla/mux"
+)
+
+// KeyHandler é o servidor de chaves referenciado pelas tags EXT-X-KEY, em
+// /keys/{videoKey}/{keyID}. Cada chave só é entregue com um token emitido
+// junto com a playlist do mesmo vídeo.
+type KeyHandler struct {
+	Store  keystore.Store
+	Signer *signing.Signer
+}
+
+func NewKeyHandler(store keystore.Store, signer *signing.Signer) *KeyHandler {
+	return &KeyHandler{
+		Store:  store,
+		Signer: signer,
+	}
+}
+
+// keyResource é o recurso assinado no token de acesso a uma chave: o token
+// vale só para a chave daquele vídeo.
+func keyResource(videoID, keyID string) string {
+	return "key:" + videoID + "/" + keyID
+}
+
+// keyURL retorna o caminho assinado de uma chave do vídeo, com a expiração
+// informada.
+func keyURL(signer *signing.Signer, videoID, keyID string, expires time.Time) string {
+	return services.KeyURIPrefix + url.PathEscape(videoID) + "/" + keyID + "?" + signer.SignUntil(keyResource(videoID, keyID), expires).Encode()
+}
+
+func (h *KeyHandler) HandleKey(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	videoID, keyID := vars["videoKey"], vars["keyID"]
+	if err := h.Signer.Verify(keyResource(videoID, keyID), r.URL.Query()); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	key, err := h.Store.Get(r.Context(), videoID, keyID)
+	if errors.Is(err, keystore.ErrKeyNotFound) {
+		http.Error(w, "Chave não encontrada", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "erro ao buscar chave", "video_id", videoID, "key_id", keyID, "error", err)
+		http.Error(w, "Erro ao buscar chave", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.Write(key.Value)
+}
@@ -1,11 +1,17 @@
 package handlers
 
 import (
-	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"path"
+	"strings"
 
+	"streaming-platform/internal/catalog"
+	"streaming-platform/internal/publish"
+	"streaming-platform/internal/services"
+	"streaming-platform/internal/signing"
 	"streaming-platform/internal/storage"
 
 	"github.com/gorilla/mux"
@@ -14,7 +20,7 @@ import (
 // ListVideosHandler retorna a lista de todos os vídeos disponíveis no bucket
 func ListVideosHandler(s3Client *storage.S3Client) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		ctx := context.Background()
+		ctx := r.Context()
 		prefix := "videos-transcoded/"
 
 		// Listar diretórios (IDs dos vídeos)
@@ -36,14 +42,21 @@ func ListVideosHandler(s3Client *storage.S3Client) http.HandlerFunc {
 }
 
 // ListVideoResolutionsHandler retorna as resoluções disponíveis para um vídeo específico
-func ListVideoResolutionsHandler(s3Client *storage.S3Client) http.HandlerFunc {
+func ListVideoResolutionsHandler(s3Client *storage.S3Client, signer *signing.Signer, store *catalog.Store) http.HandlerFunc {
     return func(w http.ResponseWriter, r *http.Request) {
-        ctx := context.Background()
+        ctx := r.Context()
         vars := mux.Vars(r)
         videoID := vars["videoKey"]
 
+        // As resoluções são as da versão no ar
+        livePrefix, err := publish.LivePrefix(ctx, store, videoID)
+        if err != nil {
+            http.Error(w, "Erro ao obter vídeo: "+err.Error(), http.StatusInternalServerError)
+            return
+        }
+
         // Listar resoluções disponíveis
-        resolutions, err := s3Client.ListResolutions(ctx, videoID)
+        resolutions, err := s3Client.ListDirectories(ctx, livePrefix)
         if err != nil {
             http.Error(w, "Erro ao listar resoluções: "+err.Error(), http.StatusInternalServerError)
             return
@@ -58,21 +71,28 @@ func ListVideoResolutionsHandler(s3Client *storage.S3Client) http.HandlerFunc {
         result := make(map[string][]string)
 
         for _, resolution := range resolutions {
+            // As prévias de navegação não são uma resolução
+            if resolution == services.TrickplayDir {
+                continue
+            }
+
             // Listar os arquivos para a resolução atual
-            resolutionPrefix := fmt.Sprintf("videos-transcoded/%s/%s/", videoID, resolution)
+            resolutionPrefix := livePrefix + resolution + "/"
             files, err := s3Client.ListFiles(ctx, resolutionPrefix)
             if err != nil {
                 http.Error(w, fmt.Sprintf("Erro ao listar arquivos para a resolução %s: %v", resolution, err), http.StatusInternalServerError)
                 return
             }
 
-            // Gerar URLs públicas para os arquivos
-            var fileURLs []string
+            // Os arquivos saem pela origem /stream, com o token do vídeo: as
+            // URIs de segmentos e chaves dentro das playlists são reescritas
+            // lá, e o bucket não precisa ser público. A playlist vem primeiro
+            fileURLs := []string{}
             for _, file := range files {
-                fileURL, err := s3Client.GetFileURL(file)  // Gerar URL para cada arquivo
-                if err != nil {
-                    http.Error(w, "Erro ao gerar URL do arquivo: "+err.Error(), http.StatusInternalServerError)
-                    return
+                fileURL := absoluteURL(r, streamURL(signer, videoID, strings.TrimPrefix(file, publish.OutputPrefix(videoID))))
+                if path.Base(file) == services.MediaPlaylistName {
+                    fileURLs = append([]string{fileURL}, fileURLs...)
+                    continue
                 }
                 fileURLs = append(fileURLs, fileURL)
             }
@@ -81,52 +101,49 @@ func ListVideoResolutionsHandler(s3Client *storage.S3Client) http.HandlerFunc {
             result[resolution] = fileURLs
         }
 
-        // Retornar a resposta em JSON
-        w.Header().Set("Content-Type", "application/json")
-        json.NewEncoder(w).Encode(map[string]interface{}{
+        response := map[string]interface{}{
             "videoID":     videoID,
+            "master":      absoluteURL(r, masterPlaylistURL(signer, videoID)),
             "resolutions": result,
-        })
-    }
-}
-
-
-func GetVideoByResolutionHandler(s3Client *storage.S3Client) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		ctx := context.Background()
-		vars := mux.Vars(r)
-
-		// Extrair os parâmetros da URL
-		videoID := vars["videoKey"]
-		chosenResolution := vars["resolution"]
-
-		// Validar parâmetros
-		if videoID == "" || chosenResolution == "" {
-			http.Error(w, "Parâmetros 'videoKey' e 'resolution' são obrigatórios. Exemplo: /videos/{videoKey}/{resolution}", http.StatusBadRequest)
-			return
-		}
+        }
 
-		// Construir o caminho completo do arquivo `video.m3u8`
-		filePath := "videos-transcoded/" + videoID + "/" + chosenResolution + "/video.m3u8"
+        // Índice WebVTT das prévias de navegação, servido por /stream com o mesmo token
+        live, err := publish.LiveVersion(ctx, store, videoID)
+        if err != nil {
+            http.Error(w, "Erro ao obter vídeo: "+err.Error(), http.StatusInternalServerError)
+            return
+        }
+        if live != nil && live.Trickplay != "" {
+            response["trickplay"] = absoluteURL(r, streamURL(signer, videoID, live.Dir()+"/"+live.Trickplay))
+        }
 
-		// Usar a função DownloadFile para obter o conteúdo do arquivo
-		videoFile, err := s3Client.DownloadFile(ctx, filePath)
-		if err != nil {
-			http.Error(w, "Erro ao obter o arquivo de vídeo: "+err.Error(), http.StatusInternalServerError)
-			return
-		}
+        // Capa em várias larguras, pronta para srcset
+        poster, err := store.GetPoster(ctx, videoID)
+        if err != nil && !errors.Is(err, catalog.ErrNotFound) {
+            http.Error(w, "Erro ao obter capa: "+err.Error(), http.StatusInternalServerError)
+            return
+        }
+        if poster != nil {
+            response["thumbnail"] = thumbnailSources(poster)
+        }
 
-		// Configurar cabeçalhos para resposta com o arquivo
-		w.Header().Set("Content-Type", "application/vnd.apple.mpegurl") // Tipo MIME para HLS
-		w.Header().Set("Content-Disposition", "inline; filename=video.m3u8") // Exibir no navegador
+        // Prévia animada para a grade, por tipo (video/mp4 e image/webp)
+        if poster != nil && len(poster.Previews) > 0 {
+            previews := make(map[string]string)
+            for _, key := range poster.Previews {
+                previewURL, err := s3Client.GetSignedURL(key, signer.TTL())
+                if err != nil {
+                    http.Error(w, "Erro ao gerar URL da prévia: "+err.Error(), http.StatusInternalServerError)
+                    return
+                }
+                previews[storage.ContentType(key)] = previewURL
+            }
+            response["preview"] = previews
+        }
 
-		// Enviar o conteúdo do arquivo como resposta
-		w.WriteHeader(http.StatusOK)
-		_, err = w.Write(videoFile)
-		if err != nil {
-			http.Error(w, "Erro ao enviar o arquivo de vídeo: "+err.Error(), http.StatusInternalServerError)
-			return
-		}
-	}
+        // Retornar a resposta em JSON
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(response)
+    }
 }
 
@@ -0,0 +1,327 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"streaming-platform/internal/catalog"
+	"streaming-platform/internal/hls"
+	"streaming-platform/internal/publish"
+	"streaming-platform/internal/services"
+	"streaming-platform/internal/signing"
+	"streaming-platform/internal/storage"
+
+	"github.com/gorilla/mux"
+)
+
+// Os segmentos são servidos só com token: um cache compartilhado entregaria o
+// arquivo depois de o token expirar. Por isso o cache é privado e dura no
+// máximo até a expiração do token da URL.
+func segmentCacheControl(query url.Values) string {
+	maxAge := int64(0)
+	if expires, ok := signing.Expiry(query); ok {
+		maxAge = max(0, int64(time.Until(expires).Seconds()))
+	}
+	return "private, max-age=" + strconv.FormatInt(maxAge, 10)
+}
+
+// As playlists carregam tokens individuais e não podem ser compartilhadas.
+const playlistCacheControl = "private, max-age=5"
+
+// PlaybackHandler é a origem HLS servida pelo próprio backend em
+// /stream/{videoKey}/..., pensada para ficar atrás de uma CDN em vez de expor
+// o bucket. Todo acesso exige um token assinado para o vídeo; as playlists são
+// reescritas para que segmentos e chaves carreguem o token recebido.
+//
+// O master em /stream/{id}/master.m3u8 é sempre o da versão no ar, e suas
+// URIs apontam para dentro da versão (/stream/{id}/v{n}/...). Assim quem
+// começou a assistir continua na mesma versão mesmo que outra seja publicada.
+type PlaybackHandler struct {
+	S3Client *storage.S3Client
+	Signer   *signing.Signer
+	Catalog  *catalog.Store
+
+	versions versionCache
+}
+
+func NewPlaybackHandler(s3Client *storage.S3Client, signer *signing.Signer, store *catalog.Store) *PlaybackHandler {
+	return &PlaybackHandler{
+		S3Client: s3Client,
+		Signer:   signer,
+		Catalog:  store,
+		versions: versionCache{entries: map[string]versionEntry{}},
+	}
+}
+
+// versionCacheTTL é quanto tempo o prefixo da versão no ar fica em memória;
+// igual ao cache das playlists, para que uma publicação apareça logo.
+const versionCacheTTL = 5 * time.Second
+
+// versionCache guarda o prefixo da versão no ar de cada vídeo, evitando ler
+// o catálogo a cada requisição do master.
+type versionCache struct {
+	mu      sync.Mutex
+	entries map[string]versionEntry
+}
+
+type versionEntry struct {
+	prefix  string
+	expires time.Time
+}
+
+// livePrefix retorna o prefixo da versão no ar do vídeo.
+func (h *PlaybackHandler) livePrefix(ctx context.Context, videoID string) (string, error) {
+	h.versions.mu.Lock()
+	entry, ok := h.versions.entries[videoID]
+	h.versions.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.prefix, nil
+	}
+
+	prefix, err := publish.LivePrefix(ctx, h.Catalog, videoID)
+	if err != nil {
+		return "", err
+	}
+
+	h.versions.mu.Lock()
+	h.versions.entries[videoID] = versionEntry{prefix: prefix, expires: time.Now().Add(versionCacheTTL)}
+	h.versions.mu.Unlock()
+	return prefix, nil
+}
+
+// masterPlaylistURL retorna o caminho assinado do master playlist de um vídeo.
+func masterPlaylistURL(signer *signing.Signer, videoID string) string {
+	return fmt.Sprintf("/stream/%s/master.m3u8?%s", url.PathEscape(videoID), signer.Sign(videoID).Encode())
+}
+
+// absoluteURL completa um caminho da API com o esquema e o host da
+// requisição. Clientes em outra origem, como o frontend, resolveriam um
+// caminho relativo contra a própria origem.
+func absoluteURL(r *http.Request, path string) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + path
+}
+
+// streamURL retorna o caminho assinado de um arquivo das saídas do vídeo.
+func streamURL(signer *signing.Signer, videoID, file string) string {
+	return fmt.Sprintf("/stream/%s/%s?%s", url.PathEscape(videoID), file, signer.Sign(videoID).Encode())
+}
+
+// HandleStream serve master, playlists de mídia e segmentos de um vídeo.
+func (h *PlaybackHandler) HandleStream(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	videoID := vars["videoKey"]
+	filePath := path.Clean("/" + vars["path"])
+
+	if err := h.Signer.Verify(videoID, r.URL.Query()); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	key := publish.OutputPrefix(videoID) + strings.TrimPrefix(filePath, "/")
+	base := ""
+	if filePath == "/"+services.MasterPlaylistName {
+		prefix, err := h.livePrefix(r.Context(), videoID)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "erro ao obter versão no ar", "video_id", videoID, "error", err)
+			http.Error(w, "Erro ao obter vídeo", http.StatusBadGateway)
+			return
+		}
+		key = prefix + services.MasterPlaylistName
+		base = strings.TrimPrefix(prefix, publish.OutputPrefix(videoID))
+	}
+	if hls.IsPlaylist(key) || path.Base(key) == services.TrickplayIndex {
+		h.servePlaylist(w, r, videoID, key, base)
+		return
+	}
+	h.serveSegment(w, r, key)
+}
+
+// servePlaylist serve a playlist (ou o índice WebVTT das prévias) guardada em
+// key. As URIs relativas recebem base na frente: o master da versão no ar é
+// pedido na raiz do vídeo, mas seus arquivos ficam dentro da versão.
+func (h *PlaybackHandler) servePlaylist(w http.ResponseWriter, r *http.Request, videoID, key, base string) {
+	ctx := r.Context()
+
+	object, err := h.S3Client.GetObject(ctx, key, storage.ObjectOptions{})
+	if err != nil {
+		writeStorageError(w, r, key, err)
+		return
+	}
+	defer object.Body.Close()
+
+	data, err := io.ReadAll(object.Body)
+	if err != nil {
+		http.Error(w, "Erro ao obter playlist: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	query := r.URL.Query()
+	expires, _ := signing.Expiry(query)
+	token := url.Values{
+		"expires": {query.Get("expires")},
+		"token":   {query.Get("token")},
+	}.Encode()
+
+	dir := path.Dir(key)
+	prefix := publish.OutputPrefix(videoID)
+	rewriteURIs := hls.RewriteURIs
+	if path.Base(key) == services.TrickplayIndex {
+		rewriteURIs = services.RewriteVTTImages
+	}
+	rewritten, err := rewriteURIs(data, func(uri string) (string, error) {
+		if strings.Contains(uri, "://") {
+			return uri, nil
+		}
+		if strings.HasPrefix(uri, services.KeyURIPrefix) {
+			// Chaves de cifragem recebem um token próprio, do vídeo, com a
+			// mesma expiração
+			keyID := strings.TrimPrefix(uri, services.KeyURIPrefix)
+			return keyURL(h.Signer, videoID, keyID, expires), nil
+		}
+		if !strings.HasPrefix(path.Join(dir, uri), prefix) {
+			return "", fmt.Errorf("URI fora do diretório do vídeo: %s", uri)
+		}
+		// URIs relativas continuam relativas e passam pela origem com o mesmo token
+		return base + uri + "?" + token, nil
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "erro ao reescrever playlist", "key", key, "error", err)
+		http.Error(w, "Erro ao assinar playlist", http.StatusInternalServerError)
+		return
+	}
+
+	// O ETag é fraco porque o corpo varia com o token, mas a mídia é a mesma
+	if object.ETag != "" {
+		w.Header().Set("ETag", "W/"+object.ETag)
+	}
+	w.Header().Set("Content-Type", storage.ContentType(key))
+	w.Header().Set("Cache-Control", playlistCacheControl)
+	http.ServeContent(w, r, path.Base(key), object.LastModified, bytes.NewReader(rewritten))
+}
+
+func (h *PlaybackHandler) serveSegment(w http.ResponseWriter, r *http.Request, key string) {
+	ctx := r.Context()
+
+	opts := storage.ObjectOptions{
+		Range:       r.Header.Get("Range"),
+		IfNoneMatch: r.Header.Get("If-None-Match"),
+	}
+	if since, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && opts.IfNoneMatch == "" {
+		opts.IfModifiedSince = since
+	}
+
+	// If-Range: o intervalo só vale se o objeto ainda for o mesmo
+	if ifRange := r.Header.Get("If-Range"); ifRange != "" && opts.Range != "" {
+		stat, err := h.S3Client.StatObject(ctx, key, storage.ObjectOptions{})
+		if err != nil {
+			writeStorageError(w, r, key, err)
+			return
+		}
+		if ifRange != stat.ETag && ifRange != stat.LastModified.UTC().Format(http.TimeFormat) {
+			opts.Range = ""
+		}
+	}
+
+	var object *storage.Object
+	var err error
+	if r.Method == http.MethodHead {
+		object, err = h.S3Client.StatObject(ctx, key, opts)
+	} else {
+		object, err = h.S3Client.GetObject(ctx, key, opts)
+	}
+	header := w.Header()
+	if err != nil {
+		if errors.Is(err, storage.ErrNotModified) {
+			// O 304 também leva os validadores, para o cache renovar a entrada
+			if object, statErr := h.notModified(ctx, key, opts.IfNoneMatch); statErr == nil {
+				setValidators(header, object)
+			}
+			header.Set("Cache-Control", segmentCacheControl(r.URL.Query()))
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		writeStorageError(w, r, key, err)
+		return
+	}
+	if object.Body != nil {
+		defer object.Body.Close()
+	}
+
+	header.Set("Content-Type", contentType(key, object.ContentType))
+	header.Set("Accept-Ranges", "bytes")
+	header.Set("Cache-Control", segmentCacheControl(r.URL.Query()))
+	header.Set("Content-Length", strconv.FormatInt(object.ContentLength, 10))
+	setValidators(header, object)
+
+	status := http.StatusOK
+	if object.ContentRange != "" {
+		header.Set("Content-Range", object.ContentRange)
+		status = http.StatusPartialContent
+	}
+	w.WriteHeader(status)
+
+	if object.Body != nil {
+		if _, err := io.Copy(w, object.Body); err != nil {
+			slog.WarnContext(r.Context(), "envio interrompido", "key", key, "error", err)
+		}
+	}
+}
+
+// notModified retorna os validadores de um objeto que não mudou. Se o
+// cliente mandou um único ETag, é ele mesmo; senão o objeto é consultado.
+func (h *PlaybackHandler) notModified(ctx context.Context, key, ifNoneMatch string) (*storage.Object, error) {
+	if ifNoneMatch != "" && ifNoneMatch != "*" && !strings.Contains(ifNoneMatch, ",") {
+		return &storage.Object{ETag: ifNoneMatch}, nil
+	}
+	return h.S3Client.StatObject(ctx, key, storage.ObjectOptions{})
+}
+
+// setValidators define ETag e Last-Modified a partir do objeto.
+func setValidators(header http.Header, object *storage.Object) {
+	if object.ETag != "" {
+		header.Set("ETag", object.ETag)
+	}
+	if !object.LastModified.IsZero() {
+		header.Set("Last-Modified", object.LastModified.UTC().Format(http.TimeFormat))
+	}
+}
+
+func contentType(key, stored string) string {
+	if t := storage.ContentType(key); t != "" {
+		return t
+	}
+	if stored != "" {
+		return stored
+	}
+	return "application/octet-stream"
+}
+
+// writeStorageError traduz os erros do armazenamento em respostas HTTP.
+func writeStorageError(w http.ResponseWriter, r *http.Request, key string, err error) {
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		http.Error(w, "Arquivo não encontrado", http.StatusNotFound)
+	case errors.Is(err, storage.ErrRangeNotSatisfiable):
+		http.Error(w, "Intervalo inválido", http.StatusRequestedRangeNotSatisfiable)
+	case errors.Is(err, storage.ErrPreconditionFailed):
+		http.Error(w, "Pré-condição falhou", http.StatusPreconditionFailed)
+	default:
+		slog.ErrorContext(r.Context(), "erro ao obter arquivo", "key", key, "error", err)
+		http.Error(w, "Erro ao obter arquivo", http.StatusBadGateway)
+	}
+}
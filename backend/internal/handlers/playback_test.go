@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"streaming-platform/internal/catalog"
+	"streaming-platform/internal/signing"
+	"streaming-platform/internal/storage/storagetest"
+
+	"github.com/gorilla/mux"
+)
+
+const testVideo = "video-1"
+
+// newPlaybackServer monta a origem /stream sobre o S3 de mentira, com a
+// mesma rota de routes.SetupRoutes.
+func newPlaybackServer(t *testing.T, fake *storagetest.Server) (http.Handler, *signing.Signer) {
+	t.Helper()
+	client := fake.Client(t)
+	signer := signing.NewSigner("segredo", time.Hour)
+	handler := NewPlaybackHandler(client, signer, catalog.NewStore(client))
+	router := mux.NewRouter()
+	router.HandleFunc("/stream/{videoKey}/{path:.+}", handler.HandleStream).Methods("GET", "HEAD")
+	return router, signer
+}
+
+func TestServeSegment(t *testing.T) {
+	fake := storagetest.NewServer()
+	segment := "videos-transcoded/" + testVideo + "/v1/360p/seg_000.ts"
+	etag := fake.Set(segment, []byte("0123456789"))
+	object, _ := fake.Get(segment)
+	lastModified := object.LastModified.Format(http.TimeFormat)
+	router, signer := newPlaybackServer(t, fake)
+	token := signer.Sign(testVideo).Encode()
+
+	tests := []struct {
+		name         string
+		method       string
+		file         string
+		query        string
+		header       http.Header
+		wantStatus   int
+		wantBody     string
+		wantRange    string
+		wantValidate bool
+	}{
+		{"arquivo inteiro", "GET", "v1/360p/seg_000.ts", token, nil, 200, "0123456789", "", true},
+		{"intervalo", "GET", "v1/360p/seg_000.ts", token, http.Header{"Range": {"bytes=2-5"}}, 206, "2345", "bytes 2-5/10", true},
+		{"intervalo até o fim", "GET", "v1/360p/seg_000.ts", token, http.Header{"Range": {"bytes=7-"}}, 206, "789", "bytes 7-9/10", true},
+		{"intervalo fora do arquivo", "GET", "v1/360p/seg_000.ts", token, http.Header{"Range": {"bytes=20-30"}}, 416, "", "", false},
+		{"If-None-Match igual", "GET", "v1/360p/seg_000.ts", token, http.Header{"If-None-Match": {etag}}, 304, "", "", true},
+		{"If-None-Match diferente", "GET", "v1/360p/seg_000.ts", token, http.Header{"If-None-Match": {`"antigo"`}}, 200, "0123456789", "", true},
+		{"If-None-Match com lista", "GET", "v1/360p/seg_000.ts", token, http.Header{"If-None-Match": {`"antigo", ` + etag}}, 304, "", "", true},
+		{"If-Modified-Since atual", "GET", "v1/360p/seg_000.ts", token, http.Header{"If-Modified-Since": {lastModified}}, 304, "", "", true},
+		{"If-Range com ETag atual", "GET", "v1/360p/seg_000.ts", token, http.Header{"Range": {"bytes=2-5"}, "If-Range": {etag}}, 206, "2345", "bytes 2-5/10", true},
+		{"If-Range com data atual", "GET", "v1/360p/seg_000.ts", token, http.Header{"Range": {"bytes=2-5"}, "If-Range": {lastModified}}, 206, "2345", "bytes 2-5/10", true},
+		{"If-Range com ETag antigo", "GET", "v1/360p/seg_000.ts", token, http.Header{"Range": {"bytes=2-5"}, "If-Range": {`"antigo"`}}, 200, "0123456789", "", true},
+		{"HEAD", "HEAD", "v1/360p/seg_000.ts", token, nil, 200, "", "", true},
+		{"arquivo inexistente", "GET", "v1/360p/seg_999.ts", token, nil, 404, "", "", false},
+		{"sem token", "GET", "v1/360p/seg_000.ts", "", nil, 403, "", "", false},
+		{"token de outro vídeo", "GET", "v1/360p/seg_000.ts", signer.Sign("video-2").Encode(), nil, 403, "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/stream/"+testVideo+"/"+tt.file+"?"+tt.query, nil)
+			for name, values := range tt.header {
+				req.Header[name] = values
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, esperado %d (%s)", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantBody != "" && rec.Body.String() != tt.wantBody {
+				t.Errorf("corpo = %q, esperado %q", rec.Body, tt.wantBody)
+			}
+			if got := rec.Header().Get("Content-Range"); got != tt.wantRange {
+				t.Errorf("Content-Range = %q, esperado %q", got, tt.wantRange)
+			}
+			if tt.wantValidate && rec.Header().Get("ETag") != etag {
+				t.Errorf("ETag = %q, esperado %q", rec.Header().Get("ETag"), etag)
+			}
+			if tt.wantValidate && !strings.HasPrefix(rec.Header().Get("Cache-Control"), "private, max-age=") {
+				t.Errorf("Cache-Control = %q", rec.Header().Get("Cache-Control"))
+			}
+		})
+	}
+}
+
+func TestServePlaylist(t *testing.T) {
+	fake := storagetest.NewServer()
+	prefix := "videos-transcoded/" + testVideo + "/"
+	master := "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=800000\n360p/playlist.m3u8\n"
+	fake.Set(prefix+"master.m3u8", []byte(master))
+	fake.Set(prefix+"v2/master.m3u8", []byte(master))
+	fake.Set(prefix+"v2/360p/playlist.m3u8", []byte("#EXTM3U\n#EXT-X-KEY:METHOD=AES-128,URI=\"/keys/k1\"\n#EXTINF:4.0,\nseg_000.ts\n"))
+	fake.Set(prefix+"v2/480p/playlist.m3u8", []byte("#EXTM3U\n#EXTINF:4.0,\n../../../video-2/seg_000.ts\n"))
+	router, signer := newPlaybackServer(t, fake)
+	query := signer.Sign(testVideo)
+	token := url.Values{"expires": query["expires"], "token": query["token"]}.Encode()
+
+	tests := []struct {
+		name       string
+		live       int
+		file       string
+		wantStatus int
+		wantURI    string
+	}{
+		{"master sem versões", 0, "master.m3u8", 200, "360p/playlist.m3u8?" + token},
+		{"master aponta para a versão no ar", 2, "master.m3u8", 200, "v2/360p/playlist.m3u8?" + token},
+		{"playlist de mídia dentro da versão", 2, "v2/360p/playlist.m3u8", 200, "seg_000.ts?" + token},
+		{"URI fora do vídeo", 2, "v2/480p/playlist.m3u8", 500, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.live > 0 {
+				store := catalog.NewStore(fake.Client(t))
+				video := &catalog.Video{ID: testVideo, LiveVersion: tt.live, Versions: []catalog.Version{{Number: tt.live}}}
+				if err := store.PutVideo(context.Background(), video); err != nil {
+					t.Fatal(err)
+				}
+				// O master do vídeo sem versões fica em cache na origem
+				router, signer = newPlaybackServer(t, fake)
+			}
+			req := httptest.NewRequest("GET", "/stream/"+testVideo+"/"+tt.file+"?"+query.Encode(), nil)
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, esperado %d (%s)", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantStatus != 200 {
+				return
+			}
+			if !strings.Contains(rec.Body.String(), "\n"+tt.wantURI+"\n") {
+				t.Errorf("playlist sem %q:\n%s", tt.wantURI, rec.Body)
+			}
+			if got := rec.Header().Get("Cache-Control"); got != playlistCacheControl {
+				t.Errorf("Cache-Control = %q, esperado %q", got, playlistCacheControl)
+			}
+			if etag := rec.Header().Get("ETag"); !strings.HasPrefix(etag, "W/") {
+				t.Errorf("ETag = %q, esperado um ETag fraco", etag)
+			}
+		})
+	}
+}
+
+func TestServePlaylistSignsKeys(t *testing.T) {
+	fake := storagetest.NewServer()
+	fake.Set("videos-transcoded/"+testVideo+"/v1/360p/playlist.m3u8", []byte("#EXTM3U\n#EXT-X-KEY:METHOD=AES-128,URI=\"/keys/k1\",IV=0x01\n#EXTINF:4.0,\nseg_000.ts\n"))
+	router, signer := newPlaybackServer(t, fake)
+	query := signer.Sign(testVideo)
+
+	req := httptest.NewRequest("GET", "/stream/"+testVideo+"/v1/360p/playlist.m3u8?"+query.Encode(), nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d (%s)", rec.Code, rec.Body)
+	}
+
+	expires, _ := signing.Expiry(query)
+	want := `URI="` + keyURL(signer, testVideo, "k1", expires) + `"`
+	if !strings.Contains(rec.Body.String(), want) {
+		t.Errorf("playlist sem %s:\n%s", want, rec.Body)
+	}
+}
+
+func TestServePlaylistNotModified(t *testing.T) {
+	fake := storagetest.NewServer()
+	etag := fake.Set("videos-transcoded/"+testVideo+"/v1/360p/playlist.m3u8", []byte("#EXTM3U\n#EXTINF:4.0,\nseg_000.ts\n"))
+	router, signer := newPlaybackServer(t, fake)
+
+	tests := []struct {
+		name        string
+		ifNoneMatch string
+		wantStatus  int
+	}{
+		{"ETag fraco atual", "W/" + etag, 304},
+		{"ETag antigo", `W/"antigo"`, 200},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/stream/"+testVideo+"/v1/360p/playlist.m3u8?"+signer.Sign(testVideo).Encode(), nil)
+			req.Header.Set("If-None-Match", tt.ifNoneMatch)
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, esperado %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"streaming-platform/internal/catalog"
+	"streaming-platform/internal/poster"
+	"streaming-platform/internal/signing"
+
+	"github.com/gorilla/mux"
+)
+
+// PostersHandler expõe os candidatos a capa de cada vídeo e a escolha do
+// editor.
+type PostersHandler struct {
+	Posters *poster.Manager
+	Signer  *signing.Signer
+}
+
+func NewPostersHandler(posters *poster.Manager, signer *signing.Signer) *PostersHandler {
+	return &PostersHandler{
+		Posters: posters,
+		Signer:  signer,
+	}
+}
+
+// posterCandidate é um candidato com a URL assinada da imagem, para o editor
+// comparar os quadros.
+type posterCandidate struct {
+	catalog.PosterCandidate
+	URL string `json:"url"`
+}
+
+// HandleGet retorna os candidatos a capa do vídeo, com pontuação e medidas,
+// e qual deles está em uso.
+func (h *PostersHandler) HandleGet(w http.ResponseWriter, r *http.Request) {
+	record, err := h.Posters.Catalog.GetPoster(r.Context(), mux.Vars(r)["videoKey"])
+	if err != nil {
+		writePosterError(w, r, err)
+		return
+	}
+	h.writePoster(w, r, record)
+}
+
+// HandleSelect coloca o candidato informado como capa do vídeo. A escolha
+// sobrevive a reprocessamentos do mesmo original. Exige uma chave de editor.
+func (h *PostersHandler) HandleSelect(w http.ResponseWriter, r *http.Request) {
+	n, err := strconv.Atoi(mux.Vars(r)["candidate"])
+	if err != nil || n < 1 {
+		http.Error(w, "Candidato inválido", http.StatusBadRequest)
+		return
+	}
+	record, err := h.Posters.Select(r.Context(), mux.Vars(r)["videoKey"], n)
+	if err != nil {
+		writePosterError(w, r, err)
+		return
+	}
+	h.writePoster(w, r, record)
+}
+
+func (h *PostersHandler) writePoster(w http.ResponseWriter, r *http.Request, record *catalog.Poster) {
+	candidates := make([]posterCandidate, 0, len(record.Candidates))
+	for _, candidate := range record.Candidates {
+		url, err := h.Posters.S3Client.GetSignedURL(candidate.Key, h.Signer.TTL())
+		if err != nil {
+			writePosterError(w, r, err)
+			return
+		}
+		candidates = append(candidates, posterCandidate{PosterCandidate: candidate, URL: url})
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"videoId":    record.VideoID,
+		"selected":   record.Selected,
+		"selectedBy": record.SelectedBy,
+		"candidates": candidates,
+		"updatedAt":  record.UpdatedAt,
+	})
+}
+
+func writePosterError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, catalog.ErrNotFound):
+		http.Error(w, "Vídeo sem candidatos a capa", http.StatusNotFound)
+	case errors.Is(err, poster.ErrUnknownCandidate):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, poster.ErrCandidatesChanged), errors.Is(err, catalog.ErrConflict):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		slog.ErrorContext(r.Context(), "erro ao administrar capa", "error", err)
+		http.Error(w, "Erro ao administrar capa", http.StatusInternalServerError)
+	}
+}
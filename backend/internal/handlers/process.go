@@ -1,95 +1,127 @@
 package handlers
 
 import (
-	"context"
-	"fmt"
-	"log"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
 	"net/http"
-	"os"
-	"path/filepath"
+	"strings"
+
+	"streaming-platform/internal/catalog"
+	"streaming-platform/internal/logging"
 	"streaming-platform/internal/services"
-	"streaming-platform/internal/storage"
 	"streaming-platform/utils"
+
+	"github.com/gorilla/mux"
 )
 
 type ProcessHandler struct {
-	S3Client *storage.S3Client
+	Processor *utils.Processor
 }
 
-
-func NewProcessHandler(s3Client *storage.S3Client) *ProcessHandler {
+func NewProcessHandler(processor *utils.Processor) *ProcessHandler {
 	return &ProcessHandler{
-		S3Client: s3Client,
+		Processor: processor,
 	}
 }
 
-func (h *ProcessHandler) HandleProcess(w http.ResponseWriter, r *http.Request) {
-	videoKey := r.URL.Query().Get("videoKey")
-	if videoKey == "" {
-		http.Error(w, "Missing video key", http.StatusBadRequest)
+// HandlePriority muda a prioridade de um job pendente. O corpo é
+// {"priority": "urgent"} (low, normal, high, urgent ou um número); se o job
+// estiver na fila, ele muda de posição na hora.
+func (h *ProcessHandler) HandlePriority(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["jobID"]
+	ctx := logging.With(r.Context(), "job_id", id)
+
+	var body struct {
+		Priority json.RawMessage `json:"priority"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1024)).Decode(&body); err != nil || len(body.Priority) == 0 {
+		http.Error(w, "Informe a prioridade", http.StatusBadRequest)
 		return
 	}
-
-	// Remover a extensão .mp4 se presente
-	videoID := utils.RemoveExtensionID(videoKey)
-	log.Printf("videoID para processamento: %s", videoID) // Log para verificar
-
-	ctx := context.Background()
-
-	// Baixar vídeo do S3
-	videoData, err := h.S3Client.DownloadFile(ctx, "videos/"+videoKey)
+	priority, err := catalog.ParsePriority(strings.Trim(string(body.Priority), `"`))
 	if err != nil {
-		http.Error(w, "Failed to download video from S3", http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Salvar vídeo localmente
-	tempFile := filepath.Join(os.TempDir(), videoKey)
-	err = os.WriteFile(tempFile, videoData, 0644)
-	if err != nil {
-		http.Error(w, "Failed to save temporary video file", http.StatusInternalServerError)
+	job, err := h.Processor.SetPriority(ctx, id, priority)
+	switch {
+	case errors.Is(err, catalog.ErrNotFound):
+		http.Error(w, "Job não encontrado", http.StatusNotFound)
+		return
+	case errors.Is(err, utils.ErrJobProcessing):
+		http.Error(w, "Job já está em processamento", http.StatusConflict)
+		return
+	case err != nil:
+		slog.ErrorContext(ctx, "erro ao alterar prioridade", "error", err)
+		http.Error(w, "Erro ao alterar prioridade", http.StatusInternalServerError)
 		return
 	}
-	defer os.Remove(tempFile)
 
-	// Transcodificar o vídeo
-	qualities := []string{"1080p", "720p", "480p"}
-	err = services.TranscodeVideoToHLS(videoID, tempFile, qualities)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+// HandleDeadLetters lista os jobs na dead-letter, com o diagnóstico da
+// última falha, e os perfis disponíveis para tentar de novo.
+func (h *ProcessHandler) HandleDeadLetters(w http.ResponseWriter, r *http.Request) {
+	jobs, err := h.Processor.DeadLetters(r.Context())
 	if err != nil {
-		http.Error(w, "Failed to transcode video", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "erro ao listar dead-letter", "error", err)
+		http.Error(w, "Erro ao listar dead-letter", http.StatusInternalServerError)
 		return
 	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"jobs":     jobs,
+		"profiles": services.Profiles(),
+	})
+}
+
+// HandleRetry devolve à fila um job da dead-letter. O corpo opcional
+// {"profile": "tolerant"} escolhe outro perfil de transcodificação.
+func (h *ProcessHandler) HandleRetry(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["jobID"]
+	ctx := logging.With(r.Context(), "job_id", id)
 
-	// Upload das resoluções transcodificadas para o S3
-	for _, quality := range qualities {
-		playlistPath := filepath.Join("storage/hls", videoID, quality, "playlist.m3u8")
-		err := h.S3Client.UploadFileFromPath(ctx, "videos-transcoded/"+videoID+"/"+quality+"/playlist.m3u8", playlistPath)
-		if err != nil {
-			http.Error(w, "Failed to upload transcoded video", http.StatusInternalServerError)
-			return
-		}
+	var body struct {
+		Profile string `json:"profile"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1024)).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Corpo inválido", http.StatusBadRequest)
+		return
 	}
 
-	// Geração de thumbnail
-	thumbnailPath := filepath.Join(os.TempDir(), "thumbnail.jpg")
-	err = services.GenerateThumbnail(tempFile, thumbnailPath)
+	job, err := h.Processor.RetryDeadLetter(ctx, id, body.Profile)
 	if err != nil {
-		http.Error(w, "Failed to generate thumbnail", http.StatusInternalServerError)
+		writeDeadLetterError(w, r, err)
 		return
 	}
-	defer os.Remove(thumbnailPath)
+	writeJSON(w, http.StatusOK, job)
+}
 
-	// Upload da thumbnail para o S3
-	err = h.S3Client.UploadFileFromPath(ctx, "thumbnails/"+videoID+".jpg", thumbnailPath)
+// HandleDismiss descarta um job da dead-letter.
+func (h *ProcessHandler) HandleDismiss(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["jobID"]
+	job, err := h.Processor.DismissDeadLetter(logging.With(r.Context(), "job_id", id), id)
 	if err != nil {
-		http.Error(w, "Failed to upload thumbnail", http.StatusInternalServerError)
+		writeDeadLetterError(w, r, err)
 		return
 	}
-
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, "Video %s processed and uploaded successfully\n", videoID)
+	writeJSON(w, http.StatusOK, job)
 }
 
-
-
-
+func writeDeadLetterError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, catalog.ErrNotFound):
+		http.Error(w, "Job não encontrado", http.StatusNotFound)
+	case errors.Is(err, utils.ErrUnknownProfile):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, utils.ErrNotDeadLetter), errors.Is(err, catalog.ErrConflict):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		slog.ErrorContext(r.Context(), "erro ao administrar dead-letter", "error", err)
+		http.Error(w, "Erro ao administrar dead-letter", http.StatusInternalServerError)
+	}
+}
@@ -1,43 +1,176 @@
 package handlers
 
 import (
-	"context"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
 	"strings"
 
+	"streaming-platform/internal/catalog"
+	"streaming-platform/internal/poster"
+	"streaming-platform/internal/services"
 	"streaming-platform/internal/storage"
 
 	"github.com/gorilla/mux"
 )
 
-func GetThumbnailHandler(s3Client *storage.S3Client) http.HandlerFunc {
+// Cache das miniaturas: com ?v= igual à versão atual da capa (presente nas
+// URLs geradas pela API) a URL muda a cada troca de capa e pode ser imutável;
+// sem ela, com uma versão antiga ou servindo outra imagem no lugar da pedida,
+// a resposta pode mudar a qualquer momento.
+const (
+	thumbnailCacheControl          = "public, max-age=300"
+	thumbnailVersionedCacheControl = "public, max-age=31536000, immutable"
+)
+
+// GetThumbnailHandler serve a capa de um vídeo. ?w= escolhe a menor largura
+// gerada que cubra a pedida (sem w, a capa original) e o formato vem de
+// ?format= (webp ou jpg) ou do cabeçalho Accept.
+func GetThumbnailHandler(posters *poster.Manager) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Obter `videoID` dos parâmetros da URL
 		vars := mux.Vars(r)
 		videoID := vars["videoID"]
-		fmt.Println("ID do vídeo recebido:", videoID) // Log para verificar o videoID
+		ctx := r.Context()
+		query := r.URL.Query()
 
-		// Montar caminho correto da thumbnail no S3
-		ctx := context.Background()
-		thumbnailKey := "thumbnails/" + videoID + ".jpg" // Caminho para a pasta thumbnails
-		fmt.Println("Procurando arquivo em:", thumbnailKey) // Log para verificar o caminho
+		// O registro traz as larguras geradas para esta capa e a versão dela;
+		// capas publicadas antes dele só têm o original
+		record, err := posters.Catalog.GetPoster(ctx, videoID)
+		if err != nil && !errors.Is(err, catalog.ErrNotFound) {
+			slog.WarnContext(ctx, "erro ao ler registro da capa", "video_id", videoID, "error", err)
+		}
 
-		// Baixar thumbnail do S3
-		thumbnail, err := s3Client.DownloadFile(ctx, thumbnailKey)
+		width := 0
+		if value := query.Get("w"); value != "" {
+			n, err := strconv.Atoi(strings.TrimSuffix(value, "w"))
+			if err != nil || n < 1 {
+				http.Error(w, "Largura inválida", http.StatusBadRequest)
+				return
+			}
+			if record != nil {
+				width = thumbnailWidth(record.Widths, n)
+			}
+		}
+		format := query.Get("format")
+		switch format {
+		case "":
+			format = services.ThumbnailJPEG
+			if strings.Contains(r.Header.Get("Accept"), "image/webp") {
+				format = services.ThumbnailWebP
+			}
+			w.Header().Set("Vary", "Accept")
+		case services.ThumbnailWebP, services.ThumbnailJPEG:
+		case "jpeg":
+			format = services.ThumbnailJPEG
+		default:
+			http.Error(w, "Formato inválido (use webp ou jpg)", http.StatusBadRequest)
+			return
+		}
+
+		// Capas publicadas antes dos tamanhos só têm o original
+		keys := []string{poster.Key(videoID)}
+		if width > 0 {
+			keys = append([]string{poster.SizeKey(videoID, width, format)}, keys...)
+		}
+		opts := storage.ObjectOptions{IfNoneMatch: r.Header.Get("If-None-Match")}
+		var object *storage.Object
+		var key string
+		for _, key = range keys {
+			slog.DebugContext(ctx, "buscando thumbnail", "video_id", videoID, "key", key)
+			if r.Method == http.MethodHead {
+				object, err = posters.S3Client.StatObject(ctx, key, opts)
+			} else {
+				object, err = posters.S3Client.GetObject(ctx, key, opts)
+			}
+			if !errors.Is(err, storage.ErrNotFound) {
+				break
+			}
+		}
+		cacheControl := thumbnailCacheControl
+		if record != nil && key == keys[0] && query.Get("v") == thumbnailVersion(record) {
+			cacheControl = thumbnailVersionedCacheControl
+		}
 		if err != nil {
-			fmt.Println("Erro ao buscar thumbnail:", err.Error()) // Adiciona log de erro completo
-			if strings.Contains(err.Error(), "NoSuchKey") {
+			if errors.Is(err, storage.ErrNotModified) {
+				w.Header().Set("Cache-Control", cacheControl)
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			if errors.Is(err, storage.ErrNotFound) {
 				http.Error(w, "Thumbnail não encontrada", http.StatusNotFound)
 				return
 			}
-			http.Error(w, "Erro ao buscar thumbnail: "+err.Error(), http.StatusInternalServerError)
+			slog.ErrorContext(ctx, "erro ao buscar thumbnail", "video_id", videoID, "error", err)
+			http.Error(w, "Erro ao buscar thumbnail", http.StatusBadGateway)
 			return
 		}
+		if object.Body != nil {
+			defer object.Body.Close()
+		}
 
-		// Retornar a thumbnail como resposta
-		w.Header().Set("Content-Type", "image/jpeg")
-		w.Write(thumbnail)
+		header := w.Header()
+		header.Set("Content-Type", contentType(key, object.ContentType))
+		header.Set("Cache-Control", cacheControl)
+		header.Set("Content-Length", strconv.FormatInt(object.ContentLength, 10))
+		if object.ETag != "" {
+			header.Set("ETag", object.ETag)
+		}
+		if !object.LastModified.IsZero() {
+			header.Set("Last-Modified", object.LastModified.UTC().Format(http.TimeFormat))
+		}
+		w.WriteHeader(http.StatusOK)
+		if object.Body != nil {
+			if _, err := io.Copy(w, object.Body); err != nil {
+				slog.WarnContext(ctx, "envio interrompido", "key", key, "error", err)
+			}
+		}
 	}
 }
 
+// thumbnailWidth retorna a menor largura gerada que cubra a pedida, ou a
+// maior de todas.
+func thumbnailWidth(widths []int, requested int) int {
+	sorted := append([]int(nil), widths...)
+	sort.Ints(sorted)
+	for _, width := range sorted {
+		if width >= requested {
+			return width
+		}
+	}
+	if len(sorted) == 0 {
+		return 0
+	}
+	return sorted[len(sorted)-1]
+}
+
+// thumbnailVersion retorna a versão da capa usada no ?v= das URLs.
+func thumbnailVersion(record *catalog.Poster) string {
+	return strconv.FormatInt(record.UpdatedAt.Unix(), 10)
+}
+
+// thumbnailSources descreve a capa para a API: a URL da capa original e,
+// por tipo de imagem, uma lista no formato do atributo srcset com as
+// larguras geradas. As URLs levam a versão da capa e podem ficar em cache.
+func thumbnailSources(record *catalog.Poster) map[string]interface{} {
+	id := url.PathEscape(record.VideoID)
+	version := thumbnailVersion(record)
+	srcset := map[string]string{}
+	for _, format := range services.ThumbnailFormats {
+		var entries []string
+		for _, width := range record.Widths {
+			entries = append(entries, fmt.Sprintf("/thumbnails/%s?w=%d&format=%s&v=%s %dw", id, width, format, version, width))
+		}
+		srcset[storage.ContentType(services.ThumbnailFile(0, format))] = strings.Join(entries, ", ")
+	}
+	return map[string]interface{}{
+		"src":    fmt.Sprintf("/thumbnails/%s?v=%s", id, version),
+		"widths": record.Widths,
+		"srcset": srcset,
+	}
+}
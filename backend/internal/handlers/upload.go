@@ -1,50 +1,193 @@
 package handlers
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"mime/multipart"
 	"net/http"
-	"os"
-	"path/filepath"
+	"strings"
 
-	"streaming-platform/internal/services"
+	"streaming-platform/internal/auth"
+	"streaming-platform/internal/catalog"
+	"streaming-platform/internal/lease"
+	"streaming-platform/internal/logging"
+	"streaming-platform/internal/storage"
+	"streaming-platform/internal/telemetry"
+	"streaming-platform/internal/webhook"
+	"streaming-platform/utils"
 )
 
-type UploadHandler struct{}
+type UploadHandler struct {
+	S3Client *storage.S3Client
+	Catalog  *catalog.Store
+	// Donos cujos envios entram na fila com prioridade alta
+	PriorityOwners map[string]bool
+	Webhooks       *webhook.Dispatcher
+	// Processor transcodifica o envio na própria requisição, onde o processo
+	// também é worker; nil (MODE=api) só registra o job para os workers
+	Processor *utils.Processor
+}
 
-func NewUploadHandler() *UploadHandler {
-	return &UploadHandler{}
+func NewUploadHandler(s3Client *storage.S3Client, store *catalog.Store, priorityOwners []string, webhooks *webhook.Dispatcher, processor *utils.Processor) *UploadHandler {
+	owners := make(map[string]bool, len(priorityOwners))
+	for _, owner := range priorityOwners {
+		owners[owner] = true
+	}
+	return &UploadHandler{
+		S3Client:       s3Client,
+		Catalog:        store,
+		PriorityOwners: owners,
+		Webhooks:       webhooks,
+		Processor:      processor,
+	}
 }
 
+// HandleUpload envia o arquivo para videos/, registra o job e o transcodifica
+// antes de responder 200 com "Vídeo <id> transcodificado com sucesso", como
+// sempre foi. Em MODE=api não há transcodificação no processo: o job fica
+// pendente para os workers, e a resposta é 202 com o job em JSON. Nos dois
+// casos o job guarda o contexto de trace desta requisição. Cada envio ganha
+// uma chave própria (o nome do arquivo com um sufixo aleatório): enviar de
+// novo um arquivo com o mesmo nome cria outro vídeo.
+//
+// O dono do job é o da chave de API ou, sem API_KEYS, o campo opcional owner.
+// O campo opcional priority (low, normal, high, urgent ou um número) vem na
+// query string ou como campo do formulário antes do arquivo; com chaves de
+// API, só administradores podem subir a prioridade acima da padrão do dono.
 func (h *UploadHandler) HandleUpload(w http.ResponseWriter, r *http.Request) {
-	file, header, err := r.FormFile("file")
+	ctx := r.Context()
+	identity, ok := auth.FromContext(ctx)
+	if !ok {
+		http.Error(w, auth.ErrUnauthenticated.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	// Ler o corpo multipart em streaming, sem carregar o arquivo em memória
+	fields := map[string]string{}
+	file, err := nextFilePart(r, "file", fields)
 	if err != nil {
 		http.Error(w, "Erro ao obter arquivo", http.StatusBadRequest)
 		return
 	}
 	defer file.Close()
 
-	tempDir := filepath.Join(os.TempDir(), "uploads")
-	os.MkdirAll(tempDir, os.ModePerm)
+	owner := identity.Owner
+	if identity.Anonymous() {
+		owner = formValue(r, fields, "owner")
+	}
+	priority := catalog.PriorityNormal
+	if h.PriorityOwners[owner] {
+		priority = catalog.PriorityHigh
+	}
+	if value := formValue(r, fields, "priority"); value != "" {
+		requested, err := catalog.ParsePriority(value)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if requested > priority && !identity.Can(auth.RoleAdmin) {
+			http.Error(w, "Só administradores podem aumentar a prioridade", http.StatusForbidden)
+			return
+		}
+		priority = requested
+	}
 
-	filePath := filepath.Join(tempDir, header.Filename)
-	out, err := os.Create(filePath)
+	videoKey, err := catalog.NewVideoKey(file.FileName())
 	if err != nil {
+		slog.ErrorContext(ctx, "erro ao gerar chave do vídeo", "error", err)
+		http.Error(w, "Erro ao salvar arquivo", http.StatusInternalServerError)
+		return
+	}
+	if err := h.S3Client.Put(ctx, videoKey, file); err != nil {
+		slog.ErrorContext(ctx, "erro ao enviar vídeo", "video_key", videoKey, "error", err)
 		http.Error(w, "Erro ao salvar arquivo", http.StatusInternalServerError)
 		return
 	}
-	defer out.Close()
 
-	io.Copy(out, file)
+	job := catalog.NewJob(videoKey)
+	job.Owner = owner
+	job.Priority = priority
+	ctx = logging.With(ctx, "job_id", job.ID, "video_id", job.ID)
+	job.TraceContext = telemetry.InjectContext(ctx)
+	if err := h.Catalog.PutJob(ctx, job); err != nil {
+		slog.ErrorContext(ctx, "erro ao registrar job", "video_key", videoKey, "error", err)
+		http.Error(w, "Erro ao registrar processamento", http.StatusInternalServerError)
+		return
+	}
 
-	videoID := header.Filename
-	qualities := []string{"720p", "480p"} // Redução de qualidades para economizar
+	h.Webhooks.Publish(ctx, webhook.EventUploaded, webhook.VideoFromJob(job))
 
-	if err := services.TranscodeVideoToHLS(videoID, filePath, qualities); err != nil {
+	if h.Processor == nil {
+		if err := h.Catalog.TouchQueue(ctx, "upload"); err != nil {
+			// O job entra na próxima sincronização completa da fila
+			slog.WarnContext(ctx, "erro ao avisar os workers", "error", err)
+		}
+		slog.InfoContext(ctx, "vídeo enviado, job registrado", "video_key", videoKey)
+		writeJob(w, http.StatusAccepted, job)
+		return
+	}
+
+	// Sem avisar a fila: o job é processado aqui, e os workers só o veem na
+	// próxima sincronização completa
+	err = h.Processor.RunJob(ctx, job)
+	if errors.Is(err, lease.ErrHeld) || errors.Is(err, utils.ErrOwnerLimit) {
+		// Um worker começou o job primeiro, ou o dono já ocupa todas as vagas:
+		// o job fica na fila e o resultado sai no catálogo
+		slog.InfoContext(ctx, "vídeo enviado, job na fila dos workers", "video_key", videoKey, "reason", err)
+		writeJob(w, http.StatusAccepted, job)
+		return
+	}
+	if err != nil {
 		http.Error(w, fmt.Sprintf("Erro na transcodificação: %v", err), http.StatusInternalServerError)
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, "Vídeo %s transcodificado com sucesso", videoID)
+	fmt.Fprintf(w, "Vídeo %s transcodificado com sucesso", job.ID)
+}
+
+func writeJob(w http.ResponseWriter, status int, job *catalog.Job) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(job)
+}
+
+// maxFieldSize limita os campos de texto lidos antes do arquivo.
+const maxFieldSize = 1024
+
+// nextFilePart avança o corpo multipart até o campo de arquivo informado,
+// guardando em fields os campos de texto encontrados antes dele.
+func nextFilePart(r *http.Request, field string, fields map[string]string) (*multipart.Part, error) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			return nil, err
+		}
+		if part.FormName() == field && part.FileName() != "" {
+			return part, nil
+		}
+		if part.FileName() == "" {
+			value, err := io.ReadAll(io.LimitReader(part, maxFieldSize))
+			if err != nil {
+				return nil, err
+			}
+			fields[part.FormName()] = string(value)
+		}
+		part.Close()
+	}
+}
+
+// formValue retorna o campo da query string ou, se ausente, do formulário.
+func formValue(r *http.Request, fields map[string]string, name string) string {
+	if value := r.URL.Query().Get(name); value != "" {
+		return value
+	}
+	return strings.TrimSpace(fields[name])
 }
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"streaming-platform/internal/catalog"
+	"streaming-platform/internal/publish"
+
+	"github.com/gorilla/mux"
+)
+
+// VersionsHandler administra as versões publicadas de cada vídeo: listar,
+// colocar uma versão anterior no ar e remover versões antigas.
+type VersionsHandler struct {
+	Publisher *publish.Publisher
+}
+
+func NewVersionsHandler(publisher *publish.Publisher) *VersionsHandler {
+	return &VersionsHandler{
+		Publisher: publisher,
+	}
+}
+
+// HandleList retorna o registro do vídeo com todas as versões e a versão no ar.
+func (h *VersionsHandler) HandleList(w http.ResponseWriter, r *http.Request) {
+	video, err := h.Publisher.Catalog.GetVideo(r.Context(), mux.Vars(r)["videoKey"])
+	if err != nil {
+		writeVersionError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, video)
+}
+
+// HandleActivate coloca no ar a versão informada (rollback ou roll forward).
+func (h *VersionsHandler) HandleActivate(w http.ResponseWriter, r *http.Request) {
+	number, ok := versionParam(w, r)
+	if !ok {
+		return
+	}
+	video, err := h.Publisher.Rollback(r.Context(), mux.Vars(r)["videoKey"], number)
+	if err != nil {
+		writeVersionError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, video)
+}
+
+// HandleDelete remove uma versão que não está no ar.
+func (h *VersionsHandler) HandleDelete(w http.ResponseWriter, r *http.Request) {
+	number, ok := versionParam(w, r)
+	if !ok {
+		return
+	}
+	video, err := h.Publisher.DeleteVersion(r.Context(), mux.Vars(r)["videoKey"], number)
+	if err != nil {
+		writeVersionError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, video)
+}
+
+// HandlePrune mantém as ?keep=N versões mais recentes (padrão e mínimo 2) e a
+// versão no ar, removendo as demais.
+func (h *VersionsHandler) HandlePrune(w http.ResponseWriter, r *http.Request) {
+	keep := 2
+	if value := r.URL.Query().Get("keep"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 2 {
+			http.Error(w, "Parâmetro keep inválido: mantenha ao menos 2 versões", http.StatusBadRequest)
+			return
+		}
+		keep = n
+	}
+
+	removed, err := h.Publisher.Prune(r.Context(), mux.Vars(r)["videoKey"], keep)
+	if err != nil {
+		writeVersionError(w, r, err)
+		return
+	}
+	if removed == nil {
+		removed = []int{}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"removed": removed})
+}
+
+// versionParam lê o número da versão da rota, aceitando "3" ou "v3".
+func versionParam(w http.ResponseWriter, r *http.Request) (int, bool) {
+	number, err := strconv.Atoi(strings.TrimPrefix(mux.Vars(r)["version"], "v"))
+	if err != nil || number < 1 {
+		http.Error(w, "Versão inválida", http.StatusBadRequest)
+		return 0, false
+	}
+	return number, true
+}
+
+func writeVersionError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, catalog.ErrNotFound):
+		http.Error(w, "Vídeo sem versões publicadas", http.StatusNotFound)
+	case errors.Is(err, publish.ErrVersionNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, publish.ErrVersionLive):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		slog.ErrorContext(r.Context(), "erro ao administrar versões", "error", err)
+		http.Error(w, "Erro ao administrar versões", http.StatusInternalServerError)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
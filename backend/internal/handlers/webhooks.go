@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"streaming-platform/internal/catalog"
+	"streaming-platform/internal/webhook"
+
+	"github.com/gorilla/mux"
+)
+
+// WebhooksHandler administra as inscrições de webhook e o log de entregas.
+type WebhooksHandler struct {
+	Dispatcher *webhook.Dispatcher
+}
+
+func NewWebhooksHandler(dispatcher *webhook.Dispatcher) *WebhooksHandler {
+	return &WebhooksHandler{
+		Dispatcher: dispatcher,
+	}
+}
+
+// HandleCreate cria uma inscrição. O corpo é {"url": ..., "events": [...],
+// "secret": ...}; sem events a inscrição recebe todos os eventos e sem secret
+// um segredo é gerado. O segredo só aparece nesta resposta.
+func (h *WebhooksHandler) HandleCreate(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		URL    string   `json:"url"`
+		Events []string `json:"events"`
+		Secret string   `json:"secret"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, 16<<10)).Decode(&body); err != nil {
+		http.Error(w, "Corpo inválido", http.StatusBadRequest)
+		return
+	}
+	target, err := webhook.CheckURL(r.Context(), strings.TrimSpace(body.URL))
+	if err != nil {
+		http.Error(w, "URL inválida: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	for _, event := range body.Events {
+		if !webhook.IsEvent(event) {
+			http.Error(w, fmt.Sprintf("Evento desconhecido '%s' (use %s)", event, strings.Join(webhook.Events, ", ")), http.StatusBadRequest)
+			return
+		}
+	}
+	if body.Secret == "" {
+		random := make([]byte, 24)
+		if _, err := rand.Read(random); err != nil {
+			http.Error(w, "Erro ao gerar segredo", http.StatusInternalServerError)
+			return
+		}
+		body.Secret = "whsec_" + hex.EncodeToString(random)
+	}
+
+	sub := &catalog.Subscription{
+		ID:        webhook.NewID("wh_"),
+		URL:       target.String(),
+		Events:    body.Events,
+		Secret:    body.Secret,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := h.Dispatcher.Catalog.PutSubscription(r.Context(), sub); err != nil {
+		writeWebhookError(w, r, err)
+		return
+	}
+	slog.InfoContext(r.Context(), "inscrição de webhook criada", "subscription_id", sub.ID, "url", sub.URL, "events", sub.Events)
+	writeJSON(w, http.StatusCreated, sub)
+}
+
+// HandleList retorna as inscrições, sem os segredos.
+func (h *WebhooksHandler) HandleList(w http.ResponseWriter, r *http.Request) {
+	subs, err := h.Dispatcher.Catalog.ListSubscriptions(r.Context())
+	if err != nil {
+		writeWebhookError(w, r, err)
+		return
+	}
+	for _, sub := range subs {
+		sub.Secret = ""
+	}
+	if subs == nil {
+		subs = []*catalog.Subscription{}
+	}
+	writeJSON(w, http.StatusOK, subs)
+}
+
+// HandleGet retorna uma inscrição, sem o segredo.
+func (h *WebhooksHandler) HandleGet(w http.ResponseWriter, r *http.Request) {
+	sub, err := h.Dispatcher.Catalog.GetSubscription(r.Context(), mux.Vars(r)["webhookID"])
+	if err != nil {
+		writeWebhookError(w, r, err)
+		return
+	}
+	sub.Secret = ""
+	writeJSON(w, http.StatusOK, sub)
+}
+
+// HandleDelete remove uma inscrição. Entregas pendentes dela são
+// abandonadas na próxima varredura.
+func (h *WebhooksHandler) HandleDelete(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["webhookID"]
+	if _, err := h.Dispatcher.Catalog.GetSubscription(r.Context(), id); err != nil {
+		writeWebhookError(w, r, err)
+		return
+	}
+	if err := h.Dispatcher.Catalog.DeleteSubscription(r.Context(), id); err != nil {
+		writeWebhookError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleDeliveries retorna o log de entregas da inscrição, da mais recente
+// para a mais antiga. ?state= filtra por estado (pending, delivered, failed).
+func (h *WebhooksHandler) HandleDeliveries(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["webhookID"]
+	deliveries, err := h.Dispatcher.Catalog.ListDeliveries(r.Context(), id)
+	if err != nil {
+		writeWebhookError(w, r, err)
+		return
+	}
+
+	state := r.URL.Query().Get("state")
+	filtered := make([]*catalog.Delivery, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		if state == "" || delivery.State == state {
+			filtered = append(filtered, delivery)
+		}
+	}
+	sort.Slice(filtered, func(i, j int) bool {
+		return filtered[i].CreatedAt.After(filtered[j].CreatedAt)
+	})
+	writeJSON(w, http.StatusOK, filtered)
+}
+
+// HandleReplay reenvia o corpo de uma entrega como uma entrega nova e
+// retorna o resultado da tentativa.
+func (h *WebhooksHandler) HandleReplay(w http.ResponseWriter, r *http.Request) {
+	delivery, err := h.Dispatcher.Replay(r.Context(), mux.Vars(r)["deliveryID"])
+	if err != nil {
+		writeWebhookError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, delivery)
+}
+
+func writeWebhookError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, catalog.ErrNotFound) {
+		http.Error(w, "Inscrição ou entrega não encontrada", http.StatusNotFound)
+		return
+	}
+	slog.ErrorContext(r.Context(), "erro ao administrar webhooks", "error", err)
+	http.Error(w, "Erro ao administrar webhooks", http.StatusInternalServerError)
+}
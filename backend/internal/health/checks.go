@@ -0,0 +1,37 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// TempDirCheck verifica se o diretório temporário aceita escrita e tem pelo
+// menos minFree bytes livres.
+func TempDirCheck(dir string, minFree uint64) CheckFunc {
+	return func(ctx context.Context) (Result, error) {
+		file, err := os.CreateTemp(dir, ".healthcheck-*")
+		if err != nil {
+			return Result{}, fmt.Errorf("diretório sem permissão de escrita: %v", err)
+		}
+		file.Close()
+		os.Remove(file.Name())
+
+		var stat syscall.Statfs_t
+		if err := syscall.Statfs(dir, &stat); err != nil {
+			return Result{}, fmt.Errorf("erro ao consultar espaço livre: %v", err)
+		}
+		free := stat.Bavail * uint64(stat.Bsize)
+
+		result := Result{Details: map[string]interface{}{
+			"path":      dir,
+			"freeBytes": free,
+			"minFree":   minFree,
+		}}
+		if free < minFree {
+			return result, fmt.Errorf("pouco espaço livre em %s: %d bytes", dir, free)
+		}
+		return result, nil
+	}
+}
@@ -0,0 +1,90 @@
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Status de uma verificação
+const (
+	StatusOK   = "ok"
+	StatusWarn = "warn"
+	StatusFail = "fail"
+)
+
+// checkTimeout limita cada verificação para que a sonda responda a tempo.
+const checkTimeout = 3 * time.Second
+
+// Result é o resultado de uma verificação de dependência.
+type Result struct {
+	Status    string                 `json:"status"`
+	Error     string                 `json:"error,omitempty"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+	LatencyMS int64                  `json:"latencyMs"`
+}
+
+// CheckFunc verifica uma dependência. Um erro resulta em StatusFail; para
+// sinalizar degradação sem falhar, retorne um Result com StatusWarn.
+type CheckFunc func(ctx context.Context) (Result, error)
+
+// Report é a resposta estruturada de /readyz.
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks"`
+}
+
+// Checker executa as verificações de prontidão registradas.
+type Checker struct {
+	names  []string
+	checks map[string]CheckFunc
+}
+
+func NewChecker() *Checker {
+	return &Checker{checks: make(map[string]CheckFunc)}
+}
+
+// Register adiciona uma verificação com o nome informado.
+func (c *Checker) Register(name string, check CheckFunc) {
+	c.names = append(c.names, name)
+	c.checks[name] = check
+}
+
+// Run executa todas as verificações em paralelo. O relatório só fica pronto
+// (StatusOK) se nenhuma verificação falhar; avisos não tiram a instância do ar.
+func (c *Checker) Run(ctx context.Context) Report {
+	report := Report{Status: StatusOK, Checks: make(map[string]Result, len(c.names))}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, name := range c.names {
+		wg.Add(1)
+		go func(name string, check CheckFunc) {
+			defer wg.Done()
+
+			checkCtx, cancel := context.WithTimeout(ctx, checkTimeout)
+			defer cancel()
+
+			start := time.Now()
+			result, err := check(checkCtx)
+			if err != nil {
+				result.Status = StatusFail
+				result.Error = err.Error()
+			}
+			if result.Status == "" {
+				result.Status = StatusOK
+			}
+			result.LatencyMS = time.Since(start).Milliseconds()
+
+			mu.Lock()
+			report.Checks[name] = result
+			if result.Status == StatusFail {
+				report.Status = StatusFail
+			}
+			mu.Unlock()
+		}(name, c.checks[name])
+	}
+	wg.Wait()
+
+	return report
+}
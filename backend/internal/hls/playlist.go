@@ -0,0 +1,78 @@
+package hls
+
+import (
+	"bufio"
+	"bytes"
+	"regexp"
+	"strings"
+)
+
+// uriAttr encontra atributos URI="..." em tags como EXT-X-KEY e EXT-X-MAP.
+var uriAttr = regexp.MustCompile(`URI="([^"]*)"`)
+
+// RewriteFunc recebe uma URI encontrada na playlist e retorna a URI que deve
+// substituí-la.
+type RewriteFunc func(uri string) (string, error)
+
+// IsPlaylist indica se o nome de arquivo corresponde a uma playlist HLS.
+func IsPlaylist(name string) bool {
+	return strings.HasSuffix(name, ".m3u8")
+}
+
+// RewriteURIs reescreve todas as URIs de uma playlist HLS (master ou de
+// mídia): as linhas de URI e os atributos URI="..." das tags.
+func RewriteURIs(playlist []byte, rewrite RewriteFunc) ([]byte, error) {
+	var out bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(playlist))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case trimmed == "":
+			// Linhas em branco são mantidas como estão
+		case strings.HasPrefix(trimmed, "#"):
+			if strings.HasPrefix(trimmed, "#EXT") && uriAttr.MatchString(trimmed) {
+				var rewriteErr error
+				line = uriAttr.ReplaceAllStringFunc(trimmed, func(match string) string {
+					uri := uriAttr.FindStringSubmatch(match)[1]
+					newURI, err := rewrite(uri)
+					if err != nil {
+						rewriteErr = err
+						return match
+					}
+					return `URI="` + newURI + `"`
+				})
+				if rewriteErr != nil {
+					return nil, rewriteErr
+				}
+			}
+		default:
+			newURI, err := rewrite(trimmed)
+			if err != nil {
+				return nil, err
+			}
+			line = newURI
+		}
+
+		out.WriteString(line)
+		out.WriteByte('\n')
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// URIs retorna todas as URIs referenciadas pela playlist, na ordem em que
+// aparecem.
+func URIs(playlist []byte) ([]string, error) {
+	var uris []string
+	_, err := RewriteURIs(playlist, func(uri string) (string, error) {
+		uris = append(uris, uri)
+		return uri, nil
+	})
+	return uris, err
+}
@@ -0,0 +1,91 @@
+package hls
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRewriteURIs(t *testing.T) {
+	prefix := func(uri string) (string, error) { return "v1/" + uri, nil }
+	tests := []struct {
+		name     string
+		playlist string
+		want     string
+	}{
+		{
+			"master",
+			"#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=800000,RESOLUTION=640x360\n360p/playlist.m3u8\n",
+			"#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=800000,RESOLUTION=640x360\nv1/360p/playlist.m3u8\n",
+		},
+		{
+			"chave e init de fMP4",
+			"#EXTM3U\n#EXT-X-KEY:METHOD=AES-128,URI=\"/keys/k1\",IV=0x01\n#EXT-X-MAP:URI=\"init.mp4\"\n#EXTINF:4.0,\nseg_000.m4s\n",
+			"#EXTM3U\n#EXT-X-KEY:METHOD=AES-128,URI=\"v1//keys/k1\",IV=0x01\n#EXT-X-MAP:URI=\"v1/init.mp4\"\n#EXTINF:4.0,\nv1/seg_000.m4s\n",
+		},
+		{
+			"comentários e linhas em branco mantidos",
+			"#EXTM3U\n\n# URI=\"nao-e-tag\"\n#EXTINF:4.0,\nseg_000.ts\n",
+			"#EXTM3U\n\n# URI=\"nao-e-tag\"\n#EXTINF:4.0,\nv1/seg_000.ts\n",
+		},
+		{
+			"fim de linha CRLF e espaços",
+			"#EXTM3U\r\n#EXTINF:4.0,\r\n  seg_000.ts  \r\n",
+			"#EXTM3U\n#EXTINF:4.0,\nv1/seg_000.ts\n",
+		},
+		{
+			"sem quebra de linha no fim",
+			"#EXTM3U\nseg_000.ts",
+			"#EXTM3U\nv1/seg_000.ts\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := RewriteURIs([]byte(tt.playlist), prefix)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("RewriteURIs() =\n%s\nesperado\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRewriteURIsError(t *testing.T) {
+	errRejected := errors.New("URI recusada")
+	reject := func(uri string) (string, error) {
+		if strings.Contains(uri, "..") {
+			return "", errRejected
+		}
+		return uri, nil
+	}
+	tests := []struct {
+		name     string
+		playlist string
+	}{
+		{"linha de URI", "#EXTM3U\n#EXTINF:4.0,\n../outro/seg_000.ts\n"},
+		{"atributo de tag", "#EXTM3U\n#EXT-X-MAP:URI=\"../outro/init.mp4\"\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := RewriteURIs([]byte(tt.playlist), reject); !errors.Is(err, errRejected) {
+				t.Errorf("RewriteURIs() = %v, esperado %v", err, errRejected)
+			}
+		})
+	}
+}
+
+func TestURIs(t *testing.T) {
+	playlist := "#EXTM3U\n#EXT-X-KEY:METHOD=AES-128,URI=\"/keys/k1\"\n#EXT-X-MAP:URI=\"init.mp4\"\n#EXTINF:4.0,\nseg_000.m4s\n#EXTINF:4.0,\nseg_001.m4s\n"
+	want := []string{"/keys/k1", "init.mp4", "seg_000.m4s", "seg_001.m4s"}
+
+	got, err := URIs([]byte(playlist))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("URIs() = %v, esperado %v", got, want)
+	}
+}
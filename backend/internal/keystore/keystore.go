@@ -0,0 +1,143 @@
+package keystore
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// KeySize é o tamanho da chave AES-128 usada no HLS.
+const KeySize = 16
+
+var ErrKeyNotFound = errors.New("chave não encontrada")
+
+var validID = regexp.MustCompile(`^[a-f0-9]{32}$`)
+
+// Key é uma chave de conteúdo AES-128 usada para cifrar segmentos HLS de um
+// vídeo.
+type Key struct {
+	ID      string
+	VideoID string
+	Value   []byte
+	IV      []byte
+}
+
+// Store guarda as chaves de conteúdo fora do bucket de vídeos, de modo que
+// quem tem acesso aos segmentos não tem acesso às chaves. As chaves são
+// agrupadas por vídeo: só são encontradas pelo vídeo a que pertencem e saem
+// junto com as versões (ou com o vídeo) que as usam.
+type Store interface {
+	Put(ctx context.Context, key *Key) error
+	Get(ctx context.Context, videoID, id string) (*Key, error)
+	Delete(ctx context.Context, videoID string, ids []string) error
+	DeleteVideo(ctx context.Context, videoID string) error
+}
+
+// NewKey gera uma nova chave aleatória, com IV próprio, para o vídeo.
+func NewKey(videoID string) (*Key, error) {
+	buf := make([]byte, KeySize*3)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, fmt.Errorf("erro ao gerar chave: %v", err)
+	}
+	return &Key{
+		ID:      hex.EncodeToString(buf[:KeySize]),
+		VideoID: videoID,
+		Value:   buf[KeySize : KeySize*2],
+		IV:      buf[KeySize*2:],
+	}, nil
+}
+
+// ValidID indica se o ID tem o formato gerado por NewKey.
+func ValidID(id string) bool {
+	return validID.MatchString(id)
+}
+
+// validVideoID indica se o ID do vídeo pode virar um diretório sem sair do
+// diretório de chaves.
+func validVideoID(videoID string) bool {
+	return videoID != "" && videoID != "." && videoID != ".." && !strings.ContainsAny(videoID, `/\`)
+}
+
+// FileStore guarda cada chave em {dir}/{vídeo}/{id}.key. Chaves gravadas
+// antes do agrupamento por vídeo ficam em {dir}/{id}.key e continuam sendo
+// lidas.
+type FileStore struct {
+	dir string
+}
+
+// NewFileStore cria o diretório de chaves, com acesso restrito ao processo.
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("erro ao criar diretório de chaves '%s': %v", dir, err)
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+func (s *FileStore) Put(ctx context.Context, key *Key) error {
+	if !ValidID(key.ID) || !validVideoID(key.VideoID) || len(key.Value) != KeySize || len(key.IV) != KeySize {
+		return fmt.Errorf("chave inválida: %s", key.ID)
+	}
+	if err := os.MkdirAll(filepath.Join(s.dir, key.VideoID), 0700); err != nil {
+		return fmt.Errorf("erro ao criar diretório de chaves do vídeo %s: %v", key.VideoID, err)
+	}
+	data := append(append([]byte{}, key.Value...), key.IV...)
+	return os.WriteFile(s.path(key.VideoID, key.ID), data, 0600)
+}
+
+func (s *FileStore) Get(ctx context.Context, videoID, id string) (*Key, error) {
+	if !ValidID(id) || !validVideoID(videoID) {
+		return nil, ErrKeyNotFound
+	}
+	data, err := os.ReadFile(s.path(videoID, id))
+	if os.IsNotExist(err) {
+		data, err = os.ReadFile(filepath.Join(s.dir, id+".key"))
+	}
+	if os.IsNotExist(err) {
+		return nil, ErrKeyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(data) != KeySize*2 {
+		return nil, fmt.Errorf("arquivo de chave corrompido: %s", id)
+	}
+	return &Key{ID: id, VideoID: videoID, Value: data[:KeySize], IV: data[KeySize:]}, nil
+}
+
+// Delete remove as chaves informadas do vídeo. Chaves que não existem são
+// ignoradas.
+func (s *FileStore) Delete(ctx context.Context, videoID string, ids []string) error {
+	if !validVideoID(videoID) {
+		return fmt.Errorf("vídeo inválido: %s", videoID)
+	}
+	for _, id := range ids {
+		if !ValidID(id) {
+			continue
+		}
+		if err := os.Remove(s.path(videoID, id)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("erro ao remover chave %s: %v", id, err)
+		}
+	}
+	return nil
+}
+
+// DeleteVideo remove todas as chaves do vídeo.
+func (s *FileStore) DeleteVideo(ctx context.Context, videoID string) error {
+	if !validVideoID(videoID) {
+		return fmt.Errorf("vídeo inválido: %s", videoID)
+	}
+	if err := os.RemoveAll(filepath.Join(s.dir, videoID)); err != nil {
+		return fmt.Errorf("erro ao remover chaves do vídeo %s: %v", videoID, err)
+	}
+	return nil
+}
+
+func (s *FileStore) path(videoID, id string) string {
+	return filepath.Join(s.dir, videoID, id+".key")
+}
@@ -0,0 +1,326 @@
+package keystore
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"streaming-platform/internal/storage/storagetest"
+)
+
+func TestNewKey(t *testing.T) {
+	seen := map[string]bool{}
+	for i := 0; i < 16; i++ {
+		key, err := NewKey("video-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ValidID(key.ID) {
+			t.Errorf("ID inválido: %q", key.ID)
+		}
+		if len(key.Value) != KeySize || len(key.IV) != KeySize {
+			t.Errorf("chave com %d bytes e IV com %d, esperado %d", len(key.Value), len(key.IV), KeySize)
+		}
+		if bytes.Equal(key.Value, key.IV) {
+			t.Error("chave e IV iguais")
+		}
+		if key.VideoID != "video-1" {
+			t.Errorf("VideoID = %q", key.VideoID)
+		}
+		if seen[key.ID] {
+			t.Errorf("ID repetido: %s", key.ID)
+		}
+		seen[key.ID] = true
+	}
+}
+
+func TestValidID(t *testing.T) {
+	tests := []struct {
+		id   string
+		want bool
+	}{
+		{"0123456789abcdef0123456789abcdef", true},
+		{"0123456789ABCDEF0123456789ABCDEF", false},
+		{"0123456789abcdef", false},
+		{"../../../etc/passwd", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := ValidID(tt.id); got != tt.want {
+			t.Errorf("ValidID(%q) = %v, esperado %v", tt.id, got, tt.want)
+		}
+	}
+}
+
+func TestFileStoreGet(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := NewKey("video-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+
+	// Chave gravada antes do agrupamento por vídeo
+	legacy, _ := NewKey("")
+	legacyData := append(append([]byte{}, legacy.Value...), legacy.IV...)
+	if err := os.WriteFile(filepath.Join(store.dir, legacy.ID+".key"), legacyData, 0600); err != nil {
+		t.Fatal(err)
+	}
+	corrupted, _ := NewKey("video-1")
+	if err := os.WriteFile(store.path("video-1", corrupted.ID), []byte("curta"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		videoID string
+		id      string
+		want    *Key
+		wantErr error
+	}{
+		{"chave do vídeo", "video-1", key.ID, key, nil},
+		{"chave de outro vídeo", "video-2", key.ID, nil, ErrKeyNotFound},
+		{"chave inexistente", "video-1", "0123456789abcdef0123456789abcdef", nil, ErrKeyNotFound},
+		{"ID inválido", "video-1", "../video-1", nil, ErrKeyNotFound},
+		{"vídeo inválido", "..", key.ID, nil, ErrKeyNotFound},
+		{"layout antigo", "video-3", legacy.ID, legacy, nil},
+		{"arquivo corrompido", "video-1", corrupted.ID, nil, errors.New("corrompido")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := store.Get(ctx, tt.videoID, tt.id)
+			switch {
+			case tt.wantErr == nil && err != nil:
+				t.Fatalf("Get() erro inesperado: %v", err)
+			case tt.wantErr != nil && err == nil:
+				t.Fatalf("Get() sem erro, esperado %v", tt.wantErr)
+			case errors.Is(tt.wantErr, ErrKeyNotFound) && !errors.Is(err, ErrKeyNotFound):
+				t.Fatalf("Get() = %v, esperado %v", err, tt.wantErr)
+			}
+			if tt.want == nil {
+				return
+			}
+			if got.ID != tt.want.ID || got.VideoID != tt.videoID {
+				t.Errorf("Get() = %s/%s, esperado %s/%s", got.VideoID, got.ID, tt.videoID, tt.want.ID)
+			}
+			if !bytes.Equal(got.Value, tt.want.Value) || !bytes.Equal(got.IV, tt.want.IV) {
+				t.Error("chave ou IV diferentes dos gravados")
+			}
+		})
+	}
+}
+
+func TestFileStorePutRejectsInvalidKeys(t *testing.T) {
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid, _ := NewKey("video-1")
+
+	tests := []struct {
+		name string
+		key  Key
+	}{
+		{"ID inválido", Key{ID: "abc", VideoID: "video-1", Value: valid.Value, IV: valid.IV}},
+		{"sem vídeo", Key{ID: valid.ID, Value: valid.Value, IV: valid.IV}},
+		{"vídeo com barra", Key{ID: valid.ID, VideoID: "../fora", Value: valid.Value, IV: valid.IV}},
+		{"chave curta", Key{ID: valid.ID, VideoID: "video-1", Value: valid.Value[:8], IV: valid.IV}},
+		{"IV curto", Key{ID: valid.ID, VideoID: "video-1", Value: valid.Value, IV: valid.IV[:8]}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := store.Put(context.Background(), &tt.key); err == nil {
+				t.Error("Put() aceitou chave inválida")
+			}
+		})
+	}
+}
+
+// A chave e o IV lidos de volta decifram o que foi cifrado com os originais,
+// como o player faz com os segmentos AES-128-CBC.
+func TestFileStoreKeyDecrypts(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		plain []byte
+	}{
+		{"um bloco", bytes.Repeat([]byte{0x47}, aes.BlockSize)},
+		{"vários blocos", bytes.Repeat([]byte("segmento ts "), 64)[:aes.BlockSize*12]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := NewKey("video-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := store.Put(ctx, key); err != nil {
+				t.Fatal(err)
+			}
+			block, err := aes.NewCipher(key.Value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			encrypted := make([]byte, len(tt.plain))
+			cipher.NewCBCEncrypter(block, key.IV).CryptBlocks(encrypted, tt.plain)
+
+			stored, err := store.Get(ctx, "video-1", key.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			block, err = aes.NewCipher(stored.Value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			decrypted := make([]byte, len(encrypted))
+			cipher.NewCBCDecrypter(block, stored.IV).CryptBlocks(decrypted, encrypted)
+			if !bytes.Equal(decrypted, tt.plain) {
+				t.Error("conteúdo decifrado difere do original")
+			}
+		})
+	}
+}
+
+func TestFileStoreDelete(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	put := func(videoID string) *Key {
+		key, err := NewKey(videoID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Put(ctx, key); err != nil {
+			t.Fatal(err)
+		}
+		return key
+	}
+	v1a, v1b, v1c, v2 := put("video-1"), put("video-1"), put("video-1"), put("video-2")
+
+	tests := []struct {
+		name    string
+		delete  func() error
+		gone    []*Key
+		present []*Key
+	}{
+		{
+			"chaves de uma versão",
+			func() error { return store.Delete(ctx, "video-1", []string{v1a.ID, v1b.ID}) },
+			[]*Key{v1a, v1b},
+			[]*Key{v1c, v2},
+		},
+		{
+			"chaves já removidas",
+			func() error { return store.Delete(ctx, "video-1", []string{v1a.ID, "inválido"}) },
+			[]*Key{v1a},
+			[]*Key{v1c, v2},
+		},
+		{
+			"ID de outro vídeo",
+			func() error { return store.Delete(ctx, "video-1", []string{v2.ID}) },
+			nil,
+			[]*Key{v1c, v2},
+		},
+		{
+			"vídeo inteiro",
+			func() error { return store.DeleteVideo(ctx, "video-1") },
+			[]*Key{v1c},
+			[]*Key{v2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.delete(); err != nil {
+				t.Fatal(err)
+			}
+			for _, key := range tt.gone {
+				if _, err := store.Get(ctx, key.VideoID, key.ID); !errors.Is(err, ErrKeyNotFound) {
+					t.Errorf("chave %s/%s ainda existe (%v)", key.VideoID, key.ID, err)
+				}
+			}
+			for _, key := range tt.present {
+				if _, err := store.Get(ctx, key.VideoID, key.ID); err != nil {
+					t.Errorf("chave %s/%s removida: %v", key.VideoID, key.ID, err)
+				}
+			}
+		})
+	}
+
+	if err := store.DeleteVideo(ctx, ".."); err == nil {
+		t.Error("DeleteVideo aceitou um vídeo fora do diretório de chaves")
+	}
+}
+
+func TestS3Store(t *testing.T) {
+	ctx := context.Background()
+	fake := storagetest.NewServer()
+	store := NewS3Store(fake.Client(t))
+	put := func(videoID string) *Key {
+		key, err := NewKey(videoID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Put(ctx, key); err != nil {
+			t.Fatal(err)
+		}
+		return key
+	}
+	v1a, _, v2 := put("video-1"), put("video-1"), put("video-2")
+	corrupted, _ := NewKey("video-2")
+	fake.Set(store.key("video-2", corrupted.ID), []byte("curta"))
+
+	got, err := store.Get(ctx, "video-1", v1a.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.Value, v1a.Value) || !bytes.Equal(got.IV, v1a.IV) {
+		t.Error("chave ou IV diferentes dos gravados")
+	}
+	for name, get := range map[string]func() error{
+		"chave de outro vídeo": func() error { _, err := store.Get(ctx, "video-2", v1a.ID); return err },
+		"ID inválido":          func() error { _, err := store.Get(ctx, "video-1", "../video-1"); return err },
+	} {
+		if err := get(); !errors.Is(err, ErrKeyNotFound) {
+			t.Errorf("%s: Get() = %v, esperado %v", name, err, ErrKeyNotFound)
+		}
+	}
+	if _, err := store.Get(ctx, "video-2", corrupted.ID); err == nil || errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("arquivo corrompido: Get() = %v", err)
+	}
+
+	if err := store.Delete(ctx, "video-1", []string{v1a.ID, "inválido"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get(ctx, "video-1", v1a.ID); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("chave removida: Get() = %v", err)
+	}
+	if err := store.DeleteVideo(ctx, "video-1"); err != nil {
+		t.Fatal(err)
+	}
+	if keys := fake.Keys(keysPrefix + "video-1/"); len(keys) != 0 {
+		t.Errorf("chaves do vídeo depois de DeleteVideo: %v", keys)
+	}
+	if _, err := store.Get(ctx, "video-2", v2.ID); err != nil {
+		t.Errorf("chave de outro vídeo removida: %v", err)
+	}
+	if err := store.DeleteVideo(ctx, ".."); err == nil {
+		t.Error("DeleteVideo aceitou um vídeo inválido")
+	}
+}
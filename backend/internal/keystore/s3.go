@@ -0,0 +1,101 @@
+package keystore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+
+	"streaming-platform/internal/storage"
+)
+
+const keysPrefix = "keys/"
+
+// S3Store guarda cada chave em keys/{vídeo}/{id}.key de um bucket privado,
+// separado do bucket de vídeos. Diferente do FileStore, as chaves ficam
+// visíveis para todas as réplicas: a API entrega as chaves que os workers
+// gravaram, e o fsck e o streamctl removem as chaves de qualquer máquina.
+type S3Store struct {
+	S3Client *storage.S3Client
+}
+
+func NewS3Store(s3Client *storage.S3Client) *S3Store {
+	return &S3Store{S3Client: s3Client}
+}
+
+// Open retorna o S3Store do bucket informado ou, sem bucket, o FileStore do
+// diretório dir.
+func Open(bucket, region, dir string) (Store, error) {
+	if bucket == "" {
+		store, err := NewFileStore(dir)
+		if err != nil {
+			return nil, err
+		}
+		return store, nil
+	}
+	s3Client, err := storage.NewS3Client(bucket, region)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao inicializar cliente S3 das chaves: %v", err)
+	}
+	return NewS3Store(s3Client), nil
+}
+
+func (s *S3Store) Put(ctx context.Context, key *Key) error {
+	if !ValidID(key.ID) || !validVideoID(key.VideoID) || len(key.Value) != KeySize || len(key.IV) != KeySize {
+		return fmt.Errorf("chave inválida: %s", key.ID)
+	}
+	data := append(append([]byte{}, key.Value...), key.IV...)
+	if err := s.S3Client.Put(ctx, s.key(key.VideoID, key.ID), bytes.NewReader(data)); err != nil {
+		return fmt.Errorf("erro ao gravar chave %s: %v", key.ID, err)
+	}
+	return nil
+}
+
+func (s *S3Store) Get(ctx context.Context, videoID, id string) (*Key, error) {
+	if !ValidID(id) || !validVideoID(videoID) {
+		return nil, ErrKeyNotFound
+	}
+	data, err := s.S3Client.DownloadFile(ctx, s.key(videoID, id))
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, ErrKeyNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("erro ao ler chave %s: %v", id, err)
+	}
+	if len(data) != KeySize*2 {
+		return nil, fmt.Errorf("arquivo de chave corrompido: %s", id)
+	}
+	return &Key{ID: id, VideoID: videoID, Value: data[:KeySize], IV: data[KeySize:]}, nil
+}
+
+// Delete remove as chaves informadas do vídeo. Chaves que não existem são
+// ignoradas.
+func (s *S3Store) Delete(ctx context.Context, videoID string, ids []string) error {
+	if !validVideoID(videoID) {
+		return fmt.Errorf("vídeo inválido: %s", videoID)
+	}
+	for _, id := range ids {
+		if !ValidID(id) {
+			continue
+		}
+		if err := s.S3Client.Delete(ctx, s.key(videoID, id)); err != nil {
+			return fmt.Errorf("erro ao remover chave %s: %v", id, err)
+		}
+	}
+	return nil
+}
+
+// DeleteVideo remove todas as chaves do vídeo.
+func (s *S3Store) DeleteVideo(ctx context.Context, videoID string) error {
+	if !validVideoID(videoID) {
+		return fmt.Errorf("vídeo inválido: %s", videoID)
+	}
+	if _, err := s.S3Client.DeletePrefix(ctx, keysPrefix+videoID+"/"); err != nil {
+		return fmt.Errorf("erro ao remover chaves do vídeo %s: %v", videoID, err)
+	}
+	return nil
+}
+
+func (s *S3Store) key(videoID, id string) string {
+	return keysPrefix + videoID + "/" + id + ".key"
+}
@@ -0,0 +1,258 @@
+// Package lease coordena o processamento entre réplicas do backend. Antes de
+// processar um job, a instância grava um objeto de lease no bucket com uma
+// escrita condicional; só quem conseguiu gravar processa. O lease é renovado
+// periodicamente e expira se a instância cair, para que outra réplica possa
+// assumir o job.
+package lease
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"streaming-platform/internal/storage"
+)
+
+const leasesPrefix = "catalog/leases/"
+
+var (
+	// ErrHeld indica que outra instância detém um lease válido do job.
+	ErrHeld = errors.New("job em processamento por outra instância")
+	// ErrLost indica que o lease expirou ou foi assumido por outra instância
+	// durante o processamento.
+	ErrLost = errors.New("lease do job perdido")
+)
+
+// Record é o conteúdo do objeto de lease. As datas vêm do relógio de quem
+// gravou: as réplicas precisam de relógios sincronizados (NTP) com folga bem
+// menor que o TTL.
+type Record struct {
+	JobID      string    `json:"jobId"`
+	Holder     string    `json:"holder"`
+	AcquiredAt time.Time `json:"acquiredAt"`
+	RenewedAt  time.Time `json:"renewedAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+}
+
+// Expired indica se o lease já pode ser assumido por outra instância.
+func (r *Record) Expired() bool {
+	return time.Now().After(r.ExpiresAt)
+}
+
+// Manager obtém e renova os leases desta instância (Holder). Um lease dura
+// TTL sem renovação; a renovação acontece a cada TTL/3.
+type Manager struct {
+	S3Client *storage.S3Client
+	Holder   string
+	TTL      time.Duration
+}
+
+func NewManager(s3Client *storage.S3Client, holder string, ttl time.Duration) *Manager {
+	return &Manager{
+		S3Client: s3Client,
+		Holder:   holder,
+		TTL:      ttl,
+	}
+}
+
+// DefaultHolder identifica a instância pelo hostname e pelo PID.
+func DefaultHolder() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "desconhecido"
+	}
+	return host + ":" + strconv.Itoa(os.Getpid())
+}
+
+func key(jobID string) string {
+	return leasesPrefix + jobID + ".json"
+}
+
+// Lease é um lease obtido por esta instância.
+type Lease struct {
+	Record
+
+	manager *Manager
+	mu      sync.Mutex
+	etag    string
+	stop    chan struct{}
+	done    chan struct{} // fechado quando a renovação de Keep termina
+	once    sync.Once
+}
+
+// Acquire obtém o lease do job. Se outra instância detém um lease válido,
+// retorna ErrHeld; um lease expirado é assumido.
+func (m *Manager) Acquire(ctx context.Context, jobID string) (*Lease, error) {
+	now := time.Now().UTC()
+	record := Record{
+		JobID:      jobID,
+		Holder:     m.Holder,
+		AcquiredAt: now,
+		RenewedAt:  now,
+		ExpiresAt:  now.Add(m.TTL),
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+
+	etag, err := m.S3Client.PutIfAbsent(ctx, key(jobID), data)
+	if errors.Is(err, storage.ErrPreconditionFailed) {
+		// Já existe um lease: só pode ser assumido se tiver expirado
+		var current *Record
+		var currentETag string
+		current, currentETag, err = m.get(ctx, jobID)
+		if errors.Is(err, storage.ErrNotFound) {
+			// Liberado entre as duas chamadas: tenta de novo na próxima varredura
+			return nil, fmt.Errorf("%w: lease liberado durante a disputa", ErrHeld)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !current.Expired() {
+			return nil, fmt.Errorf("%w (%s até %s)", ErrHeld, current.Holder, current.ExpiresAt.Format(time.RFC3339))
+		}
+
+		etag, err = m.S3Client.PutIfMatch(ctx, key(jobID), data, currentETag)
+		if errors.Is(err, storage.ErrPreconditionFailed) {
+			return nil, fmt.Errorf("%w: outra instância assumiu o lease expirado", ErrHeld)
+		}
+		if err == nil {
+			slog.WarnContext(ctx, "lease expirado assumido", "job_id", jobID, "previous_holder", current.Holder, "expired_at", current.ExpiresAt)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("erro ao obter lease do job %s: %w", jobID, err)
+	}
+
+	return &Lease{
+		Record:  record,
+		manager: m,
+		etag:    etag,
+		stop:    make(chan struct{}),
+	}, nil
+}
+
+// Get retorna o lease atual do job, ou storage.ErrNotFound.
+func (m *Manager) Get(ctx context.Context, jobID string) (*Record, error) {
+	record, _, err := m.get(ctx, jobID)
+	return record, err
+}
+
+func (m *Manager) get(ctx context.Context, jobID string) (*Record, string, error) {
+	object, err := m.S3Client.GetObject(ctx, key(jobID), storage.ObjectOptions{})
+	if err != nil {
+		return nil, "", err
+	}
+	defer object.Body.Close()
+
+	data, err := io.ReadAll(object.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	var record Record
+	if err := json.Unmarshal(data, &record); err != nil {
+		// Lease corrompido: tratado como expirado para não travar o job
+		slog.WarnContext(ctx, "lease corrompido", "job_id", jobID, "error", err)
+		return &Record{JobID: jobID}, object.ETag, nil
+	}
+	return &record, object.ETag, nil
+}
+
+// Keep renova o lease em segundo plano até Release e retorna um contexto que
+// é cancelado (com causa ErrLost) se o lease for perdido.
+func (l *Lease) Keep(ctx context.Context) context.Context {
+	ctx, cancel := context.WithCancelCause(ctx)
+	l.done = make(chan struct{})
+	go func() {
+		defer close(l.done)
+		defer cancel(nil)
+
+		ticker := time.NewTicker(l.manager.TTL / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-l.stop:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			err := l.renew(ctx)
+			if err == nil {
+				continue
+			}
+			if errors.Is(err, ErrLost) || time.Now().After(l.expiresAt()) {
+				slog.ErrorContext(ctx, "lease perdido, interrompendo processamento", "job_id", l.JobID, "error", err)
+				cancel(ErrLost)
+				return
+			}
+			// Falha transitória: tenta de novo no próximo tique, antes de expirar
+			slog.WarnContext(ctx, "erro ao renovar lease", "job_id", l.JobID, "error", err)
+		}
+	}()
+	return ctx
+}
+
+func (l *Lease) renew(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	record := l.Record
+	record.RenewedAt = time.Now().UTC()
+	record.ExpiresAt = record.RenewedAt.Add(l.manager.TTL)
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	etag, err := l.manager.S3Client.PutIfMatch(ctx, key(l.JobID), data, l.etag)
+	// O S3 responde 404 a um If-Match em chave removida
+	if errors.Is(err, storage.ErrPreconditionFailed) || errors.Is(err, storage.ErrNotFound) {
+		return ErrLost
+	}
+	if err != nil {
+		return err
+	}
+	l.Record, l.etag = record, etag
+	return nil
+}
+
+func (l *Lease) expiresAt() time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.ExpiresAt
+}
+
+// Release para a renovação e remove o lease, se ele ainda for desta
+// instância: a remoção é condicional ao ETag da última gravação, então um
+// lease assumido por outra instância fica. Pode ser chamado mais de uma vez.
+func (l *Lease) Release(ctx context.Context) {
+	l.once.Do(func() {
+		close(l.stop)
+		if l.done != nil {
+			<-l.done
+		}
+
+		l.mu.Lock()
+		etag := l.etag
+		l.mu.Unlock()
+		err := l.manager.S3Client.DeleteIfMatch(ctx, key(l.JobID), etag)
+		if errors.Is(err, storage.ErrPreconditionFailed) || errors.Is(err, storage.ErrNotFound) {
+			// Assumido por outra instância ou já removido
+			return
+		}
+		if err != nil {
+			// O lease expira sozinho
+			slog.WarnContext(ctx, "erro ao liberar lease", "job_id", l.JobID, "error", err)
+		}
+	})
+}
@@ -0,0 +1,206 @@
+package lease
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"streaming-platform/internal/storage"
+	"streaming-platform/internal/storage/storagetest"
+)
+
+func record(t *testing.T, holder string, expiresAt time.Time) []byte {
+	t.Helper()
+	data, err := json.Marshal(Record{JobID: "video.mp4", Holder: holder, ExpiresAt: expiresAt})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestPutConditional(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name      string
+		existing  bool
+		conflicts int
+		put       func(c *storage.S3Client, etag string) (string, error)
+		want      error
+	}{
+		{"PutIfAbsent em chave livre", false, 0, func(c *storage.S3Client, _ string) (string, error) {
+			return c.PutIfAbsent(ctx, "k", []byte("novo"))
+		}, nil},
+		{"PutIfAbsent em chave existente", true, 0, func(c *storage.S3Client, _ string) (string, error) {
+			return c.PutIfAbsent(ctx, "k", []byte("novo"))
+		}, storage.ErrPreconditionFailed},
+		{"PutIfAbsent com 409", false, 1, func(c *storage.S3Client, _ string) (string, error) {
+			return c.PutIfAbsent(ctx, "k", []byte("novo"))
+		}, storage.ErrPreconditionFailed},
+		{"PutIfMatch com ETag atual", true, 0, func(c *storage.S3Client, etag string) (string, error) {
+			return c.PutIfMatch(ctx, "k", []byte("novo"), etag)
+		}, nil},
+		{"PutIfMatch com ETag antigo", true, 0, func(c *storage.S3Client, _ string) (string, error) {
+			return c.PutIfMatch(ctx, "k", []byte("novo"), `"antigo"`)
+		}, storage.ErrPreconditionFailed},
+		{"PutIfMatch com 409", true, 1, func(c *storage.S3Client, etag string) (string, error) {
+			return c.PutIfMatch(ctx, "k", []byte("novo"), etag)
+		}, storage.ErrPreconditionFailed},
+		{"PutIfMatch em chave removida", false, 0, func(c *storage.S3Client, _ string) (string, error) {
+			return c.PutIfMatch(ctx, "k", []byte("novo"), `"antigo"`)
+		}, storage.ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := storagetest.NewServer()
+			client := fake.Client(t)
+			var etag string
+			if tt.existing {
+				fake.Set("k", []byte("atual"))
+				object, _ := fake.Get("k")
+				etag = object.ETag
+			}
+			fake.Conflicts = tt.conflicts
+
+			got, err := tt.put(client, etag)
+			if !errors.Is(err, tt.want) || (tt.want == nil && err != nil) {
+				t.Fatalf("erro = %v, esperado %v", err, tt.want)
+			}
+			object, _ := fake.Get("k")
+			if tt.want == nil && (got != object.ETag || string(object.Data) != "novo") {
+				t.Errorf("ETag = %s e conteúdo %q; esperado %s e \"novo\"", got, object.Data, object.ETag)
+			}
+			if tt.want != nil && string(object.Data) == "novo" {
+				t.Error("escrita condicional recusada alterou o objeto")
+			}
+		})
+	}
+}
+
+func TestAcquire(t *testing.T) {
+	tests := []struct {
+		name       string
+		existing   []byte
+		conflicts  int
+		wantErr    error
+		wantHolder string
+	}{
+		{"lease livre", nil, 0, nil, "eu"},
+		{"lease válido de outra instância", record(t, "outra", time.Now().Add(time.Minute)), 0, ErrHeld, "outra"},
+		{"lease expirado", record(t, "outra", time.Now().Add(-time.Second)), 0, nil, "eu"},
+		{"lease corrompido", []byte("{"), 0, nil, "eu"},
+		{"disputa em andamento (409)", nil, 1, ErrHeld, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := storagetest.NewServer()
+			manager := NewManager(fake.Client(t), "eu", time.Minute)
+			if tt.existing != nil {
+				fake.Set(key("video.mp4"), tt.existing)
+			}
+			fake.Conflicts = tt.conflicts
+
+			l, err := manager.Acquire(context.Background(), "video.mp4")
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Fatalf("Acquire() = %v, esperado %v", err, tt.wantErr)
+			}
+			if l != nil && (l.Holder != "eu" || !l.ExpiresAt.After(time.Now())) {
+				t.Errorf("lease = %+v", l.Record)
+			}
+
+			current, err := manager.Get(context.Background(), "video.mp4")
+			if tt.wantHolder == "" {
+				if !errors.Is(err, storage.ErrNotFound) {
+					t.Errorf("Get() = %v, %v; esperado sem lease", current, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if current.Holder != tt.wantHolder {
+				t.Errorf("dono do lease = %s, esperado %s", current.Holder, tt.wantHolder)
+			}
+		})
+	}
+}
+
+func TestRenew(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(f *storagetest.Server)
+		wantErr error
+	}{
+		{"lease intacto", func(*storagetest.Server) {}, nil},
+		{"assumido por outra instância", func(f *storagetest.Server) {
+			f.Set(key("video.mp4"), record(t, "outra", time.Now().Add(time.Minute)))
+		}, ErrLost},
+		{"lease removido", func(f *storagetest.Server) {
+			f.Remove(key("video.mp4"))
+		}, ErrLost},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := storagetest.NewServer()
+			manager := NewManager(fake.Client(t), "eu", time.Minute)
+			l, err := manager.Acquire(context.Background(), "video.mp4")
+			if err != nil {
+				t.Fatal(err)
+			}
+			previous := l.ExpiresAt
+			tt.change(fake)
+
+			err = l.renew(context.Background())
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Fatalf("renew() = %v, esperado %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil {
+				object, _ := fake.Get(key("video.mp4"))
+				if l.etag != object.ETag || l.ExpiresAt.Before(previous) {
+					t.Errorf("renovação não registrada: etag %s (bucket %s)", l.etag, object.ETag)
+				}
+			}
+		})
+	}
+}
+
+func TestRelease(t *testing.T) {
+	tests := []struct {
+		name     string
+		change   func(fake *storagetest.Server)
+		wantKept bool
+	}{
+		{"lease próprio é removido", nil, false},
+		{"lease de outra instância fica", func(fake *storagetest.Server) {
+			fake.Set(key("video.mp4"), record(t, "outra", time.Now().Add(time.Minute)))
+		}, true},
+		// Mesmo com o mesmo Holder (a instância reiniciada com o mesmo ID), o
+		// lease regravado não é desta Lease
+		{"lease regravado com o mesmo dono fica", func(fake *storagetest.Server) {
+			fake.Set(key("video.mp4"), record(t, "eu", time.Now().Add(2*time.Minute)))
+		}, true},
+		{"lease já removido", func(fake *storagetest.Server) {
+			fake.Remove(key("video.mp4"))
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := storagetest.NewServer()
+			manager := NewManager(fake.Client(t), "eu", time.Minute)
+			l, err := manager.Acquire(context.Background(), "video.mp4")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.change != nil {
+				tt.change(fake)
+			}
+
+			l.Release(context.Background())
+			l.Release(context.Background())
+			if _, kept := fake.Get(key("video.mp4")); kept != tt.wantKept {
+				t.Errorf("lease no bucket = %v, esperado %v", kept, tt.wantKept)
+			}
+		})
+	}
+}
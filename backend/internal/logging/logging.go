@@ -0,0 +1,103 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// level permite trocar o nível depois que a configuração é carregada.
+var level = new(slog.LevelVar)
+
+type contextKey struct{}
+
+// Setup instala um logger JSON como padrão do processo. As chamadas ao
+// pacote log também passam a sair em JSON, no nível info.
+func Setup(levelName string) error {
+	handler := slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: level})
+	slog.SetDefault(slog.New(&contextHandler{Handler: handler}))
+	return SetLevel(levelName)
+}
+
+// SetLevel altera o nível mínimo dos logs (debug, info, warn ou error).
+func SetLevel(levelName string) error {
+	if levelName == "" {
+		levelName = "info"
+	}
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(strings.ToLower(levelName))); err != nil {
+		return fmt.Errorf("nível de log inválido '%s'", levelName)
+	}
+	level.Set(l)
+	return nil
+}
+
+// With retorna um contexto cujos logs carregam os atributos informados, além
+// dos que já estavam no contexto (por exemplo request_id, job_id, video_id).
+func With(ctx context.Context, args ...any) context.Context {
+	attrs := append(attrsFrom(ctx), argsToAttrs(args)...)
+	return context.WithValue(ctx, contextKey{}, attrs)
+}
+
+// Attr retorna o valor de um atributo guardado no contexto com With.
+func Attr(ctx context.Context, key string) string {
+	for _, attr := range attrsFrom(ctx) {
+		if attr.Key == key {
+			return attr.Value.String()
+		}
+	}
+	return ""
+}
+
+func attrsFrom(ctx context.Context) []slog.Attr {
+	attrs, _ := ctx.Value(contextKey{}).([]slog.Attr)
+	return attrs[:len(attrs):len(attrs)]
+}
+
+func argsToAttrs(args []any) []slog.Attr {
+	var r slog.Record
+	r.Add(args...)
+	attrs := make([]slog.Attr, 0, r.NumAttrs())
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, a)
+		return true
+	})
+	return attrs
+}
+
+// contextHandler acrescenta a cada registro os atributos do contexto e os
+// IDs do trace ativo, para correlacionar logs e traces.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if ctx != nil {
+		r.AddAttrs(attrsFrom(ctx)...)
+		if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+			r.AddAttrs(
+				slog.String("trace_id", sc.TraceID().String()),
+				slog.String("span_id", sc.SpanID().String()),
+			)
+		}
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithGroup(name)}
+}
+
+// Fatal registra o erro e encerra o processo.
+func Fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
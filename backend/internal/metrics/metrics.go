@@ -0,0 +1,208 @@
+package metrics
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "streaming"
+
+// Estados de um job de processamento
+const (
+	JobQueued     = "queued"
+	JobProcessing = "processing"
+	JobSucceeded  = "succeeded"
+	JobFailed     = "failed"
+)
+
+var (
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Duração das requisições HTTP por rota, método e status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	JobQueueDepth = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "job_queue_depth",
+		Help:      "Vídeos aguardando um worker livre.",
+	})
+
+	JobsByState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "jobs",
+		Help:      "Jobs de processamento em andamento por estado (queued, processing).",
+	}, []string{"state"})
+
+	JobsCompleted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "jobs_completed_total",
+		Help:      "Jobs de processamento finalizados por resultado.",
+	}, []string{"state"})
+
+	TranscodeDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "transcode_duration_seconds",
+		Help:      "Tempo de transcodificação de cada rendition.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 14),
+	}, []string{"quality"})
+
+	TranscodeRealtimeFactor = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "transcode_realtime_factor",
+		Help:      "Segundos de vídeo transcodificados por segundo de relógio, por rendition.",
+		Buckets:   []float64{0.25, 0.5, 1, 2, 4, 8, 16, 32},
+	}, []string{"quality"})
+
+	JobsDeadLettered = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "jobs_dead_lettered_total",
+		Help:      "Jobs movidos para a dead-letter depois de esgotar as tentativas.",
+	})
+
+	FFmpegFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "ffmpeg_failures_total",
+		Help:      "Execuções do ffmpeg que falharam, por etapa e motivo de saída.",
+	}, []string{"stage", "reason"})
+
+	StorageBytes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "storage_bytes_total",
+		Help:      "Bytes transferidos com o armazenamento, por direção.",
+	}, []string{"direction"})
+
+	FsckIssues = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "fsck_issues",
+		Help:      "Inconsistências encontradas no bucket na última verificação, por tipo.",
+	}, []string{"kind"})
+
+	FsckLastRun = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "fsck_last_run_timestamp_seconds",
+		Help:      "Momento da última verificação de consistência concluída.",
+	})
+
+	SchedulerThreadsInUse = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "scheduler_threads_in_use",
+		Help:      "Threads de CPU reservadas pelos jobs em andamento.",
+	})
+
+	SchedulerThreadsCapacity = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "scheduler_threads_capacity",
+		Help:      "Threads de CPU disponíveis para os jobs.",
+	})
+
+	SchedulerWaitingJobs = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "scheduler_waiting_jobs",
+		Help:      "Jobs aguardando threads de CPU livres para começar.",
+	})
+
+	ScratchReservedBytes = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "scratch_reserved_bytes",
+		Help:      "Espaço em disco reservado pelos processamentos em andamento.",
+	})
+
+	ScratchWaitingJobs = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "scratch_waiting_jobs",
+		Help:      "Processamentos aguardando espaço livre em disco.",
+	})
+
+	ScratchSweptDirs = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "scratch_swept_dirs_total",
+		Help:      "Diretórios de trabalho abandonados removidos pelo janitor.",
+	})
+
+	TempDirBytes = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "temp_dir_bytes",
+		Help:      "Bytes ocupados no diretório temporário usado pelos workers, medidos a cada limpeza do janitor.",
+	})
+
+	WebhookDeliveries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_deliveries_total",
+		Help:      "Tentativas de entrega de webhooks por evento e resultado (delivered, retry, failed).",
+	}, []string{"event", "result"})
+)
+
+// tempDir é o diretório de trabalho dos workers medido por
+// temp_fs_free_bytes; veja SetTempDir.
+var tempDir atomic.Value
+
+// SetTempDir troca o diretório medido por temp_fs_free_bytes (por padrão, o
+// diretório temporário do sistema). O espaço ocupado (temp_dir_bytes) é
+// medido pelo janitor, que já percorre o diretório, e não a cada coleta.
+func SetTempDir(dir string) {
+	tempDir.Store(dir)
+}
+
+func init() {
+	tempDir.Store(os.TempDir())
+
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "temp_fs_free_bytes",
+		Help:      "Bytes livres no sistema de arquivos do diretório temporário.",
+	}, func() float64 {
+		var stat syscall.Statfs_t
+		if err := syscall.Statfs(tempDir.Load().(string), &stat); err != nil {
+			return 0
+		}
+		return float64(stat.Bavail) * float64(stat.Bsize)
+	})
+}
+
+// Middleware registra a duração de cada requisição, agrupada pelo template
+// da rota (e não pela URL, para não explodir a cardinalidade). O roteador
+// não aplica os middlewares às requisições sem rota: elas só aparecem como
+// route="unmatched" se o NotFoundHandler e o MethodNotAllowedHandler também
+// passarem por aqui.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		route := "unmatched"
+		if current := mux.CurrentRoute(r); current != nil {
+			if tpl, err := current.GetPathTemplate(); err == nil {
+				route = tpl
+			}
+		}
+		HTTPRequestDuration.WithLabelValues(route, r.Method, strconv.Itoa(rec.status)).
+			Observe(time.Since(start).Seconds())
+	})
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
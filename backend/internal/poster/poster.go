@@ -0,0 +1,351 @@
+// Package poster escolhe e publica a capa (thumbnail) de cada vídeo.
+//
+// Em vez de um quadro fixo, que costuma cair na fusão do preto da abertura,
+// vários quadros espalhados pelo vídeo são pontuados (brilho, áreas pretas,
+// nitidez e troca de cena) e o melhor vai para thumbnails/{id}.jpg. Os
+// candidatos ficam em thumbnails/{id}/candidates/, já redimensionados, para
+// que um editor possa trocar a escolha pela API; a capa em uso é copiada do
+// candidato, com os tamanhos em thumbnails/{id}/sizes/ para as listas srcset.
+// Só o worker roda o ffmpeg: trocar a capa são cópias dentro do bucket. A
+// prévia animada do vídeo fica ao lado, em thumbnails/{id}/preview.mp4 e
+// preview.webp.
+package poster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"path/filepath"
+	"sort"
+
+	"streaming-platform/internal/catalog"
+	"streaming-platform/internal/services"
+	"streaming-platform/internal/storage"
+)
+
+// ThumbnailsPrefix é o prefixo das capas no bucket.
+const ThumbnailsPrefix = "thumbnails/"
+
+var (
+	// ErrUnknownCandidate indica um candidato que não existe no registro da
+	// capa.
+	ErrUnknownCandidate = errors.New("candidato a capa inexistente")
+	// ErrCandidatesChanged indica que os candidatos foram substituídos (por
+	// um reprocessamento) durante a escolha do editor.
+	ErrCandidatesChanged = errors.New("candidatos a capa substituídos durante a escolha")
+)
+
+// Key retorna a chave da capa escolhida: thumbnails/{id}.jpg.
+func Key(videoID string) string {
+	return ThumbnailsPrefix + videoID + ".jpg"
+}
+
+// Prefix retorna o prefixo dos demais arquivos da capa do vídeo.
+func Prefix(videoID string) string {
+	return ThumbnailsPrefix + videoID + "/"
+}
+
+// CandidateKey retorna a chave do candidato n.
+func CandidateKey(videoID string, n int) string {
+	return fmt.Sprintf("%scandidates/%02d.jpg", Prefix(videoID), n)
+}
+
+// CandidateSizeKey retorna a chave do candidato n redimensionado para a
+// largura e o formato informados.
+func CandidateSizeKey(videoID string, n, width int, format string) string {
+	return fmt.Sprintf("%scandidates/%02d/%s", Prefix(videoID), n, services.ThumbnailFile(width, format))
+}
+
+// SizeKey retorna a chave da capa redimensionada para a largura e o formato
+// informados.
+func SizeKey(videoID string, width int, format string) string {
+	return Prefix(videoID) + "sizes/" + services.ThumbnailFile(width, format)
+}
+
+// PreviewKey retorna a chave de um arquivo da prévia animada.
+func PreviewKey(videoID, file string) string {
+	return Prefix(videoID) + file
+}
+
+// Manager gera, publica e troca as capas. Candidates é quantos quadros são
+// avaliados por vídeo e Widths as larguras em que a capa é redimensionada.
+type Manager struct {
+	S3Client   *storage.S3Client
+	Catalog    *catalog.Store
+	Candidates int
+	Widths     []int
+}
+
+func NewManager(s3Client *storage.S3Client, store *catalog.Store, candidates int, widths []int) *Manager {
+	return &Manager{
+		S3Client:   s3Client,
+		Catalog:    store,
+		Candidates: candidates,
+		Widths:     widths,
+	}
+}
+
+// Generate extrai e pontua os candidatos do vídeo em dir e publica a capa.
+// Se nenhum candidato puder ser avaliado, publica o quadro de 1s, como antes.
+func (m *Manager) Generate(ctx context.Context, videoID, videoPath, dir string) error {
+	frames, err := services.SamplePosterFrames(ctx, videoPath, dir, m.Candidates)
+	if err != nil {
+		slog.WarnContext(ctx, "capa sem candidatos, usando o quadro de 1s", "video_id", videoID, "error", err)
+		fallback := filepath.Join(dir, "thumbnail.jpg")
+		if err := services.GenerateThumbnail(ctx, videoPath, fallback); err != nil {
+			return err
+		}
+		widths, err := m.publishImage(ctx, videoID, fallback, dir)
+		if err != nil {
+			return err
+		}
+		_, err = m.Catalog.UpdatePoster(ctx, videoID, func(poster *catalog.Poster) error {
+			poster.Selected, poster.SelectedBy = 0, catalog.PosterAuto
+			poster.Candidates = nil
+			poster.Widths = widths
+			return nil
+		})
+		return err
+	}
+	_, err = m.Publish(ctx, videoID, frames, dir)
+	return err
+}
+
+// Publish envia os candidatos e coloca o de maior pontuação como capa. Uma
+// escolha de editor é mantida se o mesmo quadro continua entre os candidatos
+// (reprocessar o mesmo original extrai os mesmos instantes).
+func (m *Manager) Publish(ctx context.Context, videoID string, frames []services.PosterFrame, dir string) (*catalog.Poster, error) {
+	previous, err := m.Catalog.GetPoster(ctx, videoID)
+	if err != nil && !errors.Is(err, catalog.ErrNotFound) {
+		return nil, err
+	}
+
+	// Os índices seguem a ordem no vídeo; a pontuação decide a escolha
+	ordered := append([]services.PosterFrame(nil), frames...)
+	sort.Slice(ordered, func(i, j int) bool {
+		return ordered[i].Time < ordered[j].Time
+	})
+
+	if _, err := m.S3Client.DeletePrefix(ctx, Prefix(videoID)+"candidates/"); err != nil {
+		return nil, fmt.Errorf("erro ao remover candidatos antigos de %s: %w", videoID, err)
+	}
+	next := &catalog.Poster{VideoID: videoID, SelectedBy: catalog.PosterAuto}
+	var best *services.PosterFrame
+	for i := range ordered {
+		frame := &ordered[i]
+		candidate := catalog.PosterCandidate{
+			Index:       i + 1,
+			Key:         CandidateKey(videoID, i+1),
+			Time:        math.Round(frame.Time*1000) / 1000,
+			Score:       frame.Score,
+			Luminance:   math.Round(frame.Luminance*1000) / 1000,
+			Blackness:   math.Round(frame.Blackness*1000) / 1000,
+			Sharpness:   frame.Sharpness,
+			SceneChange: frame.SceneChange,
+		}
+		widths, err := m.publishCandidate(ctx, videoID, candidate.Index, frame.Path, dir)
+		if err != nil {
+			return nil, err
+		}
+		candidate.Widths = widths
+		next.Candidates = append(next.Candidates, candidate)
+		if best == nil || frame.Score > best.Score {
+			best, next.Selected = frame, candidate.Index
+		}
+	}
+
+	if kept := editorChoice(previous, next); kept > 0 {
+		next.Selected, next.SelectedBy = kept, catalog.PosterEditor
+	}
+	selected := next.Candidate(next.Selected)
+	if err := m.install(ctx, videoID, selected); err != nil {
+		return nil, err
+	}
+	// A prévia animada é publicada em outra etapa e fica como está
+	poster, err := m.Catalog.UpdatePoster(ctx, videoID, func(poster *catalog.Poster) error {
+		poster.Candidates, poster.Selected, poster.SelectedBy = next.Candidates, next.Selected, next.SelectedBy
+		poster.Widths = selected.Widths
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	slog.InfoContext(ctx, "capa publicada", "video_id", videoID, "selected", poster.Selected,
+		"selected_by", poster.SelectedBy, "score", poster.Candidate(poster.Selected).Score)
+	return poster, nil
+}
+
+// editorChoice retorna o índice, entre os candidatos novos, do quadro que um
+// editor escolheu antes, ou 0.
+func editorChoice(previous, poster *catalog.Poster) int {
+	if previous == nil || previous.SelectedBy != catalog.PosterEditor {
+		return 0
+	}
+	chosen := previous.Candidate(previous.Selected)
+	if chosen == nil {
+		return 0
+	}
+	for _, candidate := range poster.Candidates {
+		if math.Abs(candidate.Time-chosen.Time) < 0.01 {
+			return candidate.Index
+		}
+	}
+	return 0
+}
+
+// Select coloca o candidato n como capa do vídeo, por escolha de um editor.
+// Os tamanhos do candidato já estão no bucket: a troca só copia objetos e
+// atualiza o registro, sem ffmpeg.
+func (m *Manager) Select(ctx context.Context, videoID string, n int) (*catalog.Poster, error) {
+	poster, err := m.Catalog.GetPoster(ctx, videoID)
+	if err != nil {
+		return nil, err
+	}
+	candidate := poster.Candidate(n)
+	if candidate == nil {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownCandidate, n)
+	}
+
+	if err := m.install(ctx, videoID, candidate); err != nil {
+		return nil, err
+	}
+	poster, err = m.Catalog.UpdatePoster(ctx, videoID, func(poster *catalog.Poster) error {
+		// Um reprocessamento pode ter trocado os candidatos desde a leitura
+		current := poster.Candidate(n)
+		if current == nil || current.Time != candidate.Time {
+			return ErrCandidatesChanged
+		}
+		poster.Selected, poster.SelectedBy = n, catalog.PosterEditor
+		poster.Widths = candidate.Widths
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	slog.InfoContext(ctx, "capa escolhida por editor", "video_id", videoID, "selected", n)
+	return poster, nil
+}
+
+// PublishPreview envia os arquivos da prévia animada gerados em dir e os
+// registra junto da capa.
+func (m *Manager) PublishPreview(ctx context.Context, videoID, dir string) error {
+	var previews []string
+	for _, file := range services.PreviewFiles {
+		key := PreviewKey(videoID, file)
+		if err := m.S3Client.UploadFileFromPath(ctx, key, filepath.Join(dir, file)); err != nil {
+			return fmt.Errorf("erro ao enviar prévia animada %s: %w", key, err)
+		}
+		previews = append(previews, key)
+	}
+	_, err := m.Catalog.UpdatePoster(ctx, videoID, func(poster *catalog.Poster) error {
+		poster.Previews = previews
+		return nil
+	})
+	return err
+}
+
+// publishImage envia a imagem como capa, junto com as versões
+// redimensionadas, e retorna as larguras geradas para o registro. Só serve
+// ao quadro de 1s, que não tem candidatos.
+func (m *Manager) publishImage(ctx context.Context, videoID, imagePath, dir string) ([]int, error) {
+	widths, err := services.ResizeThumbnail(ctx, imagePath, filepath.Join(dir, "sizes"), m.Widths)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.S3Client.UploadFileFromPath(ctx, Key(videoID), imagePath); err != nil {
+		return nil, fmt.Errorf("erro ao enviar capa de %s: %w", videoID, err)
+	}
+	// Os tamanhos novos sobrescrevem os antigos no lugar, para que as URLs
+	// em uso nunca fiquem sem imagem
+	uploaded := map[string]bool{}
+	for _, width := range widths {
+		for _, format := range services.ThumbnailFormats {
+			key := SizeKey(videoID, width, format)
+			local := filepath.Join(dir, "sizes", services.ThumbnailFile(width, format))
+			if err := m.S3Client.UploadFileFromPath(ctx, key, local); err != nil {
+				return nil, fmt.Errorf("erro ao enviar miniatura de %s: %w", videoID, err)
+			}
+			uploaded[key] = true
+		}
+	}
+	return widths, m.removeStaleSizes(ctx, videoID, uploaded)
+}
+
+// publishCandidate envia o candidato n e as versões redimensionadas dele, e
+// retorna as larguras geradas.
+func (m *Manager) publishCandidate(ctx context.Context, videoID string, n int, imagePath, dir string) ([]int, error) {
+	sizesDir := filepath.Join(dir, "candidates", fmt.Sprintf("%02d", n))
+	widths, err := services.ResizeThumbnail(ctx, imagePath, sizesDir, m.Widths)
+	if err != nil {
+		return nil, err
+	}
+
+	key := CandidateKey(videoID, n)
+	if err := m.S3Client.UploadFileFromPath(ctx, key, imagePath); err != nil {
+		return nil, fmt.Errorf("erro ao enviar candidato a capa %s: %w", key, err)
+	}
+	for _, width := range widths {
+		for _, format := range services.ThumbnailFormats {
+			key := CandidateSizeKey(videoID, n, width, format)
+			local := filepath.Join(sizesDir, services.ThumbnailFile(width, format))
+			if err := m.S3Client.UploadFileFromPath(ctx, key, local); err != nil {
+				return nil, fmt.Errorf("erro ao enviar candidato a capa %s: %w", key, err)
+			}
+		}
+	}
+	return widths, nil
+}
+
+// install copia o candidato e os tamanhos dele para a capa em uso. Candidatos
+// publicados antes dos tamanhos pré-gerados não têm larguras: só a capa
+// original é trocada, e o registro fica sem tamanhos.
+func (m *Manager) install(ctx context.Context, videoID string, candidate *catalog.PosterCandidate) error {
+	// Os tamanhos novos sobrescrevem os antigos no lugar, para que as URLs
+	// em uso nunca fiquem sem imagem
+	copied := map[string]bool{}
+	for _, width := range candidate.Widths {
+		for _, format := range services.ThumbnailFormats {
+			key := SizeKey(videoID, width, format)
+			if err := m.S3Client.Copy(ctx, CandidateSizeKey(videoID, candidate.Index, width, format), key); err != nil {
+				return fmt.Errorf("erro ao copiar miniatura de %s: %w", videoID, err)
+			}
+			copied[key] = true
+		}
+	}
+	if err := m.S3Client.Copy(ctx, candidate.Key, Key(videoID)); err != nil {
+		return fmt.Errorf("erro ao copiar capa de %s: %w", videoID, err)
+	}
+	return m.removeStaleSizes(ctx, videoID, copied)
+}
+
+// removeStaleSizes remove os tamanhos da capa que não estão em keep, como as
+// larguras de uma configuração anterior.
+func (m *Manager) removeStaleSizes(ctx context.Context, videoID string, keep map[string]bool) error {
+	existing, err := m.S3Client.ListFiles(ctx, Prefix(videoID)+"sizes/")
+	if err != nil {
+		return fmt.Errorf("erro ao listar miniaturas antigas de %s: %w", videoID, err)
+	}
+	for _, key := range existing {
+		if keep[key] {
+			continue
+		}
+		if err := m.S3Client.Delete(ctx, key); err != nil {
+			return fmt.Errorf("erro ao remover miniatura antiga %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// Delete remove a capa, os candidatos e o registro do vídeo.
+func (m *Manager) Delete(ctx context.Context, videoID string) error {
+	if _, err := m.S3Client.DeletePrefix(ctx, Prefix(videoID)); err != nil {
+		return err
+	}
+	if err := m.S3Client.Delete(ctx, Key(videoID)); err != nil {
+		return err
+	}
+	return m.Catalog.DeletePoster(ctx, videoID)
+}
@@ -0,0 +1,99 @@
+package poster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"streaming-platform/internal/catalog"
+	"streaming-platform/internal/services"
+	"streaming-platform/internal/storage/storagetest"
+)
+
+const testVideo = "video-1"
+
+// seedCandidates grava dois candidatos redimensionados nas larguras
+// informadas, com o primeiro em uso, e uma largura antiga da capa.
+func seedCandidates(t *testing.T, fake *storagetest.Server, manager *Manager, widths []int) {
+	t.Helper()
+	var candidates []catalog.PosterCandidate
+	for n := 1; n <= 2; n++ {
+		fake.Set(CandidateKey(testVideo, n), []byte(fmt.Sprintf("candidato %d", n)))
+		for _, width := range widths {
+			for _, format := range services.ThumbnailFormats {
+				fake.Set(CandidateSizeKey(testVideo, n, width, format), []byte(fmt.Sprintf("candidato %d %dw.%s", n, width, format)))
+			}
+		}
+		candidates = append(candidates, catalog.PosterCandidate{Index: n, Key: CandidateKey(testVideo, n), Time: float64(n), Widths: widths})
+	}
+	fake.Set(Key(testVideo), []byte("candidato 1"))
+	fake.Set(SizeKey(testVideo, 1280, services.ThumbnailJPEG), []byte("antiga"))
+
+	_, err := manager.Catalog.UpdatePoster(context.Background(), testVideo, func(poster *catalog.Poster) error {
+		poster.Candidates, poster.Selected, poster.Widths = candidates, 1, widths
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSelect(t *testing.T) {
+	tests := []struct {
+		name   string
+		widths []int
+	}{
+		{"candidato com tamanhos", []int{160, 320}},
+		{"candidato anterior aos tamanhos", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := storagetest.NewServer()
+			client := fake.Client(t)
+			manager := NewManager(client, catalog.NewStore(client), 2, []int{160, 320})
+			seedCandidates(t, fake, manager, tt.widths)
+
+			poster, err := manager.Select(context.Background(), testVideo, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if poster.Selected != 2 || poster.SelectedBy != catalog.PosterEditor || !reflect.DeepEqual(poster.Widths, tt.widths) {
+				t.Errorf("registro = %d/%s/%v, esperado 2/%s/%v", poster.Selected, poster.SelectedBy, poster.Widths, catalog.PosterEditor, tt.widths)
+			}
+
+			if object, _ := fake.Get(Key(testVideo)); string(object.Data) != "candidato 2" {
+				t.Errorf("capa = %q, esperado o candidato 2", object.Data)
+			}
+			var want []string
+			for _, width := range tt.widths {
+				for _, format := range services.ThumbnailFormats {
+					key := SizeKey(testVideo, width, format)
+					want = append(want, key)
+					if object, _ := fake.Get(key); string(object.Data) != fmt.Sprintf("candidato 2 %dw.%s", width, format) {
+						t.Errorf("%s = %q, esperado o candidato 2", key, object.Data)
+					}
+				}
+			}
+			// A largura que o candidato não tem sai
+			if got := fake.Keys(Prefix(testVideo) + "sizes/"); len(got) != len(want) {
+				t.Errorf("tamanhos = %v, esperado %v", got, want)
+			}
+		})
+	}
+}
+
+func TestSelectErrors(t *testing.T) {
+	fake := storagetest.NewServer()
+	client := fake.Client(t)
+	manager := NewManager(client, catalog.NewStore(client), 2, []int{160})
+
+	if _, err := manager.Select(context.Background(), testVideo, 1); !errors.Is(err, catalog.ErrNotFound) {
+		t.Errorf("Select() sem registro = %v, esperado %v", err, catalog.ErrNotFound)
+	}
+	seedCandidates(t, fake, manager, []int{160})
+	if _, err := manager.Select(context.Background(), testVideo, 3); !errors.Is(err, ErrUnknownCandidate) {
+		t.Errorf("Select() de candidato inexistente = %v, esperado %v", err, ErrUnknownCandidate)
+	}
+}
@@ -0,0 +1,301 @@
+// Package publish envia para o bucket os artefatos produzidos pela
+// transcodificação, sempre no mesmo layout lido pela origem /stream.
+//
+// Cada transcodificação vira uma versão imutável em
+// videos-transcoded/{id}/v{n}/. A versão é montada e conferida antes de ir ao
+// ar; publicar é apenas trocar a versão viva no catálogo, o que permite
+// reprocessar (ou reverter) um vídeo sem derrubar quem está assistindo.
+package publish
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"streaming-platform/internal/catalog"
+	"streaming-platform/internal/keystore"
+	"streaming-platform/internal/services"
+	"streaming-platform/internal/storage"
+	"streaming-platform/internal/telemetry"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// OutputsPrefix é o prefixo das saídas transcodificadas no bucket.
+const OutputsPrefix = "videos-transcoded/"
+
+// uploadConcurrency limita os envios simultâneos de segmentos.
+const uploadConcurrency = 8
+
+// ErrVersionConflict indica que outra publicação usou o mesmo número de versão.
+var ErrVersionConflict = errors.New("versão já publicada por outro processamento")
+
+// reservedMarker é gravado com escrita condicional no prefixo de uma versão
+// antes de enviar os arquivos: só quem conseguiu gravá-lo usa o número, e o
+// descarte de uma publicação que falhou nunca apaga a versão de outra.
+const reservedMarker = ".reserved"
+
+// maxReserveAttempts limita os números de versão tentados quando outros
+// processamentos do mesmo vídeo publicam ao mesmo tempo.
+const maxReserveAttempts = 5
+
+// OutputPrefix retorna o prefixo de todas as saídas de um vídeo.
+func OutputPrefix(videoID string) string {
+	return OutputsPrefix + videoID + "/"
+}
+
+// VersionPrefix retorna o prefixo da versão n:
+// videos-transcoded/{id}/v{n}/master.m3u8, {qualidade}/playlist.m3u8 e
+// segmentos.
+func VersionPrefix(videoID string, n int) string {
+	return OutputPrefix(videoID) + catalog.VersionDir(n) + "/"
+}
+
+// LivePrefix retorna o prefixo da versão no ar. Vídeos publicados antes das
+// versões não têm registro no catálogo e usam o prefixo do vídeo.
+func LivePrefix(ctx context.Context, store *catalog.Store, videoID string) (string, error) {
+	video, err := store.GetVideo(ctx, videoID)
+	if errors.Is(err, catalog.ErrNotFound) {
+		return OutputPrefix(videoID), nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return VersionPrefix(videoID, video.LiveVersion), nil
+}
+
+// LiveVersion retorna o registro da versão no ar, ou nil para vídeos
+// publicados antes das versões.
+func LiveVersion(ctx context.Context, store *catalog.Store, videoID string) (*catalog.Version, error) {
+	video, err := store.GetVideo(ctx, videoID)
+	if errors.Is(err, catalog.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return video.Version(video.LiveVersion), nil
+}
+
+// Publisher envia o manifesto de um vídeo para o bucket e o coloca no ar.
+// Keep é quantas versões manter depois de cada publicação (0 = todas); a
+// versão no ar nunca é removida. As chaves de cifragem de uma versão saem de
+// Keys junto com ela.
+type Publisher struct {
+	S3Client *storage.S3Client
+	Catalog  *catalog.Store
+	Keys     keystore.Store
+	Keep     int
+}
+
+func NewPublisher(s3Client *storage.S3Client, store *catalog.Store, keys keystore.Store, keep int) *Publisher {
+	return &Publisher{
+		S3Client: s3Client,
+		Catalog:  store,
+		Keys:     keys,
+		Keep:     keep,
+	}
+}
+
+// Publish monta uma versão nova com o manifesto, confere que tudo chegou ao
+// bucket e só então a coloca no ar. As versões anteriores continuam
+// disponíveis para quem ainda está assistindo e para reverter.
+func (p *Publisher) Publish(ctx context.Context, manifest *services.Manifest) (int, error) {
+	video, err := p.video(ctx, manifest.VideoID)
+	if err != nil {
+		return 0, err
+	}
+	number, err := p.reserve(ctx, manifest.VideoID, video.NextVersion())
+	if err != nil {
+		return 0, err
+	}
+	prefix := VersionPrefix(manifest.VideoID, number)
+	ctx, span := telemetry.StartSpan(ctx, "publish.video",
+		attribute.String("video.id", manifest.VideoID),
+		attribute.Int("video.version", number),
+	)
+
+	err = p.stage(ctx, manifest, prefix)
+	var bytes int64
+	if err == nil {
+		bytes, err = p.verify(ctx, manifest, prefix)
+	}
+	if err != nil {
+		// A versão não está no ar: pode ser descartada sem afetar ninguém
+		if _, cleanupErr := p.S3Client.DeletePrefix(context.WithoutCancel(ctx), prefix); cleanupErr != nil {
+			slog.WarnContext(ctx, "erro ao descartar versão incompleta", "prefix", prefix, "error", cleanupErr)
+		}
+		if cleanupErr := p.deleteKeys(context.WithoutCancel(ctx), manifest.VideoID, manifest.Keys); cleanupErr != nil {
+			slog.WarnContext(ctx, "erro ao descartar chaves da versão incompleta", "prefix", prefix, "error", cleanupErr)
+		}
+		telemetry.EndSpan(span, err)
+		return 0, err
+	}
+
+	qualities := make([]string, 0, len(manifest.Renditions))
+	for _, rendition := range manifest.Renditions {
+		qualities = append(qualities, rendition.Quality)
+	}
+	err = p.swap(ctx, manifest.VideoID, catalog.Version{
+		Number:    number,
+		Qualities: qualities,
+		Files:     len(manifest.Files()),
+		Bytes:     bytes,
+		Trickplay: manifest.Trickplay,
+		Keys:      manifest.Keys,
+		CreatedAt: time.Now().UTC(),
+	})
+	telemetry.EndSpan(span, err)
+	if err != nil {
+		return 0, err
+	}
+	slog.InfoContext(ctx, "vídeo publicado", "version", number, "files", len(manifest.Files()))
+
+	if p.Keep > 0 {
+		if _, err := p.Prune(ctx, manifest.VideoID, p.Keep); err != nil {
+			slog.WarnContext(ctx, "erro ao remover versões antigas", "error", err)
+		}
+	}
+	return number, nil
+}
+
+// reserve reserva o primeiro número de versão livre a partir de first.
+func (p *Publisher) reserve(ctx context.Context, videoID string, first int) (int, error) {
+	for number := first; number < first+maxReserveAttempts; number++ {
+		marker := VersionPrefix(videoID, number) + reservedMarker
+		_, err := p.S3Client.PutIfAbsent(ctx, marker, []byte(time.Now().UTC().Format(time.RFC3339)))
+		if errors.Is(err, storage.ErrPreconditionFailed) {
+			slog.InfoContext(ctx, "versão reservada por outro processamento", "video_id", videoID, "version", number)
+			continue
+		}
+		if err != nil {
+			return 0, fmt.Errorf("erro ao reservar versão %d: %w", number, err)
+		}
+		return number, nil
+	}
+	return 0, fmt.Errorf("%w: %s a %s", ErrVersionConflict, catalog.VersionDir(first), catalog.VersionDir(first+maxReserveAttempts-1))
+}
+
+// stage envia os segmentos e os demais arquivos, depois as playlists de
+// mídia e por último o master, de forma que uma playlist nunca aponte para um
+// arquivo ausente.
+func (p *Publisher) stage(ctx context.Context, manifest *services.Manifest, prefix string) error {
+	var segments, playlists []string
+	for _, rendition := range manifest.Renditions {
+		segments = append(segments, rendition.Segments...)
+		playlists = append(playlists, rendition.Playlist)
+	}
+	segments = append(segments, manifest.Assets...)
+
+	for _, batch := range [][]string{segments, playlists, {manifest.Master}} {
+		if err := p.upload(ctx, manifest, prefix, batch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// verify confere que todos os arquivos do manifesto estão no bucket com o
+// mesmo tamanho do disco.
+func (p *Publisher) verify(ctx context.Context, manifest *services.Manifest, prefix string) (int64, error) {
+	objects, err := p.S3Client.ListObjects(ctx, prefix)
+	if err != nil {
+		return 0, fmt.Errorf("erro ao conferir versão: %w", err)
+	}
+	sizes := make(map[string]int64, len(objects))
+	for _, object := range objects {
+		sizes[strings.TrimPrefix(object.Key, prefix)] = object.Size
+	}
+
+	var total int64
+	for _, file := range manifest.Files() {
+		info, err := os.Stat(manifest.LocalPath(file))
+		if err != nil {
+			return 0, err
+		}
+		size, ok := sizes[file]
+		if !ok {
+			return 0, fmt.Errorf("versão incompleta: %s não chegou ao bucket", file)
+		}
+		if size != info.Size() {
+			return 0, fmt.Errorf("versão corrompida: %s tem %d bytes no bucket e %d no disco", file, size, info.Size())
+		}
+		total += size
+	}
+	return total, nil
+}
+
+// swap registra a versão no catálogo e a coloca no ar.
+func (p *Publisher) swap(ctx context.Context, videoID string, version catalog.Version) error {
+	_, err := p.Catalog.UpdateVideo(ctx, videoID, func(video *catalog.Video) error {
+		if video.Version(version.Number) != nil {
+			return fmt.Errorf("%w: %s", ErrVersionConflict, version.Dir())
+		}
+		video.Versions = append(video.Versions, version)
+		video.LiveVersion = version.Number
+		video.PublishedAt = time.Now().UTC()
+		return nil
+	})
+	if err != nil && !errors.Is(err, ErrVersionConflict) {
+		return fmt.Errorf("erro ao publicar versão %d: %w", version.Number, err)
+	}
+	return err
+}
+
+// video retorna o registro do vídeo, ou um registro novo se ele ainda não
+// tem versões.
+func (p *Publisher) video(ctx context.Context, videoID string) (*catalog.Video, error) {
+	video, err := p.Catalog.GetVideo(ctx, videoID)
+	if errors.Is(err, catalog.ErrNotFound) {
+		return &catalog.Video{ID: videoID}, nil
+	}
+	return video, err
+}
+
+// upload envia um lote de arquivos em paralelo e retorna o primeiro erro.
+func (p *Publisher) upload(ctx context.Context, manifest *services.Manifest, prefix string, files []string) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	sem := make(chan struct{}, uploadConcurrency)
+	for _, file := range files {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func(file string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			key := path.Join(prefix, file)
+			if err := p.S3Client.UploadFileFromPath(ctx, key, manifest.LocalPath(file)); err != nil {
+				once.Do(func() {
+					firstErr = fmt.Errorf("erro ao enviar %s: %w", key, err)
+					cancel()
+				})
+			}
+		}(file)
+	}
+	wg.Wait()
+
+	if firstErr == nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return firstErr
+}
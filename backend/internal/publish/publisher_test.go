@@ -0,0 +1,341 @@
+package publish
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"streaming-platform/internal/catalog"
+	"streaming-platform/internal/keystore"
+	"streaming-platform/internal/services"
+	"streaming-platform/internal/storage/storagetest"
+)
+
+const testVideo = "video-1"
+
+// fakeKeys registra as chaves removidas.
+type fakeKeys struct {
+	deleted []string
+}
+
+func (k *fakeKeys) Put(context.Context, *keystore.Key) error { return nil }
+
+func (k *fakeKeys) Get(context.Context, string, string) (*keystore.Key, error) {
+	return nil, keystore.ErrKeyNotFound
+}
+
+func (k *fakeKeys) Delete(_ context.Context, _ string, ids []string) error {
+	k.deleted = append(k.deleted, ids...)
+	return nil
+}
+
+func (k *fakeKeys) DeleteVideo(context.Context, string) error { return nil }
+
+func newTestPublisher(t *testing.T, fake *storagetest.Server, keep int) (*Publisher, *fakeKeys) {
+	t.Helper()
+	client := fake.Client(t)
+	keys := &fakeKeys{}
+	return NewPublisher(client, catalog.NewStore(client), keys, keep), keys
+}
+
+// writeManifest grava no disco uma transcodificação com uma qualidade e dois
+// segmentos.
+func writeManifest(t *testing.T) *services.Manifest {
+	t.Helper()
+	manifest := &services.Manifest{
+		VideoID: testVideo,
+		Dir:     t.TempDir(),
+		Master:  "master.m3u8",
+		Renditions: []services.Rendition{{
+			Quality:  "360p",
+			Playlist: "360p/playlist.m3u8",
+			Segments: []string{"360p/seg_000.ts", "360p/seg_001.ts"},
+		}},
+	}
+	files := map[string]string{
+		"master.m3u8":        "#EXTM3U\n360p/playlist.m3u8\n",
+		"360p/playlist.m3u8": "#EXTM3U\nseg_000.ts\nseg_001.ts\n",
+		"360p/seg_000.ts":    "segmento 0",
+		"360p/seg_001.ts":    "segmento 1",
+	}
+	for file, content := range files {
+		if err := os.MkdirAll(filepath.Dir(manifest.LocalPath(file)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(manifest.LocalPath(file), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return manifest
+}
+
+// seedVideo grava o registro do vídeo com as versões informadas e suas
+// saídas no bucket.
+func seedVideo(t *testing.T, fake *storagetest.Server, store *catalog.Store, live int, numbers ...int) {
+	t.Helper()
+	_, err := store.UpdateVideo(context.Background(), testVideo, func(video *catalog.Video) error {
+		for _, n := range numbers {
+			video.Versions = append(video.Versions, catalog.Version{Number: n, Keys: []string{catalog.VersionDir(n) + "-chave"}})
+			fake.Set(VersionPrefix(testVideo, n)+"master.m3u8", []byte("#EXTM3U\n"))
+		}
+		video.LiveVersion = live
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func versionNumbers(video *catalog.Video) []int {
+	numbers := make([]int, 0, len(video.Versions))
+	for _, version := range video.Versions {
+		numbers = append(numbers, version.Number)
+	}
+	sort.Ints(numbers)
+	return numbers
+}
+
+func TestPublish(t *testing.T) {
+	tests := []struct {
+		name         string
+		existing     []int
+		reserved     []int
+		wantVersion  int
+		wantErr      error
+		wantVersions []int
+	}{
+		{"primeira publicação", nil, nil, 1, nil, []int{1}},
+		{"nova versão mantém a anterior", []int{1}, nil, 2, nil, []int{1, 2}},
+		{"número reservado por outro processamento", nil, []int{1}, 2, nil, []int{2}},
+		{"todas as reservas tomadas", nil, []int{1, 2, 3, 4, 5}, 0, ErrVersionConflict, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := storagetest.NewServer()
+			publisher, _ := newTestPublisher(t, fake, 0)
+			if len(tt.existing) > 0 {
+				seedVideo(t, fake, publisher.Catalog, tt.existing[len(tt.existing)-1], tt.existing...)
+			}
+			for _, n := range tt.reserved {
+				fake.Set(VersionPrefix(testVideo, n)+reservedMarker, []byte("outro"))
+			}
+
+			got, err := publisher.Publish(context.Background(), writeManifest(t))
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Fatalf("Publish() = %v, esperado %v", err, tt.wantErr)
+			}
+			if got != tt.wantVersion {
+				t.Errorf("versão = %d, esperado %d", got, tt.wantVersion)
+			}
+
+			video, err := publisher.Catalog.GetVideo(context.Background(), testVideo)
+			if tt.wantVersions == nil {
+				if !errors.Is(err, catalog.ErrNotFound) {
+					t.Errorf("GetVideo() = %v, %v; esperado sem registro", video, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if video.LiveVersion != tt.wantVersion || !reflect.DeepEqual(versionNumbers(video), tt.wantVersions) {
+				t.Errorf("no ar %d, versões %v; esperado %d e %v", video.LiveVersion, versionNumbers(video), tt.wantVersion, tt.wantVersions)
+			}
+			if version := video.Version(tt.wantVersion); version.Files != 4 || version.Bytes == 0 {
+				t.Errorf("versão registrada com %d arquivos e %d bytes", version.Files, version.Bytes)
+			}
+			if _, ok := fake.Get(VersionPrefix(testVideo, tt.wantVersion) + "360p/seg_001.ts"); !ok {
+				t.Error("segmento não publicado")
+			}
+		})
+	}
+}
+
+// Uma versão que não chegou inteira ao bucket é descartada, inclusive a
+// reserva, e não vai ao ar.
+func TestPublishDiscardsIncompleteVersion(t *testing.T) {
+	fake := storagetest.NewServer()
+	publisher, keys := newTestPublisher(t, fake, 0)
+	manifest := writeManifest(t)
+	manifest.Keys = []string{"k1"}
+	os.Remove(manifest.LocalPath("360p/seg_001.ts"))
+
+	if _, err := publisher.Publish(context.Background(), manifest); err == nil {
+		t.Fatal("Publish() aceitou uma versão incompleta")
+	}
+	if left := fake.Keys(VersionPrefix(testVideo, 1)); len(left) > 0 {
+		t.Errorf("arquivos da versão descartada no bucket: %v", left)
+	}
+	if !reflect.DeepEqual(keys.deleted, []string{"k1"}) {
+		t.Errorf("chaves removidas = %v, esperado [k1]", keys.deleted)
+	}
+	if _, err := publisher.Catalog.GetVideo(context.Background(), testVideo); !errors.Is(err, catalog.ErrNotFound) {
+		t.Errorf("GetVideo() = %v, esperado %v", err, catalog.ErrNotFound)
+	}
+}
+
+func TestSwap(t *testing.T) {
+	tests := []struct {
+		name      string
+		existing  []int
+		number    int
+		conflicts int
+		wantErr   error
+	}{
+		{"versão nova", []int{1}, 2, 0, nil},
+		{"disputa com outra gravação", []int{1}, 2, 1, nil},
+		{"número já registrado", []int{1, 2}, 2, 0, ErrVersionConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := storagetest.NewServer()
+			publisher, _ := newTestPublisher(t, fake, 0)
+			seedVideo(t, fake, publisher.Catalog, 1, tt.existing...)
+			fake.Conflicts = tt.conflicts
+
+			err := publisher.swap(context.Background(), testVideo, catalog.Version{Number: tt.number})
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Fatalf("swap() = %v, esperado %v", err, tt.wantErr)
+			}
+			video, err := publisher.Catalog.GetVideo(context.Background(), testVideo)
+			if err != nil {
+				t.Fatal(err)
+			}
+			wantLive := tt.number
+			if tt.wantErr != nil {
+				wantLive = 1
+			}
+			if video.LiveVersion != wantLive {
+				t.Errorf("versão no ar = %d, esperado %d", video.LiveVersion, wantLive)
+			}
+		})
+	}
+}
+
+func TestPrune(t *testing.T) {
+	tests := []struct {
+		name         string
+		live         int
+		existing     []int
+		keep         int
+		wantRemoved  []int
+		wantVersions []int
+		wantErr      error
+	}{
+		{"remove as mais antigas", 5, []int{1, 2, 3, 4, 5}, 2, []int{3, 2, 1}, []int{4, 5}, nil},
+		{"versão no ar antiga fica", 1, []int{1, 2, 3, 4, 5}, 2, []int{3, 2}, []int{1, 4, 5}, nil},
+		{"nada a remover", 2, []int{1, 2}, 3, nil, []int{1, 2}, nil},
+		{"vídeo sem versões", 0, nil, 2, nil, nil, catalog.ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := storagetest.NewServer()
+			publisher, keys := newTestPublisher(t, fake, 0)
+			if len(tt.existing) > 0 {
+				seedVideo(t, fake, publisher.Catalog, tt.live, tt.existing...)
+			}
+
+			removed, err := publisher.Prune(context.Background(), testVideo, tt.keep)
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Fatalf("Prune() = %v, esperado %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(removed, tt.wantRemoved) {
+				t.Errorf("removidas = %v, esperado %v", removed, tt.wantRemoved)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+
+			video, err := publisher.Catalog.GetVideo(context.Background(), testVideo)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(versionNumbers(video), tt.wantVersions) {
+				t.Errorf("versões = %v, esperado %v", versionNumbers(video), tt.wantVersions)
+			}
+			var wantKeys []string
+			for _, n := range tt.wantRemoved {
+				if left := fake.Keys(VersionPrefix(testVideo, n)); len(left) > 0 {
+					t.Errorf("%s continua no bucket: %v", catalog.VersionDir(n), left)
+				}
+				wantKeys = append(wantKeys, catalog.VersionDir(n)+"-chave")
+			}
+			if !reflect.DeepEqual(keys.deleted, wantKeys) {
+				t.Errorf("chaves removidas = %v, esperado %v", keys.deleted, wantKeys)
+			}
+			for _, n := range tt.wantVersions {
+				if len(fake.Keys(VersionPrefix(testVideo, n))) == 0 {
+					t.Errorf("%s mantida no catálogo mas removida do bucket", catalog.VersionDir(n))
+				}
+			}
+		})
+	}
+}
+
+func TestPruneKeepsAtLeastTwo(t *testing.T) {
+	fake := storagetest.NewServer()
+	publisher, _ := newTestPublisher(t, fake, 0)
+	if _, err := publisher.Prune(context.Background(), testVideo, 1); err == nil {
+		t.Error("Prune() aceitou manter uma única versão")
+	}
+}
+
+func TestRollbackAndDeleteVersion(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing []int
+		op       func(p *Publisher) (*catalog.Video, error)
+		wantErr  error
+		wantLive int
+	}{
+		{"reverte para versão anterior", []int{1, 2}, func(p *Publisher) (*catalog.Video, error) {
+			return p.Rollback(context.Background(), testVideo, 1)
+		}, nil, 1},
+		{"reverte para versão inexistente", []int{1, 2}, func(p *Publisher) (*catalog.Video, error) {
+			return p.Rollback(context.Background(), testVideo, 7)
+		}, ErrVersionNotFound, 2},
+		{"reverte vídeo sem versões", nil, func(p *Publisher) (*catalog.Video, error) {
+			return p.Rollback(context.Background(), testVideo, 1)
+		}, catalog.ErrNotFound, 0},
+		{"remove versão fora do ar", []int{1, 2}, func(p *Publisher) (*catalog.Video, error) {
+			return p.DeleteVersion(context.Background(), testVideo, 1)
+		}, nil, 2},
+		{"remove a versão no ar", []int{1, 2}, func(p *Publisher) (*catalog.Video, error) {
+			return p.DeleteVersion(context.Background(), testVideo, 2)
+		}, ErrVersionLive, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := storagetest.NewServer()
+			publisher, _ := newTestPublisher(t, fake, 0)
+			if len(tt.existing) > 0 {
+				seedVideo(t, fake, publisher.Catalog, tt.existing[len(tt.existing)-1], tt.existing...)
+			}
+
+			video, err := tt.op(publisher)
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Fatalf("erro = %v, esperado %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && video.LiveVersion != tt.wantLive {
+				t.Errorf("versão no ar = %d, esperado %d", video.LiveVersion, tt.wantLive)
+			}
+			stored, err := publisher.Catalog.GetVideo(context.Background(), testVideo)
+			if tt.wantLive == 0 {
+				if !errors.Is(err, catalog.ErrNotFound) {
+					t.Errorf("GetVideo() = %v, esperado sem registro", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored.LiveVersion != tt.wantLive {
+				t.Errorf("versão no ar gravada = %d, esperado %d", stored.LiveVersion, tt.wantLive)
+			}
+		})
+	}
+}
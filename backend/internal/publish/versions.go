@@ -0,0 +1,167 @@
+package publish
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	"streaming-platform/internal/catalog"
+)
+
+var (
+	ErrVersionNotFound = errors.New("versão não encontrada")
+	ErrVersionLive     = errors.New("a versão no ar não pode ser removida")
+)
+
+// Rollback coloca no ar uma versão já publicada do vídeo.
+func (p *Publisher) Rollback(ctx context.Context, videoID string, number int) (*catalog.Video, error) {
+	var previous int
+	video, err := p.Catalog.UpdateVideo(ctx, videoID, func(video *catalog.Video) error {
+		if len(video.Versions) == 0 {
+			return catalog.ErrNotFound
+		}
+		if video.Version(number) == nil {
+			return fmt.Errorf("%w: %s", ErrVersionNotFound, catalog.VersionDir(number))
+		}
+		previous = video.LiveVersion
+		video.LiveVersion = number
+		video.PublishedAt = time.Now().UTC()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	slog.InfoContext(ctx, "versão no ar alterada", "video_id", videoID, "from", previous, "to", number)
+	return video, nil
+}
+
+// DeleteVersion remove o registro e as saídas de uma versão fora do ar.
+func (p *Publisher) DeleteVersion(ctx context.Context, videoID string, number int) (*catalog.Video, error) {
+	var removed *catalog.Version
+	video, err := p.Catalog.UpdateVideo(ctx, videoID, func(video *catalog.Video) error {
+		if len(video.Versions) == 0 {
+			return catalog.ErrNotFound
+		}
+		var err error
+		removed, err = dropVersion(video, number)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := p.deleteOutputs(ctx, videoID, removed); err != nil {
+		return nil, err
+	}
+	return video, nil
+}
+
+// Prune mantém as keep versões mais recentes (além da versão no ar) e
+// remove as demais. Retorna os números das versões removidas. keep é ao menos
+// 2: a versão anterior precisa sobreviver para quem ainda está assistindo.
+func (p *Publisher) Prune(ctx context.Context, videoID string, keep int) ([]int, error) {
+	if keep < 2 {
+		return nil, fmt.Errorf("é preciso manter ao menos duas versões")
+	}
+
+	var dropped []*catalog.Version
+	_, err := p.Catalog.UpdateVideo(ctx, videoID, func(video *catalog.Video) error {
+		if len(video.Versions) == 0 {
+			return catalog.ErrNotFound
+		}
+		numbers := make([]int, 0, len(video.Versions))
+		for _, version := range video.Versions {
+			numbers = append(numbers, version.Number)
+		}
+		sort.Sort(sort.Reverse(sort.IntSlice(numbers)))
+
+		// A função pode rodar de novo se outro processo gravou no meio
+		dropped = dropped[:0]
+		for i, number := range numbers {
+			if i < keep || number == video.LiveVersion {
+				continue
+			}
+			version, err := dropVersion(video, number)
+			if err != nil {
+				return err
+			}
+			dropped = append(dropped, version)
+		}
+		if len(dropped) == 0 {
+			return errNothingToPrune
+		}
+		return nil
+	})
+	if errors.Is(err, errNothingToPrune) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// As versões já saíram do catálogo: uma falha aqui deixa só arquivos
+	// soltos, que o fsck encontra como saídas sem registro
+	var removed []int
+	var errs []error
+	for _, version := range dropped {
+		if err := p.deleteOutputs(ctx, videoID, version); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		removed = append(removed, version.Number)
+	}
+	if len(removed) > 0 {
+		slog.InfoContext(ctx, "versões antigas removidas", "video_id", videoID, "versions", removed)
+	}
+	return removed, errors.Join(errs...)
+}
+
+// errNothingToPrune cancela a gravação do registro quando não há versões a
+// remover.
+var errNothingToPrune = errors.New("nenhuma versão a remover")
+
+// dropVersion tira a versão do registro, sem gravá-lo, e a retorna. A versão
+// no ar não pode ser removida.
+func dropVersion(video *catalog.Video, number int) (*catalog.Version, error) {
+	version := video.Version(number)
+	if version == nil {
+		return nil, fmt.Errorf("%w: %s", ErrVersionNotFound, catalog.VersionDir(number))
+	}
+	if number == video.LiveVersion {
+		return nil, ErrVersionLive
+	}
+	dropped := *version
+
+	versions := make([]catalog.Version, 0, len(video.Versions)-1)
+	for _, v := range video.Versions {
+		if v.Number != number {
+			versions = append(versions, v)
+		}
+	}
+	video.Versions = versions
+	return &dropped, nil
+}
+
+// deleteOutputs remove do bucket as saídas de uma versão que já saiu do
+// catálogo, e as chaves de cifragem dela. Remover o registro antes garante
+// que ninguém coloque a versão no ar enquanto ela é apagada.
+func (p *Publisher) deleteOutputs(ctx context.Context, videoID string, version *catalog.Version) error {
+	if _, err := p.S3Client.DeletePrefix(ctx, VersionPrefix(videoID, version.Number)); err != nil {
+		return fmt.Errorf("erro ao remover %s: %w", version.Dir(), err)
+	}
+	// Sem os segmentos, as chaves da versão não servem para mais nada
+	if err := p.deleteKeys(ctx, videoID, version.Keys); err != nil {
+		return fmt.Errorf("erro ao remover chaves de %s: %w", version.Dir(), err)
+	}
+	return nil
+}
+
+// deleteKeys remove as chaves de cifragem informadas do vídeo.
+func (p *Publisher) deleteKeys(ctx context.Context, videoID string, ids []string) error {
+	if p.Keys == nil || len(ids) == 0 {
+		return nil
+	}
+	return p.Keys.Delete(ctx, videoID, ids)
+}
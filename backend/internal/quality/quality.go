@@ -0,0 +1,17 @@
+// Package quality lista as qualidades de vídeo que a plataforma sabe gerar.
+// Fica fora de services para que a configuração possa validar
+// VIDEO_QUALITIES sem depender da transcodificação.
+package quality
+
+// Supported lista as qualidades com perfil de transcodificação.
+var Supported = []string{"1080p", "720p", "480p", "360p"}
+
+// IsSupported indica se a qualidade tem perfil de transcodificação.
+func IsSupported(quality string) bool {
+	for _, q := range Supported {
+		if q == quality {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,151 @@
+// Package scheduler decide quando um job de processamento pode começar, de
+// acordo com a capacidade de CPU da máquina.
+package scheduler
+
+import (
+	"context"
+	"runtime"
+	"sync"
+
+	"streaming-platform/internal/metrics"
+	"streaming-platform/internal/services"
+)
+
+// JobThreads retorna quantas threads de CPU um job reserva para gerar as
+// qualidades: o custo da qualidade mais cara, limitado a limit. As
+// qualidades são codificadas uma depois da outra, então o job nunca usa mais
+// que isso ao mesmo tempo; reservar a soma deixaria núcleos ociosos.
+func JobThreads(qualities []string, limit int) int {
+	threads := 1
+	for _, quality := range qualities {
+		threads = max(threads, services.QualityThreads(quality))
+	}
+	if limit > 0 && threads > limit {
+		threads = limit
+	}
+	return threads
+}
+
+// CPUBudget admite jobs enquanto houver threads de CPU livres no orçamento
+// e, se MaxJobs > 0, enquanto houver menos de MaxJobs jobs em andamento. Os
+// pedidos são atendidos na ordem de chegada: um job pequeno não passa na
+// frente de um grande que já está esperando.
+type CPUBudget struct {
+	Total   int
+	MaxJobs int
+
+	mu      sync.Mutex
+	used    int
+	jobs    int
+	waiters []*waiter
+}
+
+type waiter struct {
+	threads int
+	ready   chan struct{}
+}
+
+// NewCPUBudget cria o orçamento com total threads (0 = todos os núcleos) e no
+// máximo maxJobs jobs simultâneos (0 = sem limite além da CPU).
+func NewCPUBudget(total, maxJobs int) *CPUBudget {
+	if total <= 0 {
+		total = runtime.NumCPU()
+	}
+	metrics.SchedulerThreadsCapacity.Set(float64(total))
+	return &CPUBudget{Total: total, MaxJobs: maxJobs}
+}
+
+// Acquire espera até haver threads livres para o job, ou até ctx ser
+// cancelado. A função retornada devolve as threads ao orçamento e deve ser
+// chamada ao fim do job.
+func (b *CPUBudget) Acquire(ctx context.Context, threads int) (func(), error) {
+	threads = max(1, min(threads, b.Total))
+
+	b.mu.Lock()
+	if len(b.waiters) == 0 && b.fits(threads) {
+		b.take(threads)
+		b.mu.Unlock()
+		return b.releaser(threads), nil
+	}
+	w := &waiter{threads: threads, ready: make(chan struct{})}
+	b.waiters = append(b.waiters, w)
+	b.updateMetrics()
+	b.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return b.releaser(threads), nil
+	case <-ctx.Done():
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	select {
+	case <-w.ready:
+		// Admitido ao mesmo tempo que o cancelamento: devolve as threads
+		b.give(threads)
+	default:
+		for i := range b.waiters {
+			if b.waiters[i] == w {
+				b.waiters = append(b.waiters[:i], b.waiters[i+1:]...)
+				break
+			}
+		}
+		// O primeiro da fila pode ter sido o que bloqueava os demais
+		b.admit()
+	}
+	return nil, ctx.Err()
+}
+
+// Status retorna as threads em uso, o total do orçamento, os jobs em
+// andamento e os que aguardam admissão.
+func (b *CPUBudget) Status() (used, total, jobs, waiting int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.used, b.Total, b.jobs, len(b.waiters)
+}
+
+func (b *CPUBudget) releaser(threads int) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			b.give(threads)
+		})
+	}
+}
+
+// Os métodos abaixo devem ser chamados com mu travado.
+
+func (b *CPUBudget) fits(threads int) bool {
+	return b.used+threads <= b.Total && (b.MaxJobs <= 0 || b.jobs < b.MaxJobs)
+}
+
+func (b *CPUBudget) take(threads int) {
+	b.used += threads
+	b.jobs++
+	b.updateMetrics()
+}
+
+func (b *CPUBudget) give(threads int) {
+	b.used -= threads
+	b.jobs--
+	b.admit()
+}
+
+// admit libera os primeiros da fila enquanto couberem no orçamento.
+func (b *CPUBudget) admit() {
+	for len(b.waiters) > 0 && b.fits(b.waiters[0].threads) {
+		w := b.waiters[0]
+		b.waiters = b.waiters[1:]
+		b.take(w.threads)
+		close(w.ready)
+	}
+	b.updateMetrics()
+}
+
+func (b *CPUBudget) updateMetrics() {
+	metrics.SchedulerThreadsInUse.Set(float64(b.used))
+	metrics.SchedulerWaitingJobs.Set(float64(len(b.waiters)))
+}
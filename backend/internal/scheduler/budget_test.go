@@ -0,0 +1,164 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestJobThreads(t *testing.T) {
+	tests := []struct {
+		name      string
+		qualities []string
+		limit     int
+		want      int
+	}{
+		{"qualidade mais cara", []string{"1080p", "720p", "480p"}, 0, 4},
+		{"só resoluções menores", []string{"720p", "480p", "360p"}, 0, 2},
+		{"uma thread", []string{"480p"}, 0, 1},
+		{"sem qualidades", nil, 0, 1},
+		{"limitado pelo orçamento", []string{"1080p"}, 2, 2},
+		{"abaixo do limite", []string{"720p"}, 8, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := JobThreads(tt.qualities, tt.limit); got != tt.want {
+				t.Errorf("JobThreads(%v, %d) = %d, esperado %d", tt.qualities, tt.limit, got, tt.want)
+			}
+		})
+	}
+}
+
+// acquireAsync pede threads em segundo plano; o canal recebe a função de
+// liberação quando o pedido é admitido.
+func acquireAsync(ctx context.Context, b *CPUBudget, threads int) (<-chan func(), <-chan error) {
+	admitted := make(chan func(), 1)
+	failed := make(chan error, 1)
+	go func() {
+		release, err := b.Acquire(ctx, threads)
+		if err != nil {
+			failed <- err
+			return
+		}
+		admitted <- release
+	}()
+	return admitted, failed
+}
+
+// waitWaiting espera até n pedidos estarem na fila de admissão.
+func waitWaiting(t *testing.T, b *CPUBudget, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if _, _, _, waiting := b.Status(); waiting == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("esperava %d pedido(s) na fila", n)
+}
+
+func admittedNow(ch <-chan func()) bool {
+	select {
+	case <-ch:
+		return true
+	case <-time.After(20 * time.Millisecond):
+		return false
+	}
+}
+
+func TestCPUBudgetAcquire(t *testing.T) {
+	tests := []struct {
+		name     string
+		total    int
+		maxJobs  int
+		running  []int
+		threads  int
+		admitted bool
+	}{
+		{"cabe no orçamento", 8, 0, []int{4}, 4, true},
+		{"excede o orçamento", 8, 0, []int{4, 2}, 4, false},
+		{"limite de jobs", 8, 2, []int{1, 1}, 1, false},
+		{"pedido maior que o total", 4, 0, nil, 16, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			b := NewCPUBudget(tt.total, tt.maxJobs)
+			for _, threads := range tt.running {
+				if _, err := b.Acquire(ctx, threads); err != nil {
+					t.Fatal(err)
+				}
+			}
+			admitted, _ := acquireAsync(ctx, b, tt.threads)
+			if got := admittedNow(admitted); got != tt.admitted {
+				t.Errorf("admitido = %v, esperado %v", got, tt.admitted)
+			}
+		})
+	}
+}
+
+// Um job pequeno não passa na frente de um grande que já está esperando.
+func TestCPUBudgetFIFO(t *testing.T) {
+	ctx := context.Background()
+	b := NewCPUBudget(4, 0)
+	release, err := b.Acquire(ctx, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	big, _ := acquireAsync(ctx, b, 4)
+	waitWaiting(t, b, 1)
+	small, _ := acquireAsync(ctx, b, 1)
+	waitWaiting(t, b, 2)
+	if admittedNow(small) {
+		t.Fatal("pedido pequeno passou na frente do grande")
+	}
+
+	release()
+	releaseBig := <-big
+	if used, _, _, _ := b.Status(); used != 4 {
+		t.Errorf("threads em uso = %d, esperado 4", used)
+	}
+	releaseBig()
+	<-small
+	if used, _, jobs, waiting := b.Status(); used != 1 || jobs != 1 || waiting != 0 {
+		t.Errorf("Status() = %d threads, %d jobs, %d na fila; esperado 1, 1, 0", used, jobs, waiting)
+	}
+}
+
+// Cancelar o primeiro da fila libera os que cabiam atrás dele.
+func TestCPUBudgetCancel(t *testing.T) {
+	b := NewCPUBudget(4, 0)
+	if _, err := b.Acquire(context.Background(), 2); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	_, failed := acquireAsync(ctx, b, 4)
+	waitWaiting(t, b, 1)
+	small, _ := acquireAsync(context.Background(), b, 2)
+	waitWaiting(t, b, 2)
+
+	cancel()
+	if err := <-failed; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Acquire() = %v, esperado context.Canceled", err)
+	}
+	if !admittedNow(small) {
+		t.Fatal("pedido que cabia no orçamento continuou esperando")
+	}
+}
+
+func TestCPUBudgetReleaseOnce(t *testing.T) {
+	b := NewCPUBudget(4, 0)
+	release, err := b.Acquire(context.Background(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+	release()
+	if used, _, jobs, _ := b.Status(); used != 0 || jobs != 0 {
+		t.Errorf("Status() = %d threads, %d jobs; esperado 0, 0", used, jobs)
+	}
+}
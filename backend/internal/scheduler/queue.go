@@ -0,0 +1,219 @@
+package scheduler
+
+import (
+	"sync"
+
+	"streaming-platform/internal/catalog"
+	"streaming-platform/internal/metrics"
+)
+
+// Item é um job na fila, com o tamanho do original para desempate.
+type Item struct {
+	Job  *catalog.Job
+	Size int64
+}
+
+// Queue é a fila de jobs pendentes. Next entrega primeiro os jobs de maior
+// prioridade; entre os de mesma prioridade, os originais menores (clipes
+// curtos) e depois os mais antigos. Com OwnerLimit > 0, um dono não tem mais
+// que OwnerLimit jobs em andamento, para que um envio em massa não segure a
+// fila dos demais; jobs sem dono (streamctl, reprocessamentos do fsck, envios
+// anteriores às chaves de API) não entram no limite. O limite local só
+// poupa disputas: entre réplicas ele vale pelas vagas do dono no bucket
+// (utils.Processor), e um dono sem vaga em nenhuma réplica fica de fora (Hold)
+// até a próxima Sync.
+//
+// O tamanho da fila nas métricas muda junto com a fila, sob a mesma trava.
+type Queue struct {
+	OwnerLimit int
+
+	mu      sync.Mutex
+	items   []Item
+	running map[string]int  // dono -> jobs em andamento
+	active  map[string]bool // jobs entregues por Next e ainda sem Done
+	held    map[string]bool // donos sem vaga nas outras réplicas
+	// Fechado e substituído sempre que a fila muda
+	changed chan struct{}
+}
+
+func NewQueue(ownerLimit int) *Queue {
+	return &Queue{
+		OwnerLimit: ownerLimit,
+		running:    map[string]int{},
+		active:     map[string]bool{},
+		held:       map[string]bool{},
+		changed:    make(chan struct{}),
+	}
+}
+
+// Push adiciona os itens que ainda não estão na fila.
+func (q *Queue) Push(items ...Item) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, item := range items {
+		if !q.active[item.Job.ID] && q.index(item.Job.ID) < 0 {
+			q.items = append(q.items, item)
+		}
+	}
+	q.notify()
+}
+
+// Sync alinha a fila com a lista atual de jobs pendentes no catálogo: entram
+// os jobs novos, os que já estão na fila passam a ter a prioridade e o dono
+// atuais e saem os que não estão mais pendentes (concluídos por outra
+// réplica, por exemplo). Os donos retidos por Hold voltam à disputa.
+// Retorna quantos entraram e quantos saíram.
+func (q *Queue) Sync(items []Item) (added, removed int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	clear(q.held)
+
+	pending := make(map[string]Item, len(items))
+	for _, item := range items {
+		if !q.active[item.Job.ID] {
+			pending[item.Job.ID] = item
+		}
+	}
+
+	kept := q.items[:0]
+	for _, item := range q.items {
+		current, ok := pending[item.Job.ID]
+		if !ok {
+			removed++
+			continue
+		}
+		kept = append(kept, current)
+		delete(pending, item.Job.ID)
+	}
+	q.items = kept
+	for _, item := range items {
+		if _, ok := pending[item.Job.ID]; ok {
+			q.items = append(q.items, item)
+			added++
+		}
+	}
+	q.notify()
+	return added, removed
+}
+
+// Next remove e retorna o próximo job que pode começar, registrando-o como
+// em andamento para o dono; Done deve ser chamado ao fim. Sem job elegível,
+// retorna nil e um canal fechado quando a fila mudar, ou nil e nil se a fila
+// estiver vazia.
+func (q *Queue) Next() (*catalog.Job, <-chan struct{}) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.items) == 0 {
+		return nil, nil
+	}
+
+	best := -1
+	for i, item := range q.items {
+		if q.limited(item.Job.Owner) {
+			continue
+		}
+		if best < 0 || before(item, q.items[best]) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return nil, q.changed
+	}
+
+	job := q.items[best].Job
+	q.items = append(q.items[:best], q.items[best+1:]...)
+	q.running[job.Owner]++
+	q.active[job.ID] = true
+	q.updateMetrics()
+	return job, nil
+}
+
+// Done registra o fim de um job entregue por Next.
+func (q *Queue) Done(job *catalog.Job) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.running[job.Owner]--; q.running[job.Owner] <= 0 {
+		delete(q.running, job.Owner)
+	}
+	delete(q.active, job.ID)
+	q.notify()
+}
+
+// Hold deixa os jobs do dono na fila sem entregá-los até a próxima Sync:
+// todas as vagas dele estão ocupadas, possivelmente em outras réplicas.
+func (q *Queue) Hold(owner string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.held[owner] = true
+}
+
+// SetPriority muda a prioridade de um job que ainda está na fila. Retorna
+// false se ele não está na fila.
+func (q *Queue) SetPriority(id string, priority int) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	i := q.index(id)
+	if i < 0 {
+		return false
+	}
+	q.items[i].Job.Priority = priority
+	q.notify()
+	return true
+}
+
+// Len retorna quantos jobs aguardam na fila.
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
+
+// Running retorna quantos jobs de cada dono estão em andamento.
+func (q *Queue) Running() map[string]int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	running := make(map[string]int, len(q.running))
+	for owner, n := range q.running {
+		running[owner] = n
+	}
+	return running
+}
+
+// Os métodos abaixo devem ser chamados com mu travado.
+
+// limited indica se o dono já tem OwnerLimit jobs em andamento ou está
+// retido por Hold.
+func (q *Queue) limited(owner string) bool {
+	return q.OwnerLimit > 0 && owner != "" && (q.running[owner] >= q.OwnerLimit || q.held[owner])
+}
+
+func (q *Queue) index(id string) int {
+	for i, item := range q.items {
+		if item.Job.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (q *Queue) notify() {
+	close(q.changed)
+	q.changed = make(chan struct{})
+	q.updateMetrics()
+}
+
+func (q *Queue) updateMetrics() {
+	metrics.JobQueueDepth.Set(float64(len(q.items)))
+	metrics.JobsByState.WithLabelValues(metrics.JobQueued).Set(float64(len(q.items)))
+}
+
+// before indica se a deve sair da fila antes de b.
+func before(a, b Item) bool {
+	if a.Job.Priority != b.Job.Priority {
+		return a.Job.Priority > b.Job.Priority
+	}
+	if a.Size != b.Size {
+		return a.Size < b.Size
+	}
+	return a.Job.CreatedAt.Before(b.Job.CreatedAt)
+}
@@ -0,0 +1,184 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"streaming-platform/internal/catalog"
+)
+
+var epoch = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func item(id, owner string, priority int, size int64, age time.Duration) Item {
+	return Item{
+		Job: &catalog.Job{
+			ID:        id,
+			Owner:     owner,
+			Priority:  priority,
+			State:     catalog.JobPending,
+			CreatedAt: epoch.Add(-age),
+		},
+		Size: size,
+	}
+}
+
+// drain retorna os IDs na ordem em que Next os entrega, sem chamar Done.
+func drain(q *Queue) []string {
+	var ids []string
+	for {
+		job, _ := q.Next()
+		if job == nil {
+			return ids
+		}
+		ids = append(ids, job.ID)
+	}
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestQueueOrder(t *testing.T) {
+	tests := []struct {
+		name       string
+		ownerLimit int
+		items      []Item
+		want       []string
+	}{
+		{
+			"prioridade primeiro",
+			0,
+			[]Item{item("normal", "a", catalog.PriorityNormal, 1, 0), item("urgente", "a", catalog.PriorityUrgent, 1, 0), item("baixa", "a", catalog.PriorityLow, 1, 0)},
+			[]string{"urgente", "normal", "baixa"},
+		},
+		{
+			"menor original na mesma prioridade",
+			0,
+			[]Item{item("grande", "a", 0, 900, time.Hour), item("pequeno", "a", 0, 10, 0)},
+			[]string{"pequeno", "grande"},
+		},
+		{
+			"mais antigo no empate",
+			0,
+			[]Item{item("novo", "a", 0, 10, time.Minute), item("antigo", "a", 0, 10, time.Hour)},
+			[]string{"antigo", "novo"},
+		},
+		{
+			"limite por dono",
+			1,
+			[]Item{item("a1", "a", 10, 1, 0), item("a2", "a", 10, 1, 0), item("b1", "b", 0, 1, 0)},
+			[]string{"a1", "b1"},
+		},
+		{
+			"jobs sem dono fora do limite",
+			1,
+			[]Item{item("x1", "", 0, 1, 0), item("x2", "", 0, 2, 0), item("x3", "", 0, 3, 0)},
+			[]string{"x1", "x2", "x3"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := NewQueue(tt.ownerLimit)
+			q.Push(tt.items...)
+			if got := drain(q); !equal(got, tt.want) {
+				t.Errorf("ordem = %v, esperado %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueueDoneFreesOwner(t *testing.T) {
+	q := NewQueue(1)
+	q.Push(item("a1", "a", 0, 1, time.Hour), item("a2", "a", 0, 1, 0))
+
+	first, _ := q.Next()
+	job, changed := q.Next()
+	if job != nil || changed == nil {
+		t.Fatalf("Next() = %v, %v; esperado nenhum job e um canal de espera", job, changed)
+	}
+
+	q.Done(first)
+	select {
+	case <-changed:
+	default:
+		t.Fatal("Done não avisou a mudança da fila")
+	}
+	if job, _ := q.Next(); job == nil || job.ID != "a2" {
+		t.Fatalf("Next() = %v, esperado a2", job)
+	}
+	if running := q.Running(); running["a"] != 1 {
+		t.Errorf("Running() = %v, esperado a: 1", running)
+	}
+}
+
+func TestQueueEmpty(t *testing.T) {
+	q := NewQueue(0)
+	if job, changed := q.Next(); job != nil || changed != nil {
+		t.Errorf("Next() na fila vazia = %v, %v", job, changed)
+	}
+}
+
+func TestQueueSync(t *testing.T) {
+	q := NewQueue(0)
+	q.Push(item("fica", "a", 0, 1, 0), item("sai", "a", 0, 1, 0), item("ativo", "a", 99, 1, 0))
+	active, _ := q.Next()
+
+	added, removed := q.Sync([]Item{
+		item("fica", "a", catalog.PriorityUrgent, 1, 0),
+		item("novo", "b", 0, 1, 0),
+		item("ativo", "a", 99, 1, 0),
+	})
+	if added != 1 || removed != 1 {
+		t.Errorf("Sync() = %d entraram, %d saíram; esperado 1, 1", added, removed)
+	}
+	// O job em andamento não volta para a fila
+	if got, want := drain(q), []string{"fica", "novo"}; !equal(got, want) {
+		t.Errorf("fila = %v, esperado %v", got, want)
+	}
+	q.Done(active)
+}
+
+func TestQueueSetPriority(t *testing.T) {
+	q := NewQueue(0)
+	q.Push(item("a", "x", 0, 1, time.Hour), item("b", "x", 0, 1, 0))
+
+	if !q.SetPriority("b", catalog.PriorityUrgent) {
+		t.Fatal("SetPriority() = false para job na fila")
+	}
+	if q.SetPriority("inexistente", 1) {
+		t.Error("SetPriority() = true para job fora da fila")
+	}
+	if got, want := drain(q), []string{"b", "a"}; !equal(got, want) {
+		t.Errorf("ordem = %v, esperado %v", got, want)
+	}
+	if q.Len() != 0 {
+		t.Errorf("Len() = %d, esperado 0", q.Len())
+	}
+}
+
+func TestQueueHold(t *testing.T) {
+	q := NewQueue(2)
+	q.Push(item("a1", "a", 0, 1, 0), item("b1", "b", 0, 1, 0))
+
+	q.Hold("a")
+	if job, _ := q.Next(); job == nil || job.ID != "b1" {
+		t.Fatalf("Next() = %v, esperado b1", job)
+	}
+	if job, changed := q.Next(); job != nil || changed == nil {
+		t.Fatalf("Next() = %v, %v; esperado dono retido", job, changed)
+	}
+
+	// A sincronização devolve o dono à disputa
+	q.Sync([]Item{item("a1", "a", 0, 1, 0)})
+	if job, _ := q.Next(); job == nil || job.ID != "a1" {
+		t.Errorf("Next() depois de Sync = %v, esperado a1", job)
+	}
+}
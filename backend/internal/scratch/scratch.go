@@ -0,0 +1,290 @@
+// Package scratch administra o disco local usado pelos processamentos. Cada
+// job recebe um diretório de trabalho exclusivo com uma reserva de espaço
+// estimada pelo tamanho do original; enquanto o disco não comporta a reserva
+// o job espera, em vez de encher o disco no meio da transcodificação.
+package scratch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"streaming-platform/internal/metrics"
+	"streaming-platform/internal/services"
+)
+
+// Folga para miniatura, playlists e arquivos auxiliares do ffmpeg.
+const estimateOverhead = 64 << 20
+
+// Intervalo entre as consultas de espaço livre enquanto um job espera; o
+// espaço também pode ser liberado por outros processos.
+const waitInterval = 10 * time.Second
+
+// ErrTooLarge indica que o processamento não cabe no disco nem com ele vazio.
+var ErrTooLarge = errors.New("processamento não cabe no disco de trabalho")
+
+// Estimate estima o espaço usado para processar um original de sourceSize
+// bytes em renditions qualidades: o original baixado e, no pior caso, uma
+// saída do tamanho do original por qualidade (a cifragem reescreve os
+// segmentos no lugar).
+func Estimate(sourceSize int64, renditions int) uint64 {
+	size := uint64(max(sourceSize, 0))
+	return size + size*uint64(renditions) + estimateOverhead
+}
+
+// Manager reserva espaço no diretório Root para os processamentos, mantendo
+// sempre MinFree bytes livres.
+type Manager struct {
+	Root    string
+	MinFree uint64
+
+	mu      sync.Mutex
+	leases  map[string]uint64 // diretório -> bytes reservados
+	waiting int
+	// Fechado e substituído sempre que uma reserva é liberada
+	released chan struct{}
+}
+
+// NewManager cria o diretório raiz, se necessário. Com root vazio usa o
+// diretório temporário do sistema.
+func NewManager(root string, minFree uint64) (*Manager, error) {
+	if root == "" {
+		root = os.TempDir()
+	}
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, fmt.Errorf("erro ao criar diretório de trabalho %s: %v", root, err)
+	}
+	return &Manager{
+		Root:     root,
+		MinFree:  minFree,
+		leases:   map[string]uint64{},
+		released: make(chan struct{}),
+	}, nil
+}
+
+// Lease é um diretório de trabalho com espaço reservado. Release remove o
+// diretório e devolve a reserva; deve ser chamado em todos os caminhos.
+type Lease struct {
+	*services.Workspace
+	Bytes uint64
+
+	manager *Manager
+	once    sync.Once
+}
+
+// Release remove o diretório de trabalho e libera a reserva. Pode ser
+// chamado mais de uma vez.
+func (l *Lease) Release() {
+	l.once.Do(func() {
+		if err := l.Cleanup(); err != nil {
+			// O janitor remove o que sobrar
+			slog.Warn("erro ao remover diretório de trabalho", "dir", l.Dir, "error", err)
+		}
+		l.manager.release(l.Dir)
+	})
+}
+
+// Acquire reserva bytes e cria o diretório de trabalho do vídeo. Enquanto o
+// disco não comporta a reserva, espera por outra reserva ser liberada ou
+// pelo cancelamento de ctx.
+func (m *Manager) Acquire(ctx context.Context, videoID string, bytes uint64) (*Lease, error) {
+	total, err := m.capacity()
+	if err != nil {
+		return nil, err
+	}
+	if bytes+m.MinFree > total {
+		return nil, fmt.Errorf("%w: %d bytes estimados, %d no disco", ErrTooLarge, bytes, total)
+	}
+
+	logged := false
+	for {
+		m.mu.Lock()
+		free, err := m.available()
+		if err != nil {
+			m.mu.Unlock()
+			return nil, err
+		}
+		if bytes <= free {
+			workspace, err := services.NewWorkspace(m.Root, videoID)
+			if err == nil {
+				m.leases[workspace.Dir] = bytes
+				m.updateMetrics()
+			}
+			m.mu.Unlock()
+			if err != nil {
+				return nil, err
+			}
+			if logged {
+				slog.InfoContext(ctx, "espaço em disco disponível, retomando processamento")
+			}
+			return &Lease{Workspace: workspace, Bytes: bytes, manager: m}, nil
+		}
+
+		released := m.released
+		m.waiting++
+		m.updateMetrics()
+		m.mu.Unlock()
+
+		if !logged {
+			slog.WarnContext(ctx, "aguardando espaço em disco para processar", "needed_bytes", bytes, "available_bytes", free, "dir", m.Root)
+			logged = true
+		}
+
+		timer := time.NewTimer(waitInterval)
+		select {
+		case <-released:
+		case <-timer.C:
+		case <-ctx.Done():
+		}
+		timer.Stop()
+
+		m.mu.Lock()
+		m.waiting--
+		m.updateMetrics()
+		m.mu.Unlock()
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("espera por espaço em disco interrompida: %w", ctx.Err())
+		}
+	}
+}
+
+// Status retorna o total reservado, quantos processamentos estão ativos e
+// quantos aguardam espaço.
+func (m *Manager) Status() (reserved uint64, active, waiting int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, bytes := range m.leases {
+		reserved += bytes
+	}
+	return reserved, len(m.leases), m.waiting
+}
+
+func (m *Manager) release(dir string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.leases, dir)
+	close(m.released)
+	m.released = make(chan struct{})
+	m.updateMetrics()
+}
+
+// available retorna quanto ainda pode ser reservado: o espaço livre menos
+// MinFree e menos a parte das reservas ativas que ainda não foi escrita.
+// Deve ser chamado com mu travado.
+func (m *Manager) available() (uint64, error) {
+	free, err := m.free()
+	if err != nil {
+		return 0, err
+	}
+	var pending uint64
+	for dir, bytes := range m.leases {
+		if used := dirSize(dir); used < bytes {
+			pending += bytes - used
+		}
+	}
+	if free < m.MinFree+pending {
+		return 0, nil
+	}
+	return free - m.MinFree - pending, nil
+}
+
+func (m *Manager) free() (uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(m.Root, &stat); err != nil {
+		return 0, fmt.Errorf("erro ao consultar espaço livre em %s: %v", m.Root, err)
+	}
+	return stat.Bavail * uint64(stat.Bsize), nil
+}
+
+func (m *Manager) capacity() (uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(m.Root, &stat); err != nil {
+		return 0, fmt.Errorf("erro ao consultar espaço em %s: %v", m.Root, err)
+	}
+	return stat.Blocks * uint64(stat.Bsize), nil
+}
+
+// updateMetrics deve ser chamado com mu travado.
+func (m *Manager) updateMetrics() {
+	var reserved uint64
+	for _, bytes := range m.leases {
+		reserved += bytes
+	}
+	metrics.ScratchReservedBytes.Set(float64(reserved))
+	metrics.ScratchWaitingJobs.Set(float64(m.waiting))
+}
+
+// Sweep remove os diretórios de trabalho que não pertencem a nenhuma reserva
+// ativa e não são alterados há mais de maxAge: sobras de processos que
+// caíram no meio de um job. A idade protege os diretórios de outros
+// processos (como o streamctl) que usam a mesma raiz. Ao fim, atualiza a
+// métrica do espaço ocupado na raiz.
+func (m *Manager) Sweep(maxAge time.Duration) (int, error) {
+	entries, err := os.ReadDir(m.Root)
+	if err != nil {
+		return 0, fmt.Errorf("erro ao listar %s: %v", m.Root, err)
+	}
+
+	removed := 0
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasPrefix(entry.Name(), services.WorkspacePrefix) {
+			continue
+		}
+		dir := filepath.Join(m.Root, entry.Name())
+
+		m.mu.Lock()
+		_, active := m.leases[dir]
+		m.mu.Unlock()
+		if active || time.Since(lastModified(dir)) < maxAge {
+			continue
+		}
+
+		if err := os.RemoveAll(dir); err != nil {
+			slog.Warn("erro ao remover diretório de trabalho abandonado", "dir", dir, "error", err)
+			continue
+		}
+		slog.Info("diretório de trabalho abandonado removido", "dir", dir)
+		removed++
+	}
+	metrics.ScratchSweptDirs.Add(float64(removed))
+	metrics.TempDirBytes.Set(float64(dirSize(m.Root)))
+	return removed, nil
+}
+
+// lastModified retorna a modificação mais recente dentro de dir: o ffmpeg
+// escreve nos subdiretórios, sem alterar a data do diretório de cima.
+func lastModified(dir string) time.Time {
+	var latest time.Time
+	filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info, err := d.Info(); err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+		return nil
+	})
+	return latest
+}
+
+func dirSize(dir string) uint64 {
+	var size uint64
+	filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			size += uint64(info.Size())
+		}
+		return nil
+	})
+	return size
+}
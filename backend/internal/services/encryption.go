@@ -0,0 +1,164 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"streaming-platform/internal/keystore"
+)
+
+// Modos de cifragem dos segmentos HLS
+const (
+	EncryptionNone     = "none"
+	EncryptionPerVideo = "per-video"
+	EncryptionRotating = "rotating"
+)
+
+// KeyURIPrefix é o caminho do servidor de chaves referenciado por EXT-X-KEY.
+// As playlists guardadas no bucket levam só o ID da chave; a origem acrescenta
+// o vídeo e o token ao servi-las.
+const KeyURIPrefix = "/keys/"
+
+// Encryptor cifra os segmentos das renditions com AES-128 (HLS padrão).
+// No modo per-video uma única chave vale para o vídeo inteiro; no modo
+// rotating uma nova chave é usada a cada RotationSegments segmentos.
+type Encryptor struct {
+	Store            keystore.Store
+	Mode             string
+	RotationSegments int
+}
+
+// Enabled indica se a cifragem está ativa.
+func (e *Encryptor) Enabled() bool {
+	return e != nil && e.Mode != "" && e.Mode != EncryptionNone
+}
+
+// EncryptRenditions cifra no lugar os segmentos de cada qualidade do
+// manifesto e insere as tags EXT-X-KEY nas playlists de mídia. Os IDs das
+// chaves criadas ficam em manifest.Keys, para que saiam junto com a versão.
+func (e *Encryptor) EncryptRenditions(ctx context.Context, manifest *Manifest, qualities []string) error {
+	if !e.Enabled() {
+		return nil
+	}
+
+	rotation := 0
+	if e.Mode == EncryptionRotating {
+		rotation = e.RotationSegments
+		if rotation <= 0 {
+			return fmt.Errorf("intervalo de rotação de chaves inválido: %d", rotation)
+		}
+	}
+
+	// As chaves são compartilhadas entre as qualidades: o segmento N de todas
+	// as renditions usa a mesma chave, o que mantém a troca de qualidade barata.
+	var keys []*keystore.Key
+	keyFor := func(segment int) (*keystore.Key, error) {
+		index := 0
+		if rotation > 0 {
+			index = segment / rotation
+		}
+		for len(keys) <= index {
+			key, err := keystore.NewKey(manifest.VideoID)
+			if err != nil {
+				return nil, err
+			}
+			if err := e.Store.Put(ctx, key); err != nil {
+				return nil, fmt.Errorf("erro ao salvar chave: %v", err)
+			}
+			keys = append(keys, key)
+			manifest.Keys = append(manifest.Keys, key.ID)
+		}
+		return keys[index], nil
+	}
+
+	for _, quality := range qualities {
+		playlistPath := filepath.Join(manifest.Dir, quality, "playlist.m3u8")
+		if err := encryptPlaylist(playlistPath, keyFor); err != nil {
+			return fmt.Errorf("erro ao cifrar qualidade %s: %v", quality, err)
+		}
+	}
+
+	slog.InfoContext(ctx, "segmentos cifrados", "dir", manifest.Dir, "mode", e.Mode, "keys", len(keys))
+	return nil
+}
+
+func encryptPlaylist(playlistPath string, keyFor func(segment int) (*keystore.Key, error)) error {
+	data, err := os.ReadFile(playlistPath)
+	if err != nil {
+		return err
+	}
+
+	var out bytes.Buffer
+	var current *keystore.Key
+	segment := 0
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		switch {
+		case strings.HasPrefix(line, "#EXT-X-KEY"):
+			return fmt.Errorf("playlist já está cifrada: %s", playlistPath)
+		case strings.HasPrefix(line, "#EXTINF"):
+			// A tag de chave precisa vir antes do primeiro segmento que a usa
+			key, err := keyFor(segment)
+			if err != nil {
+				return err
+			}
+			if key != current {
+				fmt.Fprintf(&out, "#EXT-X-KEY:METHOD=AES-128,URI=\"%s%s\",IV=0x%s\n",
+					KeyURIPrefix, key.ID, hex.EncodeToString(key.IV))
+				current = key
+			}
+		case line != "" && !strings.HasPrefix(line, "#"):
+			segmentPath := filepath.Join(filepath.Dir(playlistPath), line)
+			if err := encryptSegment(segmentPath, current); err != nil {
+				return err
+			}
+			segment++
+		}
+
+		out.WriteString(line)
+		out.WriteByte('\n')
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	return os.WriteFile(playlistPath, out.Bytes(), 0644)
+}
+
+// encryptSegment cifra o arquivo com AES-128-CBC e padding PKCS#7.
+func encryptSegment(path string, key *keystore.Key) error {
+	if key == nil {
+		return fmt.Errorf("segmento sem EXTINF: %s", path)
+	}
+
+	plain, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	block, err := aes.NewCipher(key.Value)
+	if err != nil {
+		return err
+	}
+
+	padding := aes.BlockSize - len(plain)%aes.BlockSize
+	buf := make([]byte, len(plain)+padding)
+	copy(buf, plain)
+	for i := len(plain); i < len(buf); i++ {
+		buf[i] = byte(padding)
+	}
+
+	cipher.NewCBCEncrypter(block, key.IV).CryptBlocks(buf, buf)
+	return os.WriteFile(path, buf, 0644)
+}
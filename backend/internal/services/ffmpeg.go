@@ -1,57 +1,280 @@
 package services
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"streaming-platform/internal/metrics"
+	"streaming-platform/internal/telemetry"
+
+	"go.opentelemetry.io/otel/attribute"
 )
 
-func TranscodeVideoToHLS(videoID, inputPath string, qualities []string) error {
-	tempDir := filepath.Join(os.TempDir(), "videos", videoID)
-	log.Printf("Diretório temporário para transcodificação: %s", tempDir)
+// Profile ajusta a transcodificação para originais problemáticos. O perfil
+// padrão não muda nada; os demais servem para tentar de novo jobs que
+// falharam repetidamente.
+type Profile struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// Opções do ffmpeg antes de -i (leitura do original) e antes da saída
+	InputArgs  []string `json:"inputArgs,omitempty"`
+	OutputArgs []string `json:"outputArgs,omitempty"`
+	// MaxQuality limita as qualidades geradas (vazio = as configuradas)
+	MaxQuality string `json:"maxQuality,omitempty"`
+}
+
+// DefaultProfile é o perfil usado quando o job não escolhe outro.
+const DefaultProfile = "default"
+
+var profiles = []Profile{
+	{
+		Name:        DefaultProfile,
+		Description: "transcodificação normal",
+	},
+	{
+		Name:        "tolerant",
+		Description: "ignora erros de decodificação, descarta pacotes corrompidos e recria os timestamps",
+		InputArgs:   []string{"-err_detect", "ignore_err", "-fflags", "+genpts+discardcorrupt"},
+		OutputArgs:  []string{"-pix_fmt", "yuv420p", "-max_muxing_queue_size", "4096"},
+	},
+	{
+		Name:        "sd",
+		Description: "como tolerant, mas só até 480p, para originais que esgotam memória ou tempo",
+		InputArgs:   []string{"-err_detect", "ignore_err", "-fflags", "+genpts+discardcorrupt"},
+		OutputArgs:  []string{"-pix_fmt", "yuv420p", "-max_muxing_queue_size", "4096"},
+		MaxQuality:  "480p",
+	},
+}
+
+// Profiles retorna os perfis de transcodificação disponíveis.
+func Profiles() []Profile {
+	return profiles
+}
+
+// LookupProfile retorna o perfil com o nome informado; vazio é o padrão.
+func LookupProfile(name string) (Profile, bool) {
+	if name == "" {
+		name = DefaultProfile
+	}
+	for _, profile := range profiles {
+		if profile.Name == name {
+			return profile, true
+		}
+	}
+	return Profile{}, false
+}
+
+// Qualities filtra as qualidades configuradas pelo limite do perfil. Se
+// nenhuma couber, fica a menor delas.
+func (p Profile) Qualities(qualities []string) []string {
+	if p.MaxQuality == "" {
+		return qualities
+	}
+	limit := qualityHeight(p.MaxQuality)
+	var kept []string
+	smallest := ""
+	for _, quality := range qualities {
+		if qualityHeight(quality) <= limit {
+			kept = append(kept, quality)
+		}
+		if smallest == "" || qualityHeight(quality) < qualityHeight(smallest) {
+			smallest = quality
+		}
+	}
+	if len(kept) == 0 && smallest != "" {
+		kept = []string{smallest}
+	}
+	return kept
+}
+
+// qualityHeight retorna a altura em pixels de uma qualidade como "720p".
+func qualityHeight(quality string) int {
+	height, _ := strconv.Atoi(strings.TrimSuffix(quality, "p"))
+	return height
+}
+
+// TranscodeVideoToHLS gera as renditions e o master playlist em
+// workspace.HLSDir() e retorna o manifesto com todos os arquivos produzidos.
+// Cada execução do ffmpeg usa as threads que a qualidade aproveita, no
+// máximo threads (0 = decisão do ffmpeg), e as opções do perfil.
+func TranscodeVideoToHLS(ctx context.Context, workspace *Workspace, videoID, inputPath string, qualities []string, threads int, profile Profile) (*Manifest, error) {
+	outputDir := workspace.HLSDir()
+	slog.DebugContext(ctx, "diretório de saída da transcodificação", "dir", outputDir)
 
 	// Criar diretório base
-	if err := os.MkdirAll(tempDir, os.ModePerm); err != nil {
-		return fmt.Errorf("erro ao criar diretório: %v", err)
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return nil, fmt.Errorf("erro ao criar diretório: %v", err)
 	}
 
-	masterPlaylistPath := filepath.Join(tempDir, "master.m3u8")
-	masterFile, err := os.Create(masterPlaylistPath)
+	manifest := &Manifest{VideoID: videoID, Dir: outputDir, Master: MasterPlaylistName}
+	master := "#EXTM3U\n"
+
+	// A duração da fonte permite medir o fator de tempo real de cada rendition
+	duration, err := ProbeDuration(ctx, inputPath)
 	if err != nil {
-		return fmt.Errorf("erro ao criar master playlist: %v", err)
+		slog.WarnContext(ctx, "não foi possível obter a duração do vídeo", "error", err)
 	}
-	defer masterFile.Close()
-	masterFile.WriteString("#EXTM3U\n")
 
 	for _, quality := range qualities {
-		qualityDir := filepath.Join(tempDir, quality)
-		if err := os.MkdirAll(qualityDir, os.ModePerm); err != nil {
-			return fmt.Errorf("erro ao criar diretório da qualidade %s: %v", quality, err)
+		qualityDir := filepath.Join(outputDir, quality)
+		if err := os.MkdirAll(qualityDir, 0755); err != nil {
+			return nil, fmt.Errorf("erro ao criar diretório da qualidade %s: %v", quality, err)
 		}
 
-		outputPath := filepath.Join(qualityDir, "playlist.m3u8")
-		cmd := exec.Command("ffmpeg",
+		outputPath := filepath.Join(qualityDir, MediaPlaylistName)
+		spanCtx, span := telemetry.StartSpan(ctx, "ffmpeg.transcode",
+			attribute.String("video.id", videoID),
+			attribute.String("video.quality", quality),
+		)
+		qualityThreads := encodeThreads(quality, threads)
+		slog.InfoContext(ctx, "executando ffmpeg", "quality", quality, "threads", qualityThreads)
+		start := time.Now()
+		args := append([]string{}, profile.InputArgs...)
+		args = append(args,
 			"-i", inputPath,
 			"-preset", "veryfast",
 			"-b:v", fmt.Sprintf("%dk", getBandwidth(quality)/1000),
 			"-s", getResolutionString(quality),
 			"-c:v", "libx264",
+		)
+		args = append(args, profile.OutputArgs...)
+		if qualityThreads > 0 {
+			args = append(args, "-threads", strconv.Itoa(qualityThreads))
+		}
+		args = append(args,
 			"-hls_time", "10",
 			"-hls_playlist_type", "vod",
+			"-hls_segment_filename", filepath.Join(qualityDir, "segment_%04d.ts"),
 			outputPath,
 		)
-		log.Printf("Executando FFmpeg para qualidade %s", quality)
-		if err := cmd.Run(); err != nil {
-			return fmt.Errorf("erro ao transcodificar %s: %v", quality, err)
+		err := runFFmpeg(spanCtx, "transcode", args...)
+		telemetry.EndSpan(span, err)
+		if err != nil {
+			return nil, fmt.Errorf("erro ao transcodificar %s: %w", quality, err)
+		}
+		elapsed := time.Since(start).Seconds()
+		metrics.TranscodeDuration.WithLabelValues(quality).Observe(elapsed)
+		if duration > 0 && elapsed > 0 {
+			metrics.TranscodeRealtimeFactor.WithLabelValues(quality).Observe(duration / elapsed)
+		}
+
+		if err := manifest.addRendition(quality); err != nil {
+			return nil, err
 		}
-		masterFile.WriteString(fmt.Sprintf("#EXT-X-STREAM-INF:BANDWIDTH=%d,RESOLUTION=%s\n%s\n",
-			getBandwidth(quality), getResolutionString(quality), filepath.Join(quality, "playlist.m3u8")))
+		master += fmt.Sprintf("#EXT-X-STREAM-INF:BANDWIDTH=%d,RESOLUTION=%s\n%s\n",
+			getBandwidth(quality), getResolutionString(quality), path.Join(quality, MediaPlaylistName))
+	}
+
+	// O master é escrito por último, só com as renditions que deram certo
+	masterPath := manifest.LocalPath(manifest.Master)
+	if err := os.WriteFile(masterPath, []byte(master), 0644); err != nil {
+		return nil, fmt.Errorf("erro ao criar master playlist: %v", err)
+	}
+
+	slog.InfoContext(ctx, "transcodificação para HLS concluída", "master", masterPath, "files", len(manifest.Files()))
+	return manifest, nil
+}
+
+// stderrTailSize é quanto do final da saída de erro do ffmpeg é guardado.
+const stderrTailSize = 4096
+
+// FFmpegError é a falha de uma execução do ffmpeg, com o final da saída de
+// erro para diagnóstico.
+type FFmpegError struct {
+	Stage    string
+	Reason   string
+	ExitCode int
+	Stderr   string
+	Err      error
+}
+
+func (e *FFmpegError) Error() string {
+	return fmt.Sprintf("ffmpeg (%s) falhou com %s: %v", e.Stage, e.Reason, e.Err)
+}
+
+func (e *FFmpegError) Unwrap() error {
+	return e.Err
+}
+
+// runFFmpeg executa o ffmpeg guardando o final da saída de erro. Em caso de
+// falha, registra a métrica e o log e retorna um *FFmpegError.
+func runFFmpeg(ctx context.Context, stage string, args ...string) error {
+	args = append([]string{"-hide_banner", "-nostdin", "-nostats"}, args...)
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+	stderr := &tailBuffer{max: stderrTailSize}
+	cmd.Stderr = stderr
+
+	slog.DebugContext(ctx, "comando ffmpeg", "stage", stage, "args", args)
+	err := cmd.Run()
+	if err == nil {
+		return nil
 	}
 
-	log.Printf("Transcodificação para HLS concluída: %s", masterPlaylistPath)
-	return nil
+	ffErr := &FFmpegError{
+		Stage:    stage,
+		Reason:   ffmpegExitReason(err),
+		ExitCode: -1,
+		Stderr:   stderr.String(),
+		Err:      err,
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		ffErr.ExitCode = exitErr.ExitCode()
+	}
+
+	metrics.FFmpegFailures.WithLabelValues(stage, ffErr.Reason).Inc()
+	slog.ErrorContext(ctx, "ffmpeg falhou",
+		"stage", stage,
+		"reason", ffErr.Reason,
+		"exit_code", ffErr.ExitCode,
+		"stderr", ffErr.Stderr,
+	)
+	return ffErr
+}
+
+// tailBuffer guarda apenas os últimos max bytes escritos.
+type tailBuffer struct {
+	buf []byte
+	max int
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.buf = append(b.buf, p...)
+	if len(b.buf) > b.max {
+		b.buf = append(b.buf[:0], b.buf[len(b.buf)-b.max:]...)
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) String() string {
+	return string(b.buf)
+}
+
+// ffmpegExitReason classifica a falha de uma execução do ffmpeg para as
+// métricas: binário ausente, sinal recebido ou código de saída.
+func ffmpegExitReason(err error) string {
+	var exitErr *exec.ExitError
+	switch {
+	case errors.Is(err, exec.ErrNotFound):
+		return "not_found"
+	case errors.As(err, &exitErr):
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			return fmt.Sprintf("signal_%d", status.Signal())
+		}
+		return fmt.Sprintf("exit_%d", exitErr.ExitCode())
+	default:
+		return "start_error"
+	}
 }
 
 func getBandwidth(quality string) int {
@@ -67,6 +290,28 @@ func getBandwidth(quality string) int {
 	}
 }
 
+// QualityThreads retorna quantas threads de CPU o libx264 aproveita bem ao
+// codificar a qualidade; resoluções menores não ganham com mais threads.
+func QualityThreads(quality string) int {
+	switch quality {
+	case "1080p":
+		return 4
+	case "720p":
+		return 2
+	default:
+		return 1
+	}
+}
+
+// encodeThreads retorna as threads do ffmpeg ao codificar a qualidade dentro
+// das threads reservadas pelo job (0 = decisão do ffmpeg).
+func encodeThreads(quality string, threads int) int {
+	if threads <= 0 {
+		return 0
+	}
+	return min(QualityThreads(quality), threads)
+}
+
 func getResolutionString(quality string) string {
 	switch quality {
 	case "1080p":
@@ -0,0 +1,194 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"streaming-platform/internal/telemetry"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// PosterFrame é um quadro candidato a capa (poster), com as medidas usadas
+// para pontuá-lo. Luminance e Blackness vão de 0 a 1 (brilho médio e fração
+// de pixels quase pretos), Sharpness é a variância do laplaciano (maior =
+// mais nítido) e SceneChange a diferença média para um quadro logo antes,
+// alta no meio de cortes, fusões e movimentos rápidos.
+type PosterFrame struct {
+	Path        string
+	Time        float64
+	Luminance   float64
+	Blackness   float64
+	Sharpness   float64
+	SceneChange float64
+	Score       float64
+}
+
+// Grade em que os quadros são reduzidos antes das medidas: suficiente para
+// comparar candidatos e barata para decodificar em Go
+const (
+	posterGridWidth  = 192
+	posterGridHeight = 108
+	// Valor de luma (0-255) abaixo do qual um pixel conta como preto
+	posterBlackLuma = 20
+	// Distância, em segundos, do quadro usado para medir a troca de cena
+	posterSceneGap = 0.2
+)
+
+// SamplePosterFrames extrai count quadros espalhados pelo vídeo (evitando o
+// início e o fim, onde ficam as fusões do preto) para dir e os retorna do
+// mais ao menos representativo. Quadros que não puderam ser extraídos ou
+// lidos são ignorados; só é erro não sobrar nenhum.
+func SamplePosterFrames(ctx context.Context, videoPath, dir string, count int) ([]PosterFrame, error) {
+	duration, err := ProbeDuration(ctx, videoPath)
+	if err != nil {
+		return nil, err
+	}
+	if duration <= 0 {
+		return nil, fmt.Errorf("duração inválida para a capa: %v", duration)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("erro ao criar diretório da capa: %v", err)
+	}
+
+	ctx, span := telemetry.StartSpan(ctx, "ffmpeg.poster", attribute.Int("poster.candidates", count))
+	var frames []PosterFrame
+	var lastErr error
+	for i := 0; i < count; i++ {
+		at := duration * float64(i+1) / float64(count+1)
+		frame, err := samplePosterFrame(ctx, videoPath, dir, i+1, at)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		frames = append(frames, frame)
+	}
+	if len(frames) == 0 {
+		err = fmt.Errorf("nenhum quadro candidato a capa foi extraído: %w", lastErr)
+	}
+	telemetry.EndSpan(span, err)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(frames, func(i, j int) bool {
+		return frames[i].Score > frames[j].Score
+	})
+	return frames, nil
+}
+
+// samplePosterFrame extrai o quadro em at, em resolução cheia, e um quadro
+// reduzido um pouco antes para medir a troca de cena.
+func samplePosterFrame(ctx context.Context, videoPath, dir string, n int, at float64) (PosterFrame, error) {
+	framePath := filepath.Join(dir, fmt.Sprintf("candidate_%02d.jpg", n))
+	beforePath := filepath.Join(dir, fmt.Sprintf("before_%02d.jpg", n))
+	before := math.Max(at-posterSceneGap, 0)
+	err := runFFmpeg(ctx, "poster",
+		"-ss", strconv.FormatFloat(before, 'f', 3, 64), "-i", videoPath,
+		"-ss", strconv.FormatFloat(at, 'f', 3, 64), "-i", videoPath,
+		"-map", "0:v:0", "-frames:v", "1", "-vf", fmt.Sprintf("scale=%d:%d", posterGridWidth, posterGridHeight), "-y", beforePath,
+		"-map", "1:v:0", "-frames:v", "1", "-q:v", "2", "-y", framePath)
+	if err != nil {
+		return PosterFrame{}, err
+	}
+
+	grid, err := lumaGrid(framePath)
+	if err != nil {
+		return PosterFrame{}, err
+	}
+	frame := PosterFrame{Path: framePath, Time: at}
+	frame.Luminance, frame.Blackness = exposure(grid)
+	frame.Sharpness = laplacianVariance(grid)
+	// Sem o quadro anterior (início do vídeo, por exemplo) a troca de cena
+	// fica de fora da pontuação
+	if previous, err := lumaGrid(beforePath); err == nil {
+		frame.SceneChange = meanDifference(grid, previous)
+	}
+	frame.Score = scorePosterFrame(frame)
+	return frame, nil
+}
+
+// scorePosterFrame dá a nota (0 a 1) de um quadro: nítido, bem exposto, sem
+// áreas pretas e fora de uma troca de cena. Quadros quase todos pretos
+// (fusões, créditos) ficam com zero.
+func scorePosterFrame(f PosterFrame) float64 {
+	if f.Blackness > 0.95 {
+		return 0
+	}
+	exposed := math.Max(0, 1-math.Abs(f.Luminance-0.45)/0.45)
+	sharp := f.Sharpness / (f.Sharpness + 200)
+	stable := 1 - math.Min(f.SceneChange*4, 1)
+	score := 0.35*sharp + 0.25*exposed + 0.25*(1-f.Blackness) + 0.15*stable
+	return math.Round(score*1000) / 1000
+}
+
+// lumaGrid decodifica a imagem e a reduz para a grade de medidas, em luma
+// (0-255).
+func lumaGrid(path string) ([]float64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao ler quadro %s: %v", filepath.Base(path), err)
+	}
+
+	bounds := img.Bounds()
+	grid := make([]float64, posterGridWidth*posterGridHeight)
+	for y := 0; y < posterGridHeight; y++ {
+		for x := 0; x < posterGridWidth; x++ {
+			r, g, b, _ := img.At(bounds.Min.X+x*bounds.Dx()/posterGridWidth, bounds.Min.Y+y*bounds.Dy()/posterGridHeight).RGBA()
+			grid[y*posterGridWidth+x] = (0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)) / 257
+		}
+	}
+	return grid, nil
+}
+
+// exposure retorna o brilho médio e a fração de pixels pretos, de 0 a 1.
+func exposure(grid []float64) (luminance, blackness float64) {
+	var sum float64
+	black := 0
+	for _, v := range grid {
+		sum += v
+		if v < posterBlackLuma {
+			black++
+		}
+	}
+	return sum / float64(len(grid)) / 255, float64(black) / float64(len(grid))
+}
+
+// laplacianVariance mede a nitidez: bordas definidas dão um laplaciano de
+// variância alta, imagens borradas ou lisas dão variância baixa.
+func laplacianVariance(grid []float64) float64 {
+	var sum, sumSq float64
+	n := 0
+	for y := 1; y < posterGridHeight-1; y++ {
+		for x := 1; x < posterGridWidth-1; x++ {
+			i := y*posterGridWidth + x
+			v := grid[i-1] + grid[i+1] + grid[i-posterGridWidth] + grid[i+posterGridWidth] - 4*grid[i]
+			sum += v
+			sumSq += v * v
+			n++
+		}
+	}
+	mean := sum / float64(n)
+	return math.Round((sumSq/float64(n)-mean*mean)*10) / 10
+}
+
+// meanDifference retorna a diferença média de luma entre duas grades, de 0 a 1.
+func meanDifference(a, b []float64) float64 {
+	var sum float64
+	for i := range a {
+		sum += math.Abs(a[i] - b[i])
+	}
+	return math.Round(sum/float64(len(a))/255*1000) / 1000
+}
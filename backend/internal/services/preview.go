@@ -0,0 +1,116 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"streaming-platform/internal/telemetry"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Arquivos da prévia animada (exibida ao passar o mouse na grade de vídeos)
+const (
+	PreviewMP4  = "preview.mp4"
+	PreviewWebP = "preview.webp"
+)
+
+var PreviewFiles = []string{PreviewMP4, PreviewWebP}
+
+// Quadros por segundo da prévia: suficiente para dar a ideia do movimento
+// com uma fração do tamanho
+const previewFPS = 12
+
+// PreviewOptions define a prévia animada: Clips trechos de ClipLength
+// espalhados pelo vídeo, emendados e reduzidos para Width pixels de largura.
+type PreviewOptions struct {
+	Clips      int
+	ClipLength time.Duration
+	Width      int
+}
+
+// Enabled indica se a prévia deve ser gerada.
+func (o PreviewOptions) Enabled() bool {
+	return o.Clips > 0 && o.ClipLength > 0 && o.Width > 0
+}
+
+// GeneratePreview gera em dir a prévia animada do vídeo, sem áudio e com
+// bitrate baixo, em MP4 (H.264, para <video>) e WebP animado (para <img>).
+// Cada trecho é lido com busca rápida, sem decodificar o vídeo inteiro.
+func GeneratePreview(ctx context.Context, videoPath, dir string, opts PreviewOptions, threads int) error {
+	duration, err := ProbeDuration(ctx, videoPath)
+	if err != nil {
+		return err
+	}
+	if duration <= 0 {
+		return fmt.Errorf("duração inválida para a prévia: %v", duration)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("erro ao criar diretório da prévia: %v", err)
+	}
+
+	starts, length := previewClips(duration, opts)
+	ctx, span := telemetry.StartSpan(ctx, "ffmpeg.preview", attribute.Int("preview.clips", len(starts)))
+
+	var args []string
+	var filter strings.Builder
+	for i, start := range starts {
+		args = append(args,
+			"-ss", strconv.FormatFloat(start, 'f', 3, 64),
+			"-t", strconv.FormatFloat(length, 'f', 3, 64),
+			"-i", videoPath)
+		fmt.Fprintf(&filter, "[%d:v:0]fps=%d,scale=%d:-2,setsar=1[c%d];", i, previewFPS, opts.Width, i)
+	}
+	for i := range starts {
+		fmt.Fprintf(&filter, "[c%d]", i)
+	}
+	fmt.Fprintf(&filter, "concat=n=%d:v=1:a=0,split=2[mp4][webp]", len(starts))
+
+	args = append(args, "-filter_complex", filter.String())
+	if threads > 0 {
+		args = append(args, "-threads", strconv.Itoa(threads))
+	}
+	args = append(args,
+		"-map", "[mp4]", "-an", "-c:v", "libx264", "-preset", "veryfast", "-crf", "32",
+		"-maxrate", "250k", "-bufsize", "500k", "-pix_fmt", "yuv420p", "-movflags", "+faststart",
+		"-y", filepath.Join(dir, PreviewMP4),
+		"-map", "[webp]", "-an", "-c:v", "libwebp", "-quality", "50", "-loop", "0",
+		"-y", filepath.Join(dir, PreviewWebP))
+	err = runFFmpeg(ctx, "preview", args...)
+	telemetry.EndSpan(span, err)
+	if err != nil {
+		return fmt.Errorf("erro ao gerar prévia animada: %w", err)
+	}
+	return nil
+}
+
+// previewClips retorna o início de cada trecho e a duração dos trechos, em
+// segundos. Vídeos curtos demais para os trechos viram um trecho só, do
+// começo; os trechos nunca se sobrepõem.
+func previewClips(duration float64, opts PreviewOptions) ([]float64, float64) {
+	length := opts.ClipLength.Seconds()
+	if duration <= float64(opts.Clips)*length {
+		return []float64{0}, math.Min(duration, float64(opts.Clips)*length)
+	}
+	starts := make([]float64, opts.Clips)
+	if spacing := duration / float64(opts.Clips+1); opts.Clips > 1 && spacing < length {
+		// Centrados, os trechos se sobreporiam e repetiriam quadros: ficam
+		// distribuídos do começo ao fim do vídeo
+		step := (duration - length) / float64(opts.Clips-1)
+		for i := range starts {
+			starts[i] = float64(i) * step
+		}
+		return starts, length
+	}
+	for i := range starts {
+		center := duration * float64(i+1) / float64(opts.Clips+1)
+		starts[i] = math.Max(0, math.Min(center-length/2, duration-length))
+	}
+	return starts, length
+}
@@ -0,0 +1,51 @@
+package services
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestPreviewClips(t *testing.T) {
+	tests := []struct {
+		name       string
+		duration   float64
+		opts       PreviewOptions
+		wantStarts []float64
+		wantLength float64
+	}{
+		{"trechos espalhados", 100, PreviewOptions{Clips: 4, ClipLength: 1500 * time.Millisecond}, []float64{19.25, 39.25, 59.25, 79.25}, 1.5},
+		{"um trecho no meio", 10, PreviewOptions{Clips: 1, ClipLength: 2 * time.Second}, []float64{4}, 2},
+		{"vídeo pouco maior que os trechos", 6.5, PreviewOptions{Clips: 4, ClipLength: 1500 * time.Millisecond}, []float64{0, 5.0 / 3, 10.0 / 3, 5}, 1.5},
+		{"trechos cabem só lado a lado", 7, PreviewOptions{Clips: 4, ClipLength: 1500 * time.Millisecond}, []float64{0, 11.0 / 6, 11.0 / 3, 5.5}, 1.5},
+		{"vídeo do tamanho dos trechos", 6, PreviewOptions{Clips: 4, ClipLength: 1500 * time.Millisecond}, []float64{0}, 6},
+		{"vídeo curto vira um trecho", 3.2, PreviewOptions{Clips: 4, ClipLength: 1500 * time.Millisecond}, []float64{0}, 3.2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			starts, length := previewClips(tt.duration, tt.opts)
+			if !almostEqual(length, tt.wantLength) {
+				t.Errorf("duração = %v, esperado %v", length, tt.wantLength)
+			}
+			if len(starts) != len(tt.wantStarts) {
+				t.Fatalf("inícios = %v, esperado %v", starts, tt.wantStarts)
+			}
+			for i, start := range starts {
+				if !almostEqual(start, tt.wantStarts[i]) {
+					t.Errorf("inícios = %v, esperado %v", starts, tt.wantStarts)
+					break
+				}
+				if start < 0 || start+length > tt.duration+1e-9 {
+					t.Errorf("trecho %d (%v+%v) fora do vídeo de %vs", i, start, length, tt.duration)
+				}
+				if i > 0 && start < starts[i-1]+length {
+					t.Errorf("trechos %d e %d se sobrepõem: %v", i-1, i, starts)
+				}
+			}
+		})
+	}
+}
+
+func almostEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
@@ -0,0 +1,103 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ProbeDuration retorna a duração do vídeo em segundos usando o ffprobe.
+func ProbeDuration(ctx context.Context, inputPath string) (float64, error) {
+	out, err := exec.CommandContext(ctx, "ffprobe",
+		"-v", "error",
+		"-show_entries", "format=duration",
+		"-of", "default=noprint_wrappers=1:nokey=1",
+		inputPath,
+	).Output()
+	if err != nil {
+		return 0, fmt.Errorf("erro ao obter duração de %s: %v", inputPath, err)
+	}
+
+	duration, err := strconv.ParseFloat(strings.TrimSpace(string(out)), 64)
+	if err != nil {
+		return 0, fmt.Errorf("duração inválida para %s: %q", inputPath, out)
+	}
+	return duration, nil
+}
+
+// ProbeKeyframeInterval retorna o maior intervalo entre quadros-chave do
+// primeiro fluxo de vídeo, medido nos primeiros window do arquivo (só os
+// quadros-chave são lidos). Com menos de dois quadros-chave na janela, o
+// intervalo é a própria janela.
+func ProbeKeyframeInterval(ctx context.Context, inputPath string, window time.Duration) (time.Duration, error) {
+	out, err := exec.CommandContext(ctx, "ffprobe",
+		"-v", "error",
+		"-select_streams", "v:0",
+		"-skip_frame", "nokey",
+		"-read_intervals", fmt.Sprintf("%%+%g", window.Seconds()),
+		"-show_entries", "frame=best_effort_timestamp_time",
+		"-of", "csv=p=0",
+		inputPath,
+	).Output()
+	if err != nil {
+		return 0, fmt.Errorf("erro ao obter quadros-chave de %s: %v", inputPath, err)
+	}
+
+	var previous float64
+	var largest time.Duration
+	keyframes := 0
+	for _, line := range strings.Fields(string(out)) {
+		at, err := strconv.ParseFloat(strings.Trim(line, ","), 64)
+		if err != nil {
+			// Quadros sem carimbo de tempo (N/A) são ignorados
+			continue
+		}
+		if keyframes > 0 {
+			largest = max(largest, time.Duration((at-previous)*float64(time.Second)))
+		}
+		previous = at
+		keyframes++
+	}
+	if keyframes < 2 {
+		return window, nil
+	}
+	return largest, nil
+}
+
+// ProbeJSON retorna a saída do ffprobe em JSON (formato e streams) do
+// arquivo, para o diagnóstico de falhas. Se o ffprobe falhar, o erro traz a
+// saída de erro dele.
+func ProbeJSON(ctx context.Context, inputPath string) (json.RawMessage, error) {
+	cmd := exec.CommandContext(ctx, "ffprobe",
+		"-v", "error",
+		"-show_format",
+		"-show_streams",
+		"-of", "json",
+		inputPath,
+	)
+	stderr := &tailBuffer{max: stderrTailSize}
+	cmd.Stderr = stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("ffprobe falhou: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	if !json.Valid(out) {
+		return nil, fmt.Errorf("ffprobe retornou JSON inválido")
+	}
+	return out, nil
+}
+
+// BinaryVersion retorna a primeira linha de "<binário> -version", usada para
+// verificar se ffmpeg e ffprobe estão instalados.
+func BinaryVersion(ctx context.Context, binary string) (string, error) {
+	out, err := exec.CommandContext(ctx, binary, "-version").Output()
+	if err != nil {
+		return "", fmt.Errorf("%s indisponível: %v", binary, err)
+	}
+	line, _, _ := strings.Cut(string(out), "\n")
+	return strings.TrimSpace(line), nil
+}
@@ -1,15 +1,92 @@
 package services
 
 import (
+	"context"
 	"fmt"
-	"os/exec"
+	"image"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"streaming-platform/internal/telemetry"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Formatos das miniaturas redimensionadas, do preferido ao mais compatível
+const (
+	ThumbnailWebP = "webp"
+	ThumbnailJPEG = "jpg"
 )
 
-func GenerateThumbnail(videoPath, outputPath string) error {
-	cmd := exec.Command("ffmpeg", "-i", videoPath, "-ss", "00:00:01.000", "-vframes", "1", outputPath)
-	err := cmd.Run()
+var ThumbnailFormats = []string{ThumbnailWebP, ThumbnailJPEG}
+
+func GenerateThumbnail(ctx context.Context, videoPath, outputPath string) error {
+	ctx, span := telemetry.StartSpan(ctx, "ffmpeg.thumbnail")
+	err := runFFmpeg(ctx, "thumbnail", "-i", videoPath, "-ss", "00:00:01.000", "-vframes", "1", outputPath)
+	telemetry.EndSpan(span, err)
 	if err != nil {
-		return fmt.Errorf("failed to generate thumbnail: %v", err)
+		return fmt.Errorf("failed to generate thumbnail: %w", err)
 	}
 	return nil
 }
+
+// ThumbnailFile retorna o nome da miniatura com a largura e o formato
+// informados: {largura}w.{formato}.
+func ThumbnailFile(width int, format string) string {
+	return strconv.Itoa(width) + "w." + format
+}
+
+// ResizeThumbnail gera a imagem em cada largura de widths, em WebP e JPEG,
+// dentro de dir, e retorna as larguras geradas em ordem crescente. Larguras
+// maiores que a da imagem são puladas (ampliar só pesa mais), mas a menor é
+// sempre gerada.
+func ResizeThumbnail(ctx context.Context, imagePath, dir string, widths []int) ([]int, error) {
+	source, err := imageWidth(imagePath)
+	if err != nil {
+		return nil, err
+	}
+	sorted := append([]int(nil), widths...)
+	sort.Ints(sorted)
+	var selected []int
+	for i, width := range sorted {
+		if width <= source || i == 0 {
+			selected = append(selected, width)
+		}
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("erro ao criar diretório das miniaturas: %v", err)
+	}
+
+	ctx, span := telemetry.StartSpan(ctx, "ffmpeg.thumbnail_sizes", attribute.Int("thumbnail.sizes", len(selected)))
+	for _, width := range selected {
+		scale := fmt.Sprintf("scale=%d:-2", width)
+		err = runFFmpeg(ctx, "thumbnail",
+			"-i", imagePath,
+			"-vf", scale, "-frames:v", "1", "-c:v", "libwebp", "-quality", "80", "-y", filepath.Join(dir, ThumbnailFile(width, ThumbnailWebP)),
+			"-vf", scale, "-frames:v", "1", "-q:v", "3", "-y", filepath.Join(dir, ThumbnailFile(width, ThumbnailJPEG)))
+		if err != nil {
+			break
+		}
+	}
+	telemetry.EndSpan(span, err)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao redimensionar miniatura: %w", err)
+	}
+	return selected, nil
+}
+
+// imageWidth lê só o cabeçalho da imagem para obter a largura.
+func imageWidth(path string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	config, _, err := image.DecodeConfig(file)
+	if err != nil {
+		return 0, fmt.Errorf("erro ao ler miniatura %s: %v", filepath.Base(path), err)
+	}
+	return config.Width, nil
+}
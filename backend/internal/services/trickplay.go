@@ -0,0 +1,188 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"streaming-platform/internal/hls"
+	"streaming-platform/internal/telemetry"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Arquivos das prévias de navegação (trickplay) dentro da saída de um vídeo
+const (
+	TrickplayDir   = "trickplay"
+	TrickplayIndex = "thumbnails.vtt"
+)
+
+// TrickplayOptions define as prévias de navegação: um quadro a cada
+// Interval, reduzido para Width pixels de largura (altura em 16:9) e montado
+// em folhas de Columns x Rows quadros.
+type TrickplayOptions struct {
+	Interval time.Duration
+	Width    int
+	Columns  int
+	Rows     int
+}
+
+// NewTrickplayOptions retorna as opções das prévias de navegação em folhas
+// de 10x10 quadros.
+func NewTrickplayOptions(interval time.Duration, width int) TrickplayOptions {
+	return TrickplayOptions{
+		Interval: interval,
+		Width:    width,
+		Columns:  10,
+		Rows:     10,
+	}
+}
+
+// Enabled indica se as prévias devem ser geradas.
+func (o TrickplayOptions) Enabled() bool {
+	return o.Interval > 0 && o.Width > 0
+}
+
+// height retorna a altura de cada quadro, em 16:9 e par (exigência do x264
+// e da maioria dos decodificadores de imagem).
+func (o TrickplayOptions) height() int {
+	return (o.Width*9/16 + 1) &^ 1
+}
+
+// keyframeProbeWindow é o trecho do original em que o intervalo entre
+// quadros-chave é medido.
+const keyframeProbeWindow = 2 * time.Minute
+
+// AddTrickplay gera as folhas de prévias e o índice WebVTT que liga cada
+// intervalo de tempo a um recorte (#xywh) de uma folha, e os acrescenta ao
+// manifesto para serem publicados com a versão. Os players usam o índice
+// como trilha de miniaturas ao arrastar a barra de progresso. threads é a
+// cota inteira do job (scheduler.JobThreads): as prévias rodam depois da
+// transcodificação, sem disputar CPU com ela.
+func AddTrickplay(ctx context.Context, manifest *Manifest, videoPath string, opts TrickplayOptions, threads int) error {
+	duration, err := ProbeDuration(ctx, videoPath)
+	if err != nil {
+		return err
+	}
+	if duration <= 0 {
+		return fmt.Errorf("duração inválida para as prévias: %v", duration)
+	}
+
+	dir := manifest.LocalPath(TrickplayDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("erro ao criar diretório das prévias: %v", err)
+	}
+
+	width, height := opts.Width, opts.height()
+	perSheet := opts.Columns * opts.Rows
+	interval := opts.Interval.Seconds()
+	frames := int(math.Ceil(duration / interval))
+
+	ctx, span := telemetry.StartSpan(ctx, "ffmpeg.trickplay",
+		attribute.String("video.id", manifest.VideoID),
+		attribute.Int("trickplay.frames", frames),
+	)
+	filter := fmt.Sprintf("fps=1/%g,scale=%d:%d:force_original_aspect_ratio=decrease,pad=%d:%d:(ow-iw)/2:(oh-ih)/2,tile=%dx%d",
+		interval, width, height, width, height, opts.Columns, opts.Rows)
+	var args []string
+	// Decodificar só os quadros-chave custa uma fração da transcodificação,
+	// mas só serve quando há um a cada intervalo: com GOPs mais longos (telas
+	// paradas, gravações de tela) o fps repetiria o mesmo quadro por várias
+	// células e as miniaturas não acompanhariam o vídeo
+	keyframeInterval, err := ProbeKeyframeInterval(ctx, videoPath, keyframeProbeWindow)
+	if err == nil && keyframeInterval <= opts.Interval {
+		args = append(args, "-skip_frame", "nokey")
+	}
+	span.SetAttributes(attribute.Bool("trickplay.keyframes_only", len(args) > 0))
+	args = append(args, "-i", videoPath, "-an", "-vf", filter, "-q:v", "5")
+	if threads > 0 {
+		args = append(args, "-threads", strconv.Itoa(threads))
+	}
+	args = append(args, filepath.Join(dir, "sprite_%03d.jpg"))
+	err = runFFmpeg(ctx, "trickplay", args...)
+	telemetry.EndSpan(span, err)
+	if err != nil {
+		return fmt.Errorf("erro ao gerar prévias de navegação: %w", err)
+	}
+
+	// A duração do ffprobe pode divergir um pouco do que o ffmpeg decodificou:
+	// o índice cobre só as folhas que existem
+	var sheets []string
+	for i := 1; (i-1)*perSheet < frames; i++ {
+		sheet := fmt.Sprintf("sprite_%03d.jpg", i)
+		if _, err := os.Stat(filepath.Join(dir, sheet)); err != nil {
+			break
+		}
+		sheets = append(sheets, sheet)
+	}
+	if len(sheets) == 0 {
+		return fmt.Errorf("nenhuma folha de prévias foi gerada")
+	}
+	frames = min(frames, len(sheets)*perSheet)
+
+	var vtt strings.Builder
+	vtt.WriteString("WEBVTT\n")
+	for i := 0; i < frames; i++ {
+		start := float64(i) * interval
+		end := math.Min(start+interval, duration)
+		tile := i % perSheet
+		fmt.Fprintf(&vtt, "\n%s --> %s\n%s#xywh=%d,%d,%d,%d\n",
+			vttTimestamp(start), vttTimestamp(end), sheets[i/perSheet],
+			(tile%opts.Columns)*width, (tile/opts.Columns)*height, width, height)
+	}
+	if err := os.WriteFile(filepath.Join(dir, TrickplayIndex), []byte(vtt.String()), 0644); err != nil {
+		return fmt.Errorf("erro ao gravar índice das prévias: %v", err)
+	}
+
+	for _, sheet := range sheets {
+		manifest.Assets = append(manifest.Assets, path.Join(TrickplayDir, sheet))
+	}
+	manifest.Assets = append(manifest.Assets, path.Join(TrickplayDir, TrickplayIndex))
+	manifest.Trickplay = path.Join(TrickplayDir, TrickplayIndex)
+	return nil
+}
+
+// vttTimestamp formata segundos como HH:MM:SS.mmm.
+func vttTimestamp(seconds float64) string {
+	ms := int64(math.Round(seconds * 1000))
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
+
+// RewriteVTTImages reescreve as URIs de imagem das cues de um índice de
+// prévias, mantendo o fragmento #xywh, como hls.RewriteURIs faz com as
+// playlists.
+func RewriteVTTImages(data []byte, rewrite hls.RewriteFunc) ([]byte, error) {
+	var out bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	previousTiming := false
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		// A linha de conteúdo vem logo depois da linha de tempo da cue
+		if previousTiming && line != "" {
+			uri, fragment, _ := strings.Cut(line, "#")
+			newURI, err := rewrite(uri)
+			if err != nil {
+				return nil, err
+			}
+			line = newURI
+			if fragment != "" {
+				line += "#" + fragment
+			}
+		}
+		previousTiming = strings.Contains(line, "-->")
+		out.WriteString(line)
+		out.WriteByte('\n')
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
@@ -0,0 +1,132 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"streaming-platform/internal/hls"
+)
+
+// Nomes dos arquivos HLS dentro da saída de um vídeo
+const (
+	MasterPlaylistName = "master.m3u8"
+	MediaPlaylistName  = "playlist.m3u8"
+)
+
+// Workspace é o diretório local de trabalho de um processamento: o original
+// baixado, a saída HLS e a miniatura ficam todos aqui, e Cleanup remove tudo.
+type Workspace struct {
+	Dir string
+}
+
+// WorkspacePrefix é o prefixo dos diretórios de trabalho, usado também para
+// reconhecer sobras de processamentos interrompidos.
+const WorkspacePrefix = "transcode-"
+
+// NewWorkspace cria dentro de root (ou do diretório temporário do sistema, se
+// vazio) um diretório de trabalho exclusivo para o vídeo, de forma que
+// processamentos simultâneos (inclusive do mesmo vídeo) não se misturem.
+func NewWorkspace(root, videoID string) (*Workspace, error) {
+	dir, err := os.MkdirTemp(root, WorkspacePrefix+safeName(videoID)+"-")
+	if err != nil {
+		return nil, fmt.Errorf("erro ao criar diretório de trabalho: %v", err)
+	}
+	return &Workspace{Dir: dir}, nil
+}
+
+// Path retorna um caminho dentro do workspace.
+func (w *Workspace) Path(elem ...string) string {
+	return filepath.Join(append([]string{w.Dir}, elem...)...)
+}
+
+// HLSDir é onde TranscodeVideoToHLS grava master, playlists e segmentos.
+func (w *Workspace) HLSDir() string {
+	return w.Path("hls")
+}
+
+// Cleanup remove o workspace e tudo o que ele contém.
+func (w *Workspace) Cleanup() error {
+	return os.RemoveAll(w.Dir)
+}
+
+// Rendition é uma qualidade produzida pela transcodificação.
+type Rendition struct {
+	Quality  string   `json:"quality"`
+	Playlist string   `json:"playlist"`
+	Segments []string `json:"segments"`
+}
+
+// Manifest descreve os arquivos produzidos por TranscodeVideoToHLS. Os
+// caminhos são relativos a Dir e usam "/", como no bucket.
+type Manifest struct {
+	VideoID    string      `json:"videoId"`
+	Dir        string      `json:"-"`
+	Master     string      `json:"master"`
+	Renditions []Rendition `json:"renditions"`
+	// Assets são os demais arquivos publicados com a versão, como as prévias
+	// de navegação; Trickplay é o índice WebVTT delas, se geradas.
+	Assets    []string `json:"assets,omitempty"`
+	Trickplay string   `json:"trickplay,omitempty"`
+	// Keys são os IDs das chaves de cifragem dos segmentos, se cifrados.
+	Keys []string `json:"keys,omitempty"`
+}
+
+// Files retorna todos os artefatos do manifesto, com os segmentos e os
+// demais arquivos antes das playlists de mídia e o master por último:
+// publicar nessa ordem garante que nenhuma playlist aponte para um arquivo
+// que ainda não existe.
+func (m *Manifest) Files() []string {
+	var files []string
+	for _, rendition := range m.Renditions {
+		files = append(files, rendition.Segments...)
+	}
+	files = append(files, m.Assets...)
+	for _, rendition := range m.Renditions {
+		files = append(files, rendition.Playlist)
+	}
+	return append(files, m.Master)
+}
+
+// LocalPath retorna o caminho local de um arquivo do manifesto.
+func (m *Manifest) LocalPath(file string) string {
+	return filepath.Join(m.Dir, filepath.FromSlash(file))
+}
+
+// addRendition lê a playlist de mídia gerada e registra os segmentos que ela
+// referencia, conferindo que todos existem no disco.
+func (m *Manifest) addRendition(quality string) error {
+	rendition := Rendition{Quality: quality, Playlist: path.Join(quality, MediaPlaylistName)}
+
+	data, err := os.ReadFile(m.LocalPath(rendition.Playlist))
+	if err != nil {
+		return fmt.Errorf("playlist da qualidade %s não foi gerada: %v", quality, err)
+	}
+	uris, err := hls.URIs(data)
+	if err != nil {
+		return fmt.Errorf("playlist inválida da qualidade %s: %v", quality, err)
+	}
+	for _, uri := range uris {
+		segment := path.Join(quality, uri)
+		if _, err := os.Stat(m.LocalPath(segment)); err != nil {
+			return fmt.Errorf("segmento ausente na qualidade %s: %v", quality, err)
+		}
+		rendition.Segments = append(rendition.Segments, segment)
+	}
+
+	m.Renditions = append(m.Renditions, rendition)
+	return nil
+}
+
+// safeName mantém apenas caracteres seguros para nomes de diretório.
+func safeName(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		}
+		return '_'
+	}, s)
+}
@@ -0,0 +1,92 @@
+package signing
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrMissingToken = errors.New("token de acesso ausente")
+	ErrInvalidToken = errors.New("token de acesso inválido")
+	ErrExpiredToken = errors.New("token de acesso expirado")
+)
+
+// Signer gera e valida tokens HMAC com expiração para URLs de reprodução.
+// O token é vinculado a um recurso (por exemplo, o ID do vídeo), de modo que
+// um único token vale para o master, as playlists de mídia e os segmentos.
+type Signer struct {
+	secret []byte
+	ttl    time.Duration
+}
+
+// NewSigner cria um Signer com o segredo e a validade padrão informados.
+func NewSigner(secret string, ttl time.Duration) *Signer {
+	return &Signer{secret: []byte(secret), ttl: ttl}
+}
+
+// TTL retorna a validade padrão dos tokens emitidos.
+func (s *Signer) TTL() time.Duration {
+	return s.ttl
+}
+
+// Sign retorna os parâmetros de query (expires e token) que autorizam o
+// acesso ao recurso até now + TTL.
+func (s *Signer) Sign(resource string) url.Values {
+	return s.SignUntil(resource, time.Now().Add(s.ttl))
+}
+
+// SignUntil retorna os parâmetros de query que autorizam o acesso ao recurso
+// até o instante informado.
+func (s *Signer) SignUntil(resource string, expires time.Time) url.Values {
+	exp := strconv.FormatInt(expires.Unix(), 10)
+	return url.Values{
+		"expires": {exp},
+		"token":   {s.mac(resource, exp)},
+	}
+}
+
+// Verify valida os parâmetros de query recebidos para o recurso.
+func (s *Signer) Verify(resource string, query url.Values) error {
+	exp := query.Get("expires")
+	token := query.Get("token")
+	if exp == "" || token == "" {
+		return ErrMissingToken
+	}
+
+	expUnix, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil {
+		return ErrInvalidToken
+	}
+
+	expected := s.mac(resource, exp)
+	if !hmac.Equal([]byte(expected), []byte(token)) {
+		return ErrInvalidToken
+	}
+
+	if time.Now().Unix() > expUnix {
+		return ErrExpiredToken
+	}
+	return nil
+}
+
+// Expiry retorna o instante de expiração contido nos parâmetros de query.
+func Expiry(query url.Values) (time.Time, bool) {
+	expUnix, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(expUnix, 0), true
+}
+
+func (s *Signer) mac(resource, exp string) string {
+	h := hmac.New(sha256.New, s.secret)
+	h.Write([]byte(resource))
+	h.Write([]byte{'\n'})
+	h.Write([]byte(exp))
+	return hex.EncodeToString(h.Sum(nil))
+}
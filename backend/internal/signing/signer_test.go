@@ -0,0 +1,101 @@
+package signing
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	signer := NewSigner("segredo", time.Hour)
+	other := NewSigner("outro-segredo", time.Hour)
+	valid := signer.Sign("video-1")
+	tampered := []byte(valid.Get("token"))
+	tampered[0] ^= 1
+
+	tests := []struct {
+		name     string
+		resource string
+		query    url.Values
+		want     error
+	}{
+		{"token válido", "video-1", valid, nil},
+		{"outro recurso", "video-2", valid, ErrInvalidToken},
+		{"outro segredo", "video-1", other.Sign("video-1"), ErrInvalidToken},
+		{"sem token", "video-1", url.Values{"expires": valid["expires"]}, ErrMissingToken},
+		{"sem expiração", "video-1", url.Values{"token": valid["token"]}, ErrMissingToken},
+		{"expiração inválida", "video-1", url.Values{"expires": {"amanhã"}, "token": valid["token"]}, ErrInvalidToken},
+		{
+			"expiração alterada",
+			"video-1",
+			url.Values{"expires": {"9999999999"}, "token": valid["token"]},
+			ErrInvalidToken,
+		},
+		{
+			"token alterado",
+			"video-1",
+			url.Values{"expires": valid["expires"], "token": {string(tampered)}},
+			ErrInvalidToken,
+		},
+		{"expirado", "video-1", signer.SignUntil("video-1", time.Now().Add(-time.Minute)), ErrExpiredToken},
+		{"no limite", "video-1", signer.SignUntil("video-1", time.Now().Add(time.Second)), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := signer.Verify(tt.resource, tt.query)
+			if !errors.Is(err, tt.want) || (tt.want == nil && err != nil) {
+				t.Errorf("Verify(%q) = %v, esperado %v", tt.resource, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSignUsesTTL(t *testing.T) {
+	tests := []struct {
+		name string
+		ttl  time.Duration
+	}{
+		{"uma hora", time.Hour},
+		{"dois minutos", 2 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signer := NewSigner("segredo", tt.ttl)
+			before := time.Now()
+			expires, ok := Expiry(signer.Sign("video-1"))
+			if !ok {
+				t.Fatal("Sign não retornou expires")
+			}
+			// expires tem resolução de segundos
+			want := before.Add(tt.ttl).Truncate(time.Second)
+			if expires.Before(want) || expires.After(want.Add(time.Second)) {
+				t.Errorf("expires = %v, esperado perto de %v", expires, want)
+			}
+			if signer.TTL() != tt.ttl {
+				t.Errorf("TTL() = %v, esperado %v", signer.TTL(), tt.ttl)
+			}
+		})
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  url.Values
+		want   time.Time
+		wantOK bool
+	}{
+		{"válida", url.Values{"expires": {"1700000000"}}, time.Unix(1700000000, 0), true},
+		{"ausente", url.Values{}, time.Time{}, false},
+		{"inválida", url.Values{"expires": {"x"}}, time.Time{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := Expiry(tt.query)
+			if ok != tt.wantOK || !got.Equal(tt.want) {
+				t.Errorf("Expiry() = %v, %v; esperado %v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,204 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"streaming-platform/internal/metrics"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+var (
+	ErrNotFound            = errors.New("objeto não encontrado")
+	ErrNotModified         = errors.New("objeto não modificado")
+	ErrPreconditionFailed  = errors.New("pré-condição falhou")
+	ErrRangeNotSatisfiable = errors.New("intervalo inválido")
+)
+
+// ObjectOptions são os cabeçalhos condicionais e de intervalo repassados ao S3.
+type ObjectOptions struct {
+	Range           string
+	IfMatch         string
+	IfNoneMatch     string
+	IfModifiedSince time.Time
+}
+
+// Object é um objeto do bucket. Body é nil quando obtido com StatObject.
+type Object struct {
+	Body          io.ReadCloser
+	ContentLength int64
+	ContentRange  string
+	ContentType   string
+	ETag          string
+	LastModified  time.Time
+}
+
+// GetObject abre um objeto para leitura em streaming, repassando ao S3 o
+// intervalo e as condições informadas. O chamador deve fechar Body.
+func (s *S3Client) GetObject(ctx context.Context, key string, opts ObjectOptions) (*Object, error) {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(s.BucketName),
+		Key:    aws.String(key),
+	}
+	if opts.Range != "" {
+		input.Range = aws.String(opts.Range)
+	}
+	if opts.IfMatch != "" {
+		input.IfMatch = aws.String(opts.IfMatch)
+	}
+	if opts.IfNoneMatch != "" {
+		input.IfNoneMatch = aws.String(opts.IfNoneMatch)
+	}
+	if !opts.IfModifiedSince.IsZero() {
+		input.IfModifiedSince = aws.Time(opts.IfModifiedSince)
+	}
+
+	result, err := s.S3Service.GetObjectWithContext(ctx, input)
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	return &Object{
+		Body: &countingReadCloser{
+			countingReader: countingReader{Reader: result.Body, direction: "download"},
+			Closer:         result.Body,
+		},
+		ContentLength: aws.Int64Value(result.ContentLength),
+		ContentRange:  aws.StringValue(result.ContentRange),
+		ContentType:   aws.StringValue(result.ContentType),
+		ETag:          aws.StringValue(result.ETag),
+		LastModified:  aws.TimeValue(result.LastModified),
+	}, nil
+}
+
+// StatObject retorna os metadados de um objeto sem baixar o conteúdo.
+func (s *S3Client) StatObject(ctx context.Context, key string, opts ObjectOptions) (*Object, error) {
+	input := &s3.HeadObjectInput{
+		Bucket: aws.String(s.BucketName),
+		Key:    aws.String(key),
+	}
+	if opts.IfMatch != "" {
+		input.IfMatch = aws.String(opts.IfMatch)
+	}
+	if opts.IfNoneMatch != "" {
+		input.IfNoneMatch = aws.String(opts.IfNoneMatch)
+	}
+	if !opts.IfModifiedSince.IsZero() {
+		input.IfModifiedSince = aws.Time(opts.IfModifiedSince)
+	}
+
+	result, err := s.S3Service.HeadObjectWithContext(ctx, input)
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	return &Object{
+		ContentLength: aws.Int64Value(result.ContentLength),
+		ContentType:   aws.StringValue(result.ContentType),
+		ETag:          aws.StringValue(result.ETag),
+		LastModified:  aws.TimeValue(result.LastModified),
+	}, nil
+}
+
+// PutIfAbsent grava o objeto só se a chave ainda não existir
+// (If-None-Match: *) e retorna o ETag gravado. Se a chave já existe, retorna
+// ErrPreconditionFailed.
+func (s *S3Client) PutIfAbsent(ctx context.Context, key string, data []byte) (string, error) {
+	return s.putConditional(ctx, key, data, "If-None-Match", "*")
+}
+
+// PutIfMatch substitui o objeto só se o ETag atual for etag e retorna o novo
+// ETag. Se o objeto mudou, retorna ErrPreconditionFailed; se não existe mais,
+// ErrNotFound.
+func (s *S3Client) PutIfMatch(ctx context.Context, key string, data []byte, etag string) (string, error) {
+	return s.putConditional(ctx, key, data, "If-Match", etag)
+}
+
+// putConditional envia um PutObject com um cabeçalho condicional. A versão do
+// SDK não expõe esses campos no PutObjectInput, então o cabeçalho é incluído
+// direto na requisição, antes da assinatura.
+func (s *S3Client) putConditional(ctx context.Context, key string, data []byte, header, value string) (string, error) {
+	input := &s3.PutObjectInput{
+		Bucket: aws.String(s.BucketName),
+		Key:    aws.String(key),
+		Body:   bytes.NewReader(data),
+	}
+	if contentType := ContentType(key); contentType != "" {
+		input.ContentType = aws.String(contentType)
+	}
+
+	req, output := s.S3Service.PutObjectRequest(input)
+	req.SetContext(ctx)
+	req.HTTPRequest.Header.Set(header, value)
+	if err := req.Send(); err != nil {
+		// O S3 responde 409 quando outra escrita condicional na mesma chave
+		// está em andamento: para quem chama, é a mesma disputa perdida
+		var reqErr awserr.RequestFailure
+		if errors.As(err, &reqErr) && reqErr.StatusCode() == http.StatusConflict {
+			return "", ErrPreconditionFailed
+		}
+		return "", translateError(err)
+	}
+	metrics.StorageBytes.WithLabelValues("upload").Add(float64(len(data)))
+	return aws.StringValue(output.ETag), nil
+}
+
+// Copy copia o objeto src para dst no mesmo bucket, com o mesmo tipo de
+// conteúdo. A cópia acontece no S3, sem passar os dados pelo processo.
+func (s *S3Client) Copy(ctx context.Context, src, dst string) error {
+	source := url.URL{Path: s.BucketName + "/" + src}
+	_, err := s.S3Service.CopyObjectWithContext(ctx, &s3.CopyObjectInput{
+		Bucket:     aws.String(s.BucketName),
+		Key:        aws.String(dst),
+		CopySource: aws.String(source.EscapedPath()),
+	})
+	return translateError(err)
+}
+
+// DeleteIfMatch remove o objeto só se o ETag atual for etag. Se o objeto
+// mudou, retorna ErrPreconditionFailed; se não existe mais, ErrNotFound. Como
+// em putConditional, o cabeçalho vai direto na requisição.
+func (s *S3Client) DeleteIfMatch(ctx context.Context, key, etag string) error {
+	req, _ := s.S3Service.DeleteObjectRequest(&s3.DeleteObjectInput{
+		Bucket: aws.String(s.BucketName),
+		Key:    aws.String(key),
+	})
+	req.SetContext(ctx)
+	req.HTTPRequest.Header.Set("If-Match", etag)
+	if err := req.Send(); err != nil {
+		var reqErr awserr.RequestFailure
+		if errors.As(err, &reqErr) && reqErr.StatusCode() == http.StatusConflict {
+			return ErrPreconditionFailed
+		}
+		return translateError(err)
+	}
+	return nil
+}
+
+// translateError converte as respostas de erro do S3 nos erros do pacote.
+func translateError(err error) error {
+	var reqErr awserr.RequestFailure
+	if !errors.As(err, &reqErr) {
+		return err
+	}
+
+	switch reqErr.StatusCode() {
+	case http.StatusNotFound:
+		return ErrNotFound
+	case http.StatusNotModified:
+		return ErrNotModified
+	case http.StatusPreconditionFailed:
+		return ErrPreconditionFailed
+	case http.StatusRequestedRangeNotSatisfiable:
+		return ErrRangeNotSatisfiable
+	}
+	return err
+}
@@ -1,22 +1,57 @@
 package storage
 
 import (
-	"bytes"
 	"context"
 	"fmt"
 	"io"
+	"mime"
 	"mime/multipart"
 	"os"
+	"path"
 	"strings"
+	"time"
+
+	"streaming-platform/internal/metrics"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// Tamanho das partes e concorrência das transferências multipart
+const (
+	transferPartSize    = 16 * 1024 * 1024
+	transferConcurrency = 4
 )
 
+// Tipos dos arquivos de mídia que nem sempre constam na base MIME do sistema
+var contentTypes = map[string]string{
+	".m3u8": "application/vnd.apple.mpegurl",
+	".ts":   "video/mp2t",
+	".m4s":  "video/iso.segment",
+	".mp4":  "video/mp4",
+	".aac":  "audio/aac",
+	".vtt":  "text/vtt",
+	".jpg":  "image/jpeg",
+	".webp": "image/webp",
+}
+
+// ContentType retorna o tipo MIME de um arquivo pela extensão, ou "" se
+// desconhecido.
+func ContentType(key string) string {
+	ext := path.Ext(key)
+	if t, ok := contentTypes[ext]; ok {
+		return t
+	}
+	return mime.TypeByExtension(ext)
+}
+
 type S3Client struct {
 	BucketName string
 	S3Service  *s3.S3
+	Uploader   *s3manager.Uploader
+	Downloader *s3manager.Downloader
 }
 
 // Função para criar um novo cliente S3
@@ -28,41 +63,110 @@ func NewS3Client(bucketName, region string) (*S3Client, error) {
 		return nil, err
 	}
 
+	service := s3.New(sess)
+	instrument(service, bucketName)
+
 	return &S3Client{
 		BucketName: bucketName,
-		S3Service:  s3.New(sess),
+		S3Service:  service,
+		Uploader: s3manager.NewUploaderWithClient(service, func(u *s3manager.Uploader) {
+			u.PartSize = transferPartSize
+			u.Concurrency = transferConcurrency
+		}),
+		Downloader: s3manager.NewDownloaderWithClient(service, func(d *s3manager.Downloader) {
+			d.PartSize = transferPartSize
+			d.Concurrency = transferConcurrency
+		}),
 	}, nil
 }
 
-// Função para fazer upload de um arquivo para o S3
-func (s *S3Client) UploadFile(ctx context.Context, file multipart.File, fileName string) error {
-	// Cria um buffer para armazenar o arquivo
-	buf := bytes.NewBuffer(nil)
-	if _, err := io.Copy(buf, file); err != nil {
-		return err
+// Put envia o conteúdo do reader para o S3 em streaming. Arquivos grandes são
+// enviados em partes concorrentes, sem carregar o arquivo inteiro em memória.
+func (s *S3Client) Put(ctx context.Context, s3Key string, body io.Reader) error {
+	input := &s3manager.UploadInput{
+		Bucket: aws.String(s.BucketName),
+		Key:    aws.String(s3Key),
+		Body:   &countingReader{Reader: body, direction: "upload"},
+	}
+	if contentType := ContentType(s3Key); contentType != "" {
+		input.ContentType = aws.String(contentType)
 	}
 
-	// Faz o upload do arquivo para o S3
-	_, err := s.S3Service.PutObjectWithContext(ctx, &s3.PutObjectInput{
+	_, err := s.Uploader.UploadWithContext(ctx, input)
+	return err
+}
+
+// countingReader contabiliza nas métricas os bytes que passam pelo reader.
+type countingReader struct {
+	io.Reader
+	direction string
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	metrics.StorageBytes.WithLabelValues(r.direction).Add(float64(n))
+	return n, err
+}
+
+type countingReadCloser struct {
+	countingReader
+	io.Closer
+}
+
+// Get abre um objeto do S3 para leitura em streaming. O chamador deve fechar
+// o reader retornado.
+func (s *S3Client) Get(ctx context.Context, s3Key string) (io.ReadCloser, error) {
+	object, err := s.GetObject(ctx, s3Key, ObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return object.Body, nil
+}
+
+// DownloadToFile baixa um objeto direto para um arquivo local, em partes
+// concorrentes, e retorna o número de bytes gravados.
+func (s *S3Client) DownloadToFile(ctx context.Context, s3Key, filePath string) (int64, error) {
+	file, err := os.Create(filePath)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := s.Downloader.DownloadWithContext(ctx, file, &s3.GetObjectInput{
 		Bucket: aws.String(s.BucketName),
-		Key:    aws.String(fileName),
-		Body:   bytes.NewReader(buf.Bytes()),
+		Key:    aws.String(s3Key),
 	})
-	return err
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(filePath)
+		return 0, translateError(err)
+	}
+	metrics.StorageBytes.WithLabelValues("download").Add(float64(n))
+	return n, nil
 }
 
-// Função para baixar um arquivo do S3
+// Função para fazer upload de um arquivo para o S3
+func (s *S3Client) UploadFile(ctx context.Context, file multipart.File, fileName string) error {
+	return s.Put(ctx, fileName, file)
+}
+
+// Função para baixar um arquivo do S3. Carrega o objeto inteiro em memória:
+// use apenas para arquivos pequenos (playlists, miniaturas) e prefira Get ou
+// DownloadToFile para vídeos.
 func (s *S3Client) DownloadFile(ctx context.Context, s3Key string) ([]byte, error) {
 	result, err := s.S3Service.GetObjectWithContext(ctx, &s3.GetObjectInput{
 		Bucket: aws.String(s.BucketName),
 		Key:    aws.String(s3Key),
 	})
 	if err != nil {
-		return nil, err
+		return nil, translateError(err)
 	}
 	defer result.Body.Close()
 
-	return io.ReadAll(result.Body)
+	data, err := io.ReadAll(result.Body)
+	metrics.StorageBytes.WithLabelValues("download").Add(float64(len(data)))
+	return data, err
 }
 
 // Função para fazer upload de um arquivo de um caminho para o S3
@@ -74,12 +178,7 @@ func (s *S3Client) UploadFileFromPath(ctx context.Context, s3Key, filePath strin
 	defer file.Close()
 
 	// Faz o upload do arquivo para o S3
-	_, err = s.S3Service.PutObjectWithContext(ctx, &s3.PutObjectInput{
-		Bucket: aws.String(s.BucketName),
-		Key:    aws.String(s3Key),
-		Body:   file,
-	})
-	return err
+	return s.Put(ctx, s3Key, file)
 }
 
 // ListFiles lista os arquivos dentro de um prefixo específico no bucket S3.
@@ -100,6 +199,35 @@ func (s *S3Client) ListFiles(ctx context.Context, prefix string) ([]string, erro
 	return fileKeys, nil
 }
 
+// ObjectInfo é uma entrada da listagem de um prefixo.
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+}
+
+// ListObjects lista as chaves de um prefixo com tamanho e data de modificação.
+func (s *S3Client) ListObjects(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	err := s.S3Service.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.BucketName),
+		Prefix: aws.String(prefix),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, item := range page.Contents {
+			objects = append(objects, ObjectInfo{
+				Key:          aws.StringValue(item.Key),
+				Size:         aws.Int64Value(item.Size),
+				LastModified: aws.TimeValue(item.LastModified),
+			})
+		}
+		return !lastPage
+	})
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return objects, nil
+}
+
 func (s *S3Client) ListDirectories(ctx context.Context, prefix string) ([]string, error) {
 	objects, err := s.S3Service.ListObjectsV2WithContext(ctx, &s3.ListObjectsV2Input{
 		Bucket:    aws.String(s.BucketName),
@@ -167,10 +295,81 @@ func (s *S3Client) GetVideoFile(ctx context.Context, videoID string, resolution
 	return "", fmt.Errorf("arquivo 'video.m3u8' não encontrado em %s", prefix)
 }
 
-func (s *S3Client) GetFileURL(fileKey string) (string, error) {
-	// Gerar a URL pública do arquivo
-	url := fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", s.BucketName, *s.S3Service.Config.Region, fileKey)
+// GetSignedURL gera uma URL pré-assinada do arquivo, válida pelo tempo informado.
+// O bucket não precisa ser público: apenas quem recebe a URL consegue acessar o
+// objeto, e somente até a expiração.
+func (s *S3Client) GetSignedURL(fileKey string, expiry time.Duration) (string, error) {
+	req, _ := s.S3Service.GetObjectRequest(&s3.GetObjectInput{
+		Bucket: aws.String(s.BucketName),
+		Key:    aws.String(fileKey),
+	})
+	url, err := req.Presign(expiry)
+	if err != nil {
+		return "", fmt.Errorf("erro ao assinar URL de %s: %v", fileKey, err)
+	}
 	return url, nil
 }
 
 
+
+// Delete remove um objeto do bucket. Remover uma chave inexistente não é erro.
+func (s *S3Client) Delete(ctx context.Context, s3Key string) error {
+	_, err := s.S3Service.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.BucketName),
+		Key:    aws.String(s3Key),
+	})
+	return translateError(err)
+}
+
+// DeletePrefix remove todos os objetos sob o prefixo, em lotes de até 1000
+// chaves, e retorna quantos foram removidos.
+func (s *S3Client) DeletePrefix(ctx context.Context, prefix string) (int, error) {
+	keys, err := s.ListFiles(ctx, prefix)
+	if err != nil {
+		return 0, translateError(err)
+	}
+
+	deleted := 0
+	for start := 0; start < len(keys); start += 1000 {
+		end := start + 1000
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		objects := make([]*s3.ObjectIdentifier, 0, end-start)
+		for _, key := range keys[start:end] {
+			objects = append(objects, &s3.ObjectIdentifier{Key: aws.String(key)})
+		}
+		result, err := s.S3Service.DeleteObjectsWithContext(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(s.BucketName),
+			Delete: &s3.Delete{Objects: objects, Quiet: aws.Bool(true)},
+		})
+		if err != nil {
+			return deleted, translateError(err)
+		}
+		if len(result.Errors) > 0 {
+			first := result.Errors[0]
+			return deleted, fmt.Errorf("erro ao remover %s: %s", aws.StringValue(first.Key), aws.StringValue(first.Message))
+		}
+		deleted += len(objects)
+	}
+	return deleted, nil
+}
+
+// Ping verifica se o bucket está acessível com as credenciais atuais.
+func (s *S3Client) Ping(ctx context.Context) error {
+	_, err := s.S3Service.HeadBucketWithContext(ctx, &s3.HeadBucketInput{
+		Bucket: aws.String(s.BucketName),
+	})
+	return translateError(err)
+}
+
+// ProbePrefix verifica se é possível listar o prefixo, lendo no máximo uma chave.
+func (s *S3Client) ProbePrefix(ctx context.Context, prefix string) error {
+	_, err := s.S3Service.ListObjectsV2WithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket:  aws.String(s.BucketName),
+		Prefix:  aws.String(prefix),
+		MaxKeys: aws.Int64(1),
+	})
+	return translateError(err)
+}
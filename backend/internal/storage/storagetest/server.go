@@ -0,0 +1,326 @@
+// Package storagetest oferece um S3 de mentira, em memória, para os testes
+// dos pacotes que usam storage.S3Client.
+package storagetest
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"streaming-platform/internal/storage"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// Bucket é o nome do bucket servido pelo Server.
+const Bucket = "bucket"
+
+// Server imita o suficiente do S3 para os testes, no estilo de caminho
+// (/bucket/chave): GET e HEAD com Range e as condições de cache, PUT com
+// If-Match e If-None-Match, a cópia (PUT com x-amz-copy-source), DELETE com
+// If-Match, a remoção em lote e a listagem v2.
+// Conflicts faz os próximos PUTs responderem 409, como o S3 faz quando outra
+// escrita condicional na mesma chave está em andamento.
+type Server struct {
+	mu        sync.Mutex
+	objects   map[string]Object
+	seq       int
+	Conflicts int
+}
+
+// Object é um objeto guardado no Server.
+type Object struct {
+	Data         []byte
+	ContentType  string
+	ETag         string
+	LastModified time.Time
+}
+
+func NewServer() *Server {
+	return &Server{objects: map[string]Object{}}
+}
+
+// Client sobe o servidor e retorna um S3Client apontado para ele. O servidor
+// é encerrado no fim do teste.
+func (s *Server) Client(t testing.TB) *storage.S3Client {
+	t.Helper()
+	server := httptest.NewServer(s)
+	t.Cleanup(server.Close)
+	sess, err := session.NewSession(&aws.Config{
+		Region:           aws.String("us-east-1"),
+		Endpoint:         aws.String(server.URL),
+		S3ForcePathStyle: aws.Bool(true),
+		Credentials:      credentials.NewStaticCredentials("teste", "teste", ""),
+		MaxRetries:       aws.Int(0),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := s3.New(sess)
+	return &storage.S3Client{
+		BucketName: Bucket,
+		S3Service:  service,
+		Uploader:   s3manager.NewUploaderWithClient(service),
+		Downloader: s3manager.NewDownloaderWithClient(service),
+	}
+}
+
+// Set grava um objeto diretamente, como outra instância faria, e retorna o
+// ETag.
+func (s *Server) Set(key string, data []byte) string {
+	return s.SetAt(key, data, time.Now())
+}
+
+// SetAt grava um objeto com a data de modificação informada.
+func (s *Server) SetAt(key string, data []byte, modified time.Time) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.put(key, data, storage.ContentType(key), modified)
+}
+
+// Get retorna o objeto guardado em key.
+func (s *Server) Get(key string) (Object, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	object, ok := s.objects[key]
+	return object, ok
+}
+
+// Remove apaga um objeto diretamente.
+func (s *Server) Remove(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.objects, key)
+}
+
+// Keys retorna, em ordem, as chaves sob o prefixo.
+func (s *Server) Keys(prefix string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.keys(prefix)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/"+Bucket), "/")
+	switch {
+	case key == "" && r.Method == http.MethodGet:
+		s.list(w, r)
+	case key == "" && r.Method == http.MethodPost && r.URL.Query().Has("delete"):
+		s.deleteObjects(w, r)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		s.serveObject(w, r, key)
+	case r.Method == http.MethodPut && r.Header.Get("X-Amz-Copy-Source") != "":
+		s.copyObject(w, r, key)
+	case r.Method == http.MethodPut:
+		s.putObject(w, r, key)
+	case r.Method == http.MethodDelete:
+		s.deleteObject(w, r, key)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+// serveObject usa http.ServeContent, que trata Range, If-Range,
+// If-None-Match e If-Modified-Since como o S3.
+func (s *Server) serveObject(w http.ResponseWriter, r *http.Request, key string) {
+	object, ok := s.objects[key]
+	if !ok {
+		writeError(w, http.StatusNotFound, "NoSuchKey")
+		return
+	}
+	if match := r.Header.Get("If-Match"); match != "" && match != object.ETag {
+		writeError(w, http.StatusPreconditionFailed, "PreconditionFailed")
+		return
+	}
+	w.Header().Set("ETag", object.ETag)
+	if object.ContentType != "" {
+		w.Header().Set("Content-Type", object.ContentType)
+	}
+	http.ServeContent(w, r, "", object.LastModified, bytes.NewReader(object.Data))
+}
+
+func (s *Server) putObject(w http.ResponseWriter, r *http.Request, key string) {
+	data, _ := io.ReadAll(r.Body)
+	if s.Conflicts > 0 {
+		s.Conflicts--
+		writeError(w, http.StatusConflict, "ConditionalRequestConflict")
+		return
+	}
+	object, exists := s.objects[key]
+	if r.Header.Get("If-None-Match") == "*" && exists {
+		writeError(w, http.StatusPreconditionFailed, "PreconditionFailed")
+		return
+	}
+	if match := r.Header.Get("If-Match"); match != "" {
+		if !exists {
+			writeError(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		if match != object.ETag {
+			writeError(w, http.StatusPreconditionFailed, "PreconditionFailed")
+			return
+		}
+	}
+	w.Header().Set("ETag", s.put(key, data, r.Header.Get("Content-Type"), time.Now()))
+}
+
+func (s *Server) deleteObject(w http.ResponseWriter, r *http.Request, key string) {
+	if match := r.Header.Get("If-Match"); match != "" {
+		object, exists := s.objects[key]
+		if !exists {
+			writeError(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		if match != object.ETag {
+			writeError(w, http.StatusPreconditionFailed, "PreconditionFailed")
+			return
+		}
+	}
+	delete(s.objects, key)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type copyResult struct {
+	XMLName      xml.Name `xml:"CopyObjectResult"`
+	ETag         string   `xml:"ETag"`
+	LastModified string   `xml:"LastModified"`
+}
+
+func (s *Server) copyObject(w http.ResponseWriter, r *http.Request, key string) {
+	source, err := url.PathUnescape(r.Header.Get("X-Amz-Copy-Source"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "InvalidArgument")
+		return
+	}
+	object, ok := s.objects[strings.TrimPrefix(strings.TrimPrefix(source, "/"), Bucket+"/")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "NoSuchKey")
+		return
+	}
+	etag := s.put(key, object.Data, object.ContentType, time.Now())
+	writeXML(w, copyResult{ETag: etag, LastModified: s.objects[key].LastModified.Format("2006-01-02T15:04:05.000Z")})
+}
+
+type listResult struct {
+	XMLName        xml.Name       `xml:"ListBucketResult"`
+	Name           string         `xml:"Name"`
+	Prefix         string         `xml:"Prefix"`
+	KeyCount       int            `xml:"KeyCount"`
+	IsTruncated    bool           `xml:"IsTruncated"`
+	Contents       []listContent  `xml:"Contents"`
+	CommonPrefixes []commonPrefix `xml:"CommonPrefixes"`
+}
+
+type listContent struct {
+	Key          string `xml:"Key"`
+	Size         int    `xml:"Size"`
+	ETag         string `xml:"ETag"`
+	LastModified string `xml:"LastModified"`
+}
+
+type commonPrefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+// list responde a listagem v2 numa única página.
+func (s *Server) list(w http.ResponseWriter, r *http.Request) {
+	prefix := r.URL.Query().Get("prefix")
+	delimiter := r.URL.Query().Get("delimiter")
+	result := listResult{Name: Bucket, Prefix: prefix}
+	seen := map[string]bool{}
+	for _, key := range s.keys(prefix) {
+		if delimiter != "" {
+			if i := strings.Index(key[len(prefix):], delimiter); i >= 0 {
+				dir := key[:len(prefix)+i+len(delimiter)]
+				if !seen[dir] {
+					seen[dir] = true
+					result.CommonPrefixes = append(result.CommonPrefixes, commonPrefix{Prefix: dir})
+				}
+				continue
+			}
+		}
+		object := s.objects[key]
+		result.Contents = append(result.Contents, listContent{
+			Key:          key,
+			Size:         len(object.Data),
+			ETag:         object.ETag,
+			LastModified: object.LastModified.UTC().Format("2006-01-02T15:04:05.000Z"),
+		})
+	}
+	result.KeyCount = len(result.Contents) + len(result.CommonPrefixes)
+	writeXML(w, result)
+}
+
+type deleteRequest struct {
+	Objects []struct {
+		Key string `xml:"Key"`
+	} `xml:"Object"`
+}
+
+type deleteResult struct {
+	XMLName xml.Name `xml:"DeleteResult"`
+}
+
+func (s *Server) deleteObjects(w http.ResponseWriter, r *http.Request) {
+	var request deleteRequest
+	if err := xml.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "MalformedXML")
+		return
+	}
+	for _, object := range request.Objects {
+		delete(s.objects, object.Key)
+	}
+	writeXML(w, deleteResult{})
+}
+
+// put grava o objeto com um ETag novo; deve ser chamado com mu travado.
+func (s *Server) put(key string, data []byte, contentType string, modified time.Time) string {
+	s.seq++
+	etag := fmt.Sprintf(`"etag-%d"`, s.seq)
+	s.objects[key] = Object{
+		Data:         data,
+		ContentType:  contentType,
+		ETag:         etag,
+		LastModified: modified.UTC().Truncate(time.Second),
+	}
+	return etag
+}
+
+// keys deve ser chamado com mu travado.
+func (s *Server) keys(prefix string) []string {
+	var keys []string
+	for key := range s.objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func writeXML(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, code)
+}
@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"streaming-platform/internal/telemetry"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrument cria um span para cada operação do S3, do início da requisição
+// (antes das novas tentativas) até a conclusão.
+func instrument(service *s3.S3, bucket string) {
+	service.Handlers.Validate.PushFront(func(r *request.Request) {
+		// URLs pré-assinadas não são enviadas, então não geram span
+		if r.ExpireTime > 0 {
+			return
+		}
+		ctx, _ := telemetry.StartSpan(r.Context(), "S3."+r.Operation.Name,
+			attribute.String("rpc.system", "aws-api"),
+			attribute.String("rpc.service", "S3"),
+			attribute.String("rpc.method", r.Operation.Name),
+			attribute.String("aws.s3.bucket", bucket),
+		)
+		r.SetContext(ctx)
+	})
+	service.Handlers.Complete.PushBack(func(r *request.Request) {
+		span := trace.SpanFromContext(r.Context())
+		if !span.IsRecording() {
+			return
+		}
+		if r.HTTPResponse != nil && r.HTTPResponse.StatusCode > 0 {
+			span.SetAttributes(attribute.Int("http.response.status_code", r.HTTPResponse.StatusCode))
+		}
+		span.SetAttributes(attribute.Int("aws.retry_count", r.RetryCount))
+		telemetry.EndSpan(span, r.Error)
+	})
+}
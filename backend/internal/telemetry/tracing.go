@@ -0,0 +1,115 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ServiceName identifica o serviço nos traces e é o nome do tracer.
+const ServiceName = "streaming-platform"
+
+// Exportadores de traces aceitos em OTEL_TRACES_EXPORTER
+const (
+	ExporterNone   = "none"
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+)
+
+// SetupTracing configura o provedor global de traces com o exportador
+// informado. O endpoint OTLP segue as variáveis padrão do OpenTelemetry
+// (OTEL_EXPORTER_OTLP_ENDPOINT etc.). A função retornada descarrega os spans
+// pendentes e deve ser chamada no encerramento.
+func SetupTracing(ctx context.Context, exporterName string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch exporterName {
+	case "", ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterOTLP:
+		exporter, err = otlptracehttp.New(ctx)
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	default:
+		return nil, fmt.Errorf("exportador de traces desconhecido: %s", exporterName)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("erro ao criar exportador %s: %v", exporterName, err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		attribute.String("service.name", ServiceName),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+
+	slog.Info("tracing habilitado", "exporter", exporterName)
+	return provider.Shutdown, nil
+}
+
+// Tracer retorna o tracer do serviço.
+func Tracer() trace.Tracer {
+	return otel.Tracer(ServiceName)
+}
+
+// StartSpan inicia um span filho do contexto informado.
+func StartSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return Tracer().Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// EndSpan registra o erro (se houver) e encerra o span.
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// InjectContext serializa o contexto de trace para ser guardado em um
+// registro (por exemplo, o job criado por um upload).
+func InjectContext(ctx context.Context) map[string]string {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	if len(carrier) == 0 {
+		return nil
+	}
+	return carrier
+}
+
+// LinkFromContext cria um link para o span guardado com InjectContext. O
+// trabalho assíncrono começa um trace próprio, ligado à requisição de origem.
+func LinkFromContext(carrier map[string]string) []trace.Link {
+	if len(carrier) == 0 {
+		return nil
+	}
+	ctx := otel.GetTextMapPropagator().Extract(context.Background(), propagation.MapCarrier(carrier))
+	spanContext := trace.SpanContextFromContext(ctx)
+	if !spanContext.IsValid() {
+		return nil
+	}
+	return []trace.Link{{SpanContext: spanContext}}
+}
@@ -0,0 +1,94 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// ErrForbiddenDestination indica uma URL de webhook que aponta para a rede
+// interna: loopback, redes privadas, link-local (onde ficam os serviços de
+// metadados das nuvens) e afins. Sem essa barreira, quem cria inscrições
+// usaria os workers para alcançar serviços que não estão expostos.
+var ErrForbiddenDestination = errors.New("destino de webhook não permitido")
+
+// forbiddenPrefixes são as faixas reservadas que os métodos de netip.Addr não
+// cobrem.
+var forbiddenPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),      // "esta rede"
+	netip.MustParsePrefix("100.64.0.0/10"),  // CGNAT, inclui metadados de algumas nuvens
+	netip.MustParsePrefix("192.0.0.0/24"),   // atribuições do IETF
+	netip.MustParsePrefix("198.18.0.0/15"),  // testes de desempenho
+	netip.MustParsePrefix("240.0.0.0/4"),    // reservado, inclui broadcast
+	netip.MustParsePrefix("64:ff9b::/96"),   // NAT64, que pode embutir um IPv4 interno
+	netip.MustParsePrefix("64:ff9b:1::/48"), // NAT64 local
+}
+
+// AllowedAddress indica se um webhook pode ser entregue no endereço.
+func AllowedAddress(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsValid() || addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() || addr.IsMulticast() {
+		return false
+	}
+	for _, prefix := range forbiddenPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckURL valida a URL de uma inscrição: http ou https e um host cujos
+// endereços resolvidos sejam todos permitidos. A verificação é repetida a
+// cada conexão (ver newClient), já que o DNS pode mudar depois da inscrição.
+func CheckURL(ctx context.Context, rawURL string) (*url.URL, error) {
+	target, err := url.Parse(rawURL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Hostname() == "" {
+		return nil, errors.New("informe uma URL http ou https")
+	}
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", target.Hostname())
+	if err != nil {
+		return nil, fmt.Errorf("host %s não encontrado", target.Hostname())
+	}
+	for _, addr := range addrs {
+		if !AllowedAddress(addr) {
+			return nil, fmt.Errorf("%w: %s", ErrForbiddenDestination, target.Hostname())
+		}
+	}
+	return target, nil
+}
+
+// newClient cria o cliente HTTP das entregas. O endereço é conferido no
+// momento da conexão, depois da resolução de nomes, o que também barra um
+// DNS que passe a apontar para a rede interna. Sem proxy (ele conectaria no
+// lugar do cliente) e sem seguir redirecionamentos: uma resposta 3xx conta
+// como falha da entrega.
+func newClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil || !AllowedAddress(addrPort.Addr()) {
+				return ErrForbiddenDestination
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
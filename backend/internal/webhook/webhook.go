@@ -0,0 +1,430 @@
+// Package webhook avisa sistemas externos sobre o ciclo de vida dos vídeos.
+// Cada evento vira uma entrega por inscrição interessada, gravada no catálogo
+// antes do envio: o corpo JSON é assinado com o segredo da inscrição e, se o
+// receptor não responder com 2xx, a entrega é repetida com espera
+// exponencial até MaxAttempts tentativas.
+//
+// A entrega é "pelo menos uma vez": com várias réplicas, ou se o processo cair
+// depois do envio e antes de gravar o resultado, o mesmo corpo pode chegar
+// mais de uma vez. O receptor deve descartar repetições pelo cabeçalho
+// X-Webhook-Delivery (ou pelo id do evento, que se mantém nos reenvios).
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"streaming-platform/internal/catalog"
+	"streaming-platform/internal/metrics"
+)
+
+// Eventos do ciclo de vida de um vídeo
+const (
+	EventUploaded = "video.uploaded"
+	EventReady    = "video.ready"
+	EventFailed   = "video.failed"
+	EventDeleted  = "video.deleted"
+)
+
+// Events lista os eventos aceitos nas inscrições.
+var Events = []string{EventUploaded, EventReady, EventFailed, EventDeleted}
+
+// IsEvent indica se o nome é de um evento conhecido.
+func IsEvent(name string) bool {
+	for _, event := range Events {
+		if event == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Cabeçalhos enviados em cada entrega
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// maxBackoff limita a espera entre duas tentativas.
+const maxBackoff = 6 * time.Hour
+
+// expireInterval espaça a limpeza do log de entregas, que lista o histórico
+// inteiro; as novas tentativas são varridas bem mais vezes, pelo índice.
+const expireInterval = time.Hour
+
+// errNotDue indica que a entrega deixou de estar pendente ou vencida entre a
+// listagem e a escrita condicional: outra réplica a assumiu.
+var errNotDue = errors.New("entrega assumida por outra réplica")
+
+// Video descreve o vídeo no corpo dos eventos.
+type Video struct {
+	ID       string `json:"id"`
+	VideoKey string `json:"videoKey,omitempty"`
+	Owner    string `json:"owner,omitempty"`
+	State    string `json:"state,omitempty"`
+	Attempts int    `json:"attempts,omitempty"`
+	Error    string `json:"error,omitempty"`
+	Version  int    `json:"version,omitempty"`
+}
+
+// VideoFromJob monta a descrição do vídeo a partir do job.
+func VideoFromJob(job *catalog.Job) Video {
+	return Video{
+		ID:       job.ID,
+		VideoKey: job.VideoKey,
+		Owner:    job.Owner,
+		State:    job.State,
+		Attempts: job.Attempts,
+		Error:    job.Error,
+	}
+}
+
+// Payload é o corpo JSON de uma entrega.
+type Payload struct {
+	ID        string    `json:"id"`
+	Event     string    `json:"event"`
+	CreatedAt time.Time `json:"createdAt"`
+	Video     Video     `json:"video"`
+}
+
+// Sign retorna o valor do cabeçalho X-Webhook-Signature para o corpo:
+// "t=<unix>,v1=<hex>", com v1 = HMAC-SHA256(secret, "<unix>.<corpo>"). O
+// receptor recalcula o HMAC e rejeita carimbos de tempo muito antigos.
+func Sign(secret string, at time.Time, body []byte) string {
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "t=" + timestamp + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// NewID gera um ID aleatório com o prefixo informado, ordenável pela data de
+// criação.
+func NewID(prefix string) string {
+	random := make([]byte, 4)
+	rand.Read(random)
+	return prefix + time.Now().UTC().Format("20060102T150405.000") + "-" + hex.EncodeToString(random)
+}
+
+// Dispatcher cria e envia as entregas. Um Dispatcher nil não envia nada,
+// para que quem publica eventos não precise testar se há webhooks.
+type Dispatcher struct {
+	Catalog     *catalog.Store
+	Client      *http.Client
+	MaxAttempts int
+	Backoff     time.Duration // espera antes da segunda tentativa; dobra a cada falha
+
+	wg sync.WaitGroup
+}
+
+func NewDispatcher(store *catalog.Store, timeout time.Duration, maxAttempts int, backoff time.Duration) *Dispatcher {
+	return &Dispatcher{
+		Catalog:     store,
+		Client:      newClient(timeout),
+		MaxAttempts: maxAttempts,
+		Backoff:     backoff,
+	}
+}
+
+// Publish registra o evento para cada inscrição interessada e faz a primeira
+// tentativa de entrega, tudo em segundo plano. Erros são só registrados no
+// log: um webhook não pode fazer falhar o upload ou o processamento que o
+// gerou.
+func (d *Dispatcher) Publish(ctx context.Context, event string, video Video) {
+	if d == nil {
+		return
+	}
+	payload := Payload{
+		ID:        NewID("evt_"),
+		Event:     event,
+		CreatedAt: time.Now().UTC(),
+		Video:     video,
+	}
+	ctx = context.WithoutCancel(ctx)
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		d.publish(ctx, payload)
+	}()
+}
+
+// Wait espera as entregas iniciadas por Publish terminarem.
+func (d *Dispatcher) Wait() {
+	if d != nil {
+		d.wg.Wait()
+	}
+}
+
+func (d *Dispatcher) publish(ctx context.Context, payload Payload) {
+	log := slog.With("event", payload.Event, "event_id", payload.ID)
+	subs, err := d.Catalog.ListSubscriptions(ctx)
+	if err != nil {
+		log.ErrorContext(ctx, "erro ao listar inscrições de webhook", "error", err)
+		return
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.ErrorContext(ctx, "erro ao montar evento de webhook", "error", err)
+		return
+	}
+
+	var wg sync.WaitGroup
+	for _, sub := range subs {
+		if !sub.Wants(payload.Event) {
+			continue
+		}
+		delivery, err := d.create(ctx, sub.ID, payload.ID, payload.Event, body, "")
+		if err != nil {
+			log.ErrorContext(ctx, "erro ao registrar entrega de webhook", "subscription_id", sub.ID, "error", err)
+			continue
+		}
+		wg.Add(1)
+		go func(sub *catalog.Subscription) {
+			defer wg.Done()
+			d.attempt(ctx, sub, delivery)
+		}(sub)
+	}
+	wg.Wait()
+}
+
+// Replay cria uma nova entrega com o mesmo corpo (e o mesmo ID de evento) de
+// uma entrega anterior e a envia na hora. A entrega original não muda.
+func (d *Dispatcher) Replay(ctx context.Context, deliveryID string) (*catalog.Delivery, error) {
+	original, err := d.Catalog.GetDelivery(ctx, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	sub, err := d.Catalog.GetSubscription(ctx, original.SubscriptionID)
+	if err != nil {
+		return nil, err
+	}
+
+	delivery, err := d.create(ctx, sub.ID, original.EventID, original.Event, original.Payload, original.ID)
+	if err != nil {
+		return nil, err
+	}
+	d.attempt(ctx, sub, delivery)
+	return delivery, nil
+}
+
+// Run repete as entregas pendentes cujo prazo chegou, a cada interval, e
+// apaga do log as entregas encerradas há mais de retention, a cada hora, até
+// ctx ser cancelado. Várias réplicas podem rodar a varredura: cada tentativa
+// é assumida com uma escrita condicional antes do envio.
+func (d *Dispatcher) Run(ctx context.Context, interval, retention time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var nextExpire time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			d.wg.Wait()
+			return
+		case <-ticker.C:
+		}
+		if err := d.sweep(ctx); err != nil {
+			slog.ErrorContext(ctx, "erro na varredura de webhooks", "error", err)
+		}
+		if retention > 0 && !time.Now().Before(nextExpire) {
+			expired, err := d.Catalog.ExpireDeliveries(ctx, time.Now().Add(-retention))
+			if err != nil {
+				slog.WarnContext(ctx, "erro ao expirar entregas de webhook", "error", err)
+			} else if expired > 0 {
+				slog.InfoContext(ctx, "entregas de webhook expiradas", "count", expired)
+			}
+			nextExpire = time.Now().Add(expireInterval)
+		}
+	}
+}
+
+func (d *Dispatcher) sweep(ctx context.Context) error {
+	deliveries, err := d.Catalog.ListPendingDeliveries(ctx)
+	if err != nil {
+		return err
+	}
+
+	subs := map[string]*catalog.Subscription{}
+	now := time.Now()
+	for _, delivery := range deliveries {
+		if now.Before(delivery.NextAttemptAt) {
+			continue
+		}
+
+		sub, ok := subs[delivery.SubscriptionID]
+		if !ok {
+			sub, err = d.Catalog.GetSubscription(ctx, delivery.SubscriptionID)
+			if errors.Is(err, catalog.ErrNotFound) {
+				sub = nil
+			} else if err != nil {
+				return err
+			}
+			subs[delivery.SubscriptionID] = sub
+		}
+
+		claimed, err := d.claim(ctx, delivery.ID, sub == nil)
+		if errors.Is(err, errNotDue) || errors.Is(err, catalog.ErrNotFound) || errors.Is(err, catalog.ErrConflict) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if sub != nil {
+			d.attempt(ctx, sub, claimed)
+		}
+	}
+	return nil
+}
+
+// claim assume a próxima tentativa da entrega, adiando NextAttemptAt pelo
+// prazo de uma tentativa, só se ela ainda estiver pendente e vencida. Com
+// abandon (inscrição removida, não há mais para onde enviar) a entrega é
+// encerrada como falha.
+func (d *Dispatcher) claim(ctx context.Context, id string, abandon bool) (*catalog.Delivery, error) {
+	now := time.Now().UTC()
+	return d.Catalog.UpdateDelivery(ctx, id, func(delivery *catalog.Delivery) error {
+		if delivery.State != catalog.DeliveryPending || now.Before(delivery.NextAttemptAt) {
+			return errNotDue
+		}
+		if abandon {
+			delivery.State = catalog.DeliveryFailed
+			delivery.NextAttemptAt = time.Time{}
+			return nil
+		}
+		delivery.NextAttemptAt = now.Add(d.attemptWindow())
+		return nil
+	})
+}
+
+// attemptWindow é o prazo de uma tentativa em andamento: até ele vencer, a
+// varredura não assume a entrega.
+func (d *Dispatcher) attemptWindow() time.Duration {
+	return 2 * d.Client.Timeout
+}
+
+func (d *Dispatcher) create(ctx context.Context, subscriptionID, eventID, event string, body []byte, replayOf string) (*catalog.Delivery, error) {
+	now := time.Now().UTC()
+	delivery := &catalog.Delivery{
+		ID:             NewID("dlv_"),
+		SubscriptionID: subscriptionID,
+		EventID:        eventID,
+		Event:          event,
+		Payload:        body,
+		State:          catalog.DeliveryPending,
+		// A primeira tentativa é feita por quem criou a entrega; a varredura
+		// só a assume se ela não for concluída nesse prazo
+		NextAttemptAt: now.Add(d.attemptWindow()),
+		ReplayOf:      replayOf,
+		CreatedAt:     now,
+	}
+	if err := d.Catalog.PutDelivery(ctx, delivery); err != nil {
+		return nil, err
+	}
+	return delivery, nil
+}
+
+// attempt faz uma tentativa de entrega e grava o resultado, agendando a
+// próxima tentativa em caso de falha.
+func (d *Dispatcher) attempt(ctx context.Context, sub *catalog.Subscription, delivery *catalog.Delivery) {
+	ctx = context.WithoutCancel(ctx)
+	start := time.Now()
+	status, err := d.send(ctx, sub, delivery)
+	attempt := catalog.DeliveryAttempt{
+		At:         start.UTC(),
+		StatusCode: status,
+		DurationMs: time.Since(start).Milliseconds(),
+	}
+	// O log de entregas só guarda um motivo genérico: a mensagem completa
+	// (endereços, erros de DNS e de TLS) diria a quem administra inscrições
+	// como é a rede por trás dos workers
+	attempt.Error = failureReason(status, err)
+	delivery.Attempts = append(delivery.Attempts, attempt)
+
+	log := slog.With("delivery_id", delivery.ID, "subscription_id", sub.ID, "event", delivery.Event, "attempt", len(delivery.Attempts))
+	switch {
+	case err == nil:
+		delivery.State = catalog.DeliveryDelivered
+		delivery.NextAttemptAt = time.Time{}
+		metrics.WebhookDeliveries.WithLabelValues(delivery.Event, "delivered").Inc()
+		log.DebugContext(ctx, "webhook entregue", "status", status)
+	case len(delivery.Attempts) >= d.MaxAttempts:
+		delivery.State = catalog.DeliveryFailed
+		delivery.NextAttemptAt = time.Time{}
+		metrics.WebhookDeliveries.WithLabelValues(delivery.Event, "failed").Inc()
+		log.ErrorContext(ctx, "webhook não entregue, tentativas esgotadas", "error", err)
+	default:
+		delivery.NextAttemptAt = time.Now().UTC().Add(d.backoff(len(delivery.Attempts)))
+		metrics.WebhookDeliveries.WithLabelValues(delivery.Event, "retry").Inc()
+		log.WarnContext(ctx, "falha na entrega de webhook, nova tentativa agendada", "error", err, "next_attempt_at", delivery.NextAttemptAt)
+	}
+
+	if err := d.Catalog.PutDelivery(ctx, delivery); err != nil {
+		log.ErrorContext(ctx, "erro ao registrar tentativa de webhook", "error", err)
+	}
+}
+
+// failureReason resume a falha de uma tentativa para o log de entregas.
+func failureReason(status int, err error) string {
+	var netErr net.Error
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, ErrForbiddenDestination):
+		return "destino não permitido"
+	case status != 0:
+		return "resposta fora de 2xx"
+	case errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()):
+		return "tempo esgotado"
+	default:
+		return "falha na conexão"
+	}
+}
+
+// backoff retorna a espera depois da tentativa n: Backoff, 2×Backoff,
+// 4×Backoff... até maxBackoff.
+func (d *Dispatcher) backoff(n int) time.Duration {
+	wait := d.Backoff
+	for i := 1; i < n && wait < maxBackoff; i++ {
+		wait *= 2
+	}
+	return min(wait, maxBackoff)
+}
+
+func (d *Dispatcher) send(ctx context.Context, sub *catalog.Subscription, delivery *catalog.Delivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "streaming-platform-webhooks/1")
+	req.Header.Set(HeaderEvent, delivery.Event)
+	req.Header.Set(HeaderDelivery, delivery.ID)
+	req.Header.Set(HeaderSignature, Sign(sub.Secret, time.Now(), delivery.Payload))
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("receptor respondeu %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,142 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+var epoch = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestSign(t *testing.T) {
+	tests := []struct {
+		name   string
+		secret string
+		at     time.Time
+		body   string
+		want   string
+	}{
+		{"corpo do evento", "whsec_teste", epoch, `{"id":"evt_1"}`, "t=1767225600,v1=d98501c111faf876d5e015d72bb66b0792ac74ae2d37a50cd3b7958a0b251033"},
+		{"outro segredo", "outro", epoch, `{"id":"evt_1"}`, "t=1767225600,v1=4a2c8cae1c230307dea4ef5d7fbc79e44245a79685022d9a54771019af025751"},
+		{"corpo vazio", "whsec_teste", epoch, "", "t=1767225600,v1=2b98476138cca48d34c8ad0a80b0a43e9e5ca50f56ebd776dd79d5fb21404817"},
+		{"fração de segundo ignorada", "whsec_teste", epoch.Add(999 * time.Millisecond), `{"id":"evt_1"}`, "t=1767225600,v1=d98501c111faf876d5e015d72bb66b0792ac74ae2d37a50cd3b7958a0b251033"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Sign(tt.secret, tt.at, []byte(tt.body)); got != tt.want {
+				t.Errorf("Sign() = %s, esperado %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		name    string
+		backoff time.Duration
+		attempt int
+		want    time.Duration
+	}{
+		{"depois da primeira", 30 * time.Second, 1, 30 * time.Second},
+		{"dobra a cada falha", 30 * time.Second, 3, 2 * time.Minute},
+		{"limitado ao máximo", 30 * time.Second, 20, maxBackoff},
+		{"espera inicial acima do máximo", 8 * time.Hour, 1, maxBackoff},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &Dispatcher{Backoff: tt.backoff}
+			if got := d.backoff(tt.attempt); got != tt.want {
+				t.Errorf("backoff(%d) = %s, esperado %s", tt.attempt, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllowedAddress(t *testing.T) {
+	tests := []struct {
+		name string
+		addr string
+		want bool
+	}{
+		{"IPv4 público", "93.184.216.34", true},
+		{"IPv6 público", "2606:2800:220:1:248:1893:25c8:1946", true},
+		{"loopback", "127.0.0.1", false},
+		{"loopback IPv6", "::1", false},
+		{"rede privada", "10.1.2.3", false},
+		{"rede privada 192.168", "192.168.0.10", false},
+		{"metadados da nuvem", "169.254.169.254", false},
+		{"metadados IPv6", "fd00:ec2::254", false},
+		{"CGNAT", "100.100.100.200", false},
+		{"não especificado", "0.0.0.0", false},
+		{"IPv4 mapeado em IPv6", "::ffff:127.0.0.1", false},
+		{"NAT64", "64:ff9b::a00:1", false},
+		{"multicast", "224.0.0.1", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := AllowedAddress(netip.MustParseAddr(tt.addr)); got != tt.want {
+				t.Errorf("AllowedAddress(%s) = %v, esperado %v", tt.addr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckURL(t *testing.T) {
+	tests := []struct {
+		name      string
+		url       string
+		forbidden bool
+	}{
+		{"esquema inválido", "ftp://93.184.216.34/hook", false},
+		{"sem host", "https:///hook", false},
+		{"IP interno", "http://127.0.0.1:8080/hook", true},
+		{"localhost", "http://localhost/hook", true},
+		{"metadados da nuvem", "http://169.254.169.254/latest/meta-data/", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := CheckURL(context.Background(), tt.url)
+			if err == nil {
+				t.Fatalf("CheckURL(%s) aceitou a URL", tt.url)
+			}
+			if got := errors.Is(err, ErrForbiddenDestination); got != tt.forbidden {
+				t.Errorf("CheckURL(%s) = %v; destino proibido = %v, esperado %v", tt.url, err, got, tt.forbidden)
+			}
+		})
+	}
+}
+
+// O cliente das entregas confere o endereço na conexão, não só na inscrição.
+func TestClientRefusesInternalAddress(t *testing.T) {
+	_, err := newClient(time.Second).Get("http://127.0.0.1:1/hook")
+	if !errors.Is(err, ErrForbiddenDestination) {
+		t.Fatalf("Get() = %v, esperado %v", err, ErrForbiddenDestination)
+	}
+	if got := failureReason(0, err); got != "destino não permitido" {
+		t.Errorf("failureReason() = %q", got)
+	}
+}
+
+func TestFailureReason(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		err    error
+		want   string
+	}{
+		{"sucesso", 200, nil, ""},
+		{"resposta de erro", 500, fmt.Errorf("receptor respondeu 500 Internal Server Error"), "resposta fora de 2xx"},
+		{"prazo esgotado", 0, fmt.Errorf("post: %w", context.DeadlineExceeded), "tempo esgotado"},
+		{"detalhes da rede omitidos", 0, errors.New("dial tcp 10.0.0.5:443: connection refused"), "falha na conexão"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := failureReason(tt.status, tt.err); got != tt.want {
+				t.Errorf("failureReason() = %q, esperado %q", got, tt.want)
+			}
+		})
+	}
+}
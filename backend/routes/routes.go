@@ -2,28 +2,101 @@ package routes
 
 import (
 	"net/http"
+	"streaming-platform/internal/auth"
 	"streaming-platform/internal/handlers"
+	"streaming-platform/internal/logging"
+	"streaming-platform/internal/metrics"
+	"streaming-platform/internal/telemetry"
 
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/cors"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gorilla/mux/otelmux"
 )
 
 // SetupRoutes configura todas as rotas da aplicação.
-func SetupRoutes(uploadHandler *handlers.UploadHandler, processHandler *handlers.ProcessHandler) http.Handler {
-	router := mux.NewRouter()
+// Com API_KEYS, as rotas de escrita e de administração exigem uma chave de
+// API com o papel indicado em protect.
+func SetupRoutes(uploadHandler *handlers.UploadHandler, processHandler *handlers.ProcessHandler, playbackHandler *handlers.PlaybackHandler, keyHandler *handlers.KeyHandler, healthHandler *handlers.HealthHandler, versionsHandler *handlers.VersionsHandler, webhooksHandler *handlers.WebhooksHandler, postersHandler *handlers.PostersHandler, authenticator *auth.Authenticator) http.Handler {
+	router := newRouter(healthHandler)
+	protect := func(role auth.Role, handler http.HandlerFunc) http.Handler {
+		return authenticator.Require(role)(handler)
+	}
 
 	// Rota para listar todos os vídeos
-	router.HandleFunc("/videos", handlers.ListVideosHandler(processHandler.S3Client)).Methods("GET")
+	router.HandleFunc("/videos", handlers.ListVideosHandler(playbackHandler.S3Client)).Methods("GET")
 	// Rota para listar resoluções de um vídeo
-	router.HandleFunc("/videos/{videoKey}", handlers.ListVideoResolutionsHandler(processHandler.S3Client)).Methods("GET")
+	router.HandleFunc("/videos/{videoKey}", handlers.ListVideoResolutionsHandler(playbackHandler.S3Client, playbackHandler.Signer, playbackHandler.Catalog)).Methods("GET")
+	// Versões publicadas de um vídeo: listar, reverter e remover
+	router.HandleFunc("/videos/{videoKey}/versions", versionsHandler.HandleList).Methods("GET")
+	router.Handle("/videos/{videoKey}/versions/prune", protect(auth.RoleEditor, versionsHandler.HandlePrune)).Methods("POST")
+	router.Handle("/videos/{videoKey}/versions/{version}/activate", protect(auth.RoleEditor, versionsHandler.HandleActivate)).Methods("POST")
+	router.Handle("/videos/{videoKey}/versions/{version}", protect(auth.RoleEditor, versionsHandler.HandleDelete)).Methods("DELETE")
+	// Capa do vídeo em várias larguras, em WebP ou JPEG
+	router.HandleFunc("/thumbnails/{videoID}", handlers.GetThumbnailHandler(postersHandler.Posters)).Methods("GET", "HEAD")
+	// Candidatos a capa e a escolha do editor
+	router.HandleFunc("/videos/{videoKey}/poster", postersHandler.HandleGet).Methods("GET")
+	router.Handle("/videos/{videoKey}/poster/candidates/{candidate}/select", protect(auth.RoleEditor, postersHandler.HandleSelect)).Methods("POST")
+	// Upload de vídeos: transcodifica na requisição, ou só enfileira em MODE=api
+	router.Handle("/upload", protect(auth.RoleUploader, uploadHandler.HandleUpload)).Methods("POST")
+	// Prioridade de um job na fila de processamento
+	router.Handle("/jobs/{jobID}/priority", protect(auth.RoleAdmin, processHandler.HandlePriority)).Methods("POST")
+	// Dead-letter: jobs que esgotaram as tentativas, para triagem
+	router.Handle("/jobs/dead-letter", protect(auth.RoleAdmin, processHandler.HandleDeadLetters)).Methods("GET")
+	router.Handle("/jobs/{jobID}/retry", protect(auth.RoleAdmin, processHandler.HandleRetry)).Methods("POST")
+	router.Handle("/jobs/{jobID}/dismiss", protect(auth.RoleAdmin, processHandler.HandleDismiss)).Methods("POST")
+	// Inscrições de webhook e log de entregas
+	router.Handle("/webhooks", protect(auth.RoleAdmin, webhooksHandler.HandleCreate)).Methods("POST")
+	router.Handle("/webhooks", protect(auth.RoleAdmin, webhooksHandler.HandleList)).Methods("GET")
+	router.Handle("/webhooks/deliveries/{deliveryID}/replay", protect(auth.RoleAdmin, webhooksHandler.HandleReplay)).Methods("POST")
+	router.Handle("/webhooks/{webhookID}", protect(auth.RoleAdmin, webhooksHandler.HandleGet)).Methods("GET")
+	router.Handle("/webhooks/{webhookID}", protect(auth.RoleAdmin, webhooksHandler.HandleDelete)).Methods("DELETE")
+	router.Handle("/webhooks/{webhookID}/deliveries", protect(auth.RoleAdmin, webhooksHandler.HandleDeliveries)).Methods("GET")
+	// Origem HLS: master, playlists de mídia e segmentos com URLs assinadas
+	router.HandleFunc("/stream/{videoKey}/{path:.+}", playbackHandler.HandleStream).Methods("GET", "HEAD")
+	// Servidor de chaves AES-128 referenciado pelas tags EXT-X-KEY
+	router.HandleFunc("/keys/{videoKey}/{keyID}", keyHandler.HandleKey).Methods("GET")
 
-	// Configurar CORS
+	// Configurar CORS. As rotas de remoção são administrativas e chamadas
+	// com chave de API fora do navegador: DELETE não é liberado para qualquer
+	// origem
 	corsHandler := cors.New(cors.Options{
 		AllowedOrigins:   []string{"*"},
-		AllowedMethods:   []string{"GET"},
-		AllowedHeaders:   []string{"Content-Type"},
+		AllowedMethods:   []string{"GET", "HEAD", "POST"},
+		AllowedHeaders:   []string{"Authorization", "Content-Type", "Range", "If-None-Match", "If-Modified-Since", "If-Range", "Traceparent", "Tracestate", "X-Request-ID"},
+		ExposedHeaders:   []string{"Content-Length", "Content-Range", "Accept-Ranges", "ETag", "Last-Modified", "X-Request-ID"},
 		AllowCredentials: true,
 	}).Handler
 
 	return corsHandler(router) // Retorna como http.Handler
 }
+
+// SetupWorkerRoutes configura as rotas de um processo só de processamento:
+// sondas e métricas, sem a API.
+func SetupWorkerRoutes(healthHandler *handlers.HealthHandler) http.Handler {
+	return newRouter(healthHandler)
+}
+
+// newRouter cria o roteador com os middlewares e as rotas comuns a todos os
+// modos.
+func newRouter(healthHandler *handlers.HealthHandler) *mux.Router {
+	router := mux.NewRouter()
+	router.Use(otelmux.Middleware(telemetry.ServiceName))
+	router.Use(metrics.Middleware)
+	router.Use(logging.Middleware)
+
+	// Sondas de liveness e readiness
+	router.HandleFunc("/healthz", healthHandler.HandleLiveness).Methods("GET")
+	router.HandleFunc("/readyz", healthHandler.HandleReadiness).Methods("GET")
+
+	// Métricas no formato Prometheus
+	router.Handle("/metrics", promhttp.Handler()).Methods("GET")
+
+	// Requisições sem rota não passam pelos middlewares do roteador
+	router.NotFoundHandler = metrics.Middleware(logging.Middleware(http.NotFoundHandler()))
+	router.MethodNotAllowedHandler = metrics.Middleware(logging.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Método não permitido", http.StatusMethodNotAllowed)
+	})))
+
+	return router
+}
@@ -1,20 +1,22 @@
 package utils
 
 import (
-	"log"
+	"log/slog"
 	"os"
+
+	"streaming-platform/internal/logging"
 )
 
 // EnsureDirectoryExists verifica e cria o diretório, se necessário
 func EnsureDirectoryExists(path string) {
-	log.Printf("Verificando/criando diretório: %s", path)
+	slog.Debug("verificando/criando diretório", "path", path)
 	if _, err := os.Stat(path); os.IsNotExist(err) {
 		err := os.MkdirAll(path, 0755)
 		if err != nil {
-			log.Fatalf("Erro ao criar diretório '%s': %v", path, err)
+			logging.Fatal("erro ao criar diretório", "path", path, "error", err)
 		}
-		log.Printf("Diretório criado: %s", path)
+		slog.Info("diretório criado", "path", path)
 	} else {
-		log.Printf("O diretório '%s' já existe", path)
+		slog.Debug("diretório já existe", "path", path)
 	}
 }
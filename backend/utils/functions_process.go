@@ -2,121 +2,664 @@ package utils
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
+	"log/slog"
+	"net/url"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"streaming-platform/internal/catalog"
+	"streaming-platform/internal/lease"
+	"streaming-platform/internal/logging"
+	"streaming-platform/internal/metrics"
+	"streaming-platform/internal/poster"
+	"streaming-platform/internal/publish"
+	"streaming-platform/internal/scheduler"
+	"streaming-platform/internal/scratch"
 	"streaming-platform/internal/services"
 	"streaming-platform/internal/storage"
+	"streaming-platform/internal/telemetry"
+	"streaming-platform/internal/webhook"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
-func ProcessVideos(s3Client *storage.S3Client, qualities []string) error {
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+var (
+	// ErrJobProcessing indica que o job está em processamento e não pode ser
+	// alterado.
+	ErrJobProcessing = errors.New("job em processamento")
+	// ErrNotDeadLetter indica que o job não está na dead-letter.
+	ErrNotDeadLetter = errors.New("job não está na dead-letter")
+	// ErrUnknownProfile indica um perfil de transcodificação inexistente.
+	ErrUnknownProfile = errors.New("perfil de transcodificação desconhecido")
+	// ErrUnreadableSource indica um original que nem o ffprobe consegue ler.
+	ErrUnreadableSource = errors.New("original ilegível pelo ffprobe")
+	// ErrOwnerLimit indica que o dono do job já ocupa todas as vagas de
+	// processamento no cluster.
+	ErrOwnerLimit = errors.New("limite de jobs simultâneos do dono atingido")
+)
+
+// Processor varre o bucket atrás de vídeos novos e os processa conforme o
+// orçamento de CPU da máquina permite.
+type Processor struct {
+	S3Client   *storage.S3Client
+	Catalog    *catalog.Store
+	Qualities  []string
+	Encryptor  *services.Encryptor
+	Publisher  *publish.Publisher
+	Scratch    *scratch.Manager
+	CPU        *scheduler.CPUBudget
+	Queue      *scheduler.Queue
+	Leases     *lease.Manager
+	Webhooks   *webhook.Dispatcher
+	Posters    *poster.Manager
+	Trickplay  services.TrickplayOptions
+	Preview    services.PreviewOptions
+	JobTimeout time.Duration
+	// Falhas seguidas até o job ir para a dead-letter (0 = tenta sempre)
+	MaxAttempts int
+
+	// Jobs em andamento, expostos para as verificações de prontidão
+	busyJobs atomic.Int32
+	// ETag do marcador da fila na última consulta; usado só pelo loop de Run
+	queueVersion string
+}
+
+func NewProcessor(s3Client *storage.S3Client, store *catalog.Store, publisher *publish.Publisher, scratchManager *scratch.Manager, qualities []string, encryptor *services.Encryptor, cpu *scheduler.CPUBudget, queue *scheduler.Queue, leases *lease.Manager, webhooks *webhook.Dispatcher, posters *poster.Manager, trickplay services.TrickplayOptions, preview services.PreviewOptions, jobTimeout time.Duration, maxAttempts int) *Processor {
+	return &Processor{
+		S3Client:    s3Client,
+		Catalog:     store,
+		Qualities:   qualities,
+		Encryptor:   encryptor,
+		Publisher:   publisher,
+		Scratch:     scratchManager,
+		CPU:         cpu,
+		Queue:       queue,
+		Leases:      leases,
+		Webhooks:    webhooks,
+		Posters:     posters,
+		Trickplay:   trickplay,
+		Preview:     preview,
+		JobTimeout:  jobTimeout,
+		MaxAttempts: maxAttempts,
+	}
+}
+
+// PoolStatus retorna quantos jobs estão em andamento, quantos aguardam na
+// fila e as threads de CPU em uso e disponíveis.
+func (p *Processor) PoolStatus() (busy, queued, threadsUsed, threadsTotal int) {
+	used, total, _, _ := p.CPU.Status()
+	return int(p.busyJobs.Load()), p.Queue.Len(), used, total
+}
+
+// jobThreads retorna quantas threads de CPU cada job recebe.
+func (p *Processor) jobThreads() int {
+	return scheduler.JobThreads(p.Qualities, p.CPU.Total)
+}
+
+// queueCheckInterval é o intervalo entre as consultas ao marcador da fila,
+// que trazem envios e novas tentativas sem esperar a sincronização completa.
+const queueCheckInterval = 5 * time.Second
+
+// Run processa a fila de jobs até ctx ser cancelado. A cada interval a fila
+// é sincronizada com o catálogo compartilhado, o que traz os envios novos,
+// as mudanças de prioridade e os jobs de réplicas que caíram; entre uma
+// sincronização e outra, uma mudança no marcador da fila (catalog.TouchQueue)
+// antecipa a próxima. A cada vaga no orçamento de CPU entra o próximo job: o
+// de maior prioridade cujo dono não atingiu o limite.
+func (p *Processor) Run(ctx context.Context, interval time.Duration) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	threads := p.jobThreads()
+	var nextSync, nextCheck time.Time
+	for {
+		release, err := p.CPU.Acquire(ctx, threads)
+		if err != nil {
+			return
+		}
+
+		// A sincronização vem depois da admissão para que a vaga vá para o
+		// job de maior prioridade no momento, inclusive os recém-enviados
+		now := time.Now()
+		due := !now.Before(nextSync)
+		if !due && !now.Before(nextCheck) {
+			due = p.queueChanged(ctx)
+			nextCheck = now.Add(queueCheckInterval)
+		}
+		if due {
+			if err := p.syncQueue(ctx); err != nil {
+				slog.ErrorContext(ctx, "erro ao atualizar a fila de processamento", "error", err)
+			}
+			nextSync = time.Now().Add(interval)
+			nextCheck = time.Now().Add(queueCheckInterval)
+		}
+
+		job, changed := p.Queue.Next()
+		if job == nil {
+			release()
+			// Fila vazia (changed nil) ou só com jobs de donos no limite:
+			// espera a fila mudar ou a próxima consulta ao marcador
+			wake := nextCheck
+			if nextSync.Before(wake) {
+				wake = nextSync
+			}
+			timer := time.NewTimer(time.Until(wake))
+			select {
+			case <-changed:
+			case <-timer.C:
+			case <-ctx.Done():
+			}
+			timer.Stop()
+			if ctx.Err() != nil {
+				return
+			}
+			continue
+		}
+
+		wg.Add(1)
+		go func(job *catalog.Job) {
+			defer wg.Done()
+			defer release()
+			defer p.Queue.Done(job)
+			err := p.runAdmitted(ctx, job, threads)
+			if errors.Is(err, lease.ErrHeld) {
+				// Outra réplica está processando o job
+				slog.DebugContext(ctx, "job ignorado", "job_id", job.ID, "reason", err)
+			}
+			if errors.Is(err, ErrOwnerLimit) {
+				// As vagas do dono estão em outras réplicas: o job volta na
+				// próxima sincronização
+				p.Queue.Hold(job.Owner)
+				slog.DebugContext(ctx, "job adiado", "job_id", job.ID, "owner", job.Owner, "reason", err)
+			}
+		}(job)
+	}
+}
+
+// queueChanged indica se o marcador da fila mudou desde a última consulta.
+// Uma falha na leitura só adia a novidade para a sincronização completa.
+func (p *Processor) queueChanged(ctx context.Context) bool {
+	version, err := p.Catalog.QueueVersion(ctx)
+	if err != nil {
+		slog.WarnContext(ctx, "erro ao consultar o marcador da fila", "error", err)
+		return false
+	}
+	changed := version != p.queueVersion
+	p.queueVersion = version
+	return changed
+}
+
+// syncQueue alinha a fila com os vídeos pendentes no bucket.
+func (p *Processor) syncQueue(ctx context.Context) error {
+	// Lido antes da listagem: um envio durante a sincronização muda o
+	// marcador de novo e dispara outra
+	if version, err := p.Catalog.QueueVersion(ctx); err == nil {
+		p.queueVersion = version
+	}
 
 	// Listar todos os vídeos no bucket na pasta 'videos/'
-	videoKeys, err := s3Client.ListFiles(ctx, "videos/")
+	objects, err := p.S3Client.ListObjects(ctx, "videos/")
 	if err != nil {
 		return fmt.Errorf("erro ao listar vídeos: %v", err)
 	}
 
-	// Canal para distribuir trabalhos
-	videoQueue := make(chan string, len(videoKeys))
+	// Selecionar os vídeos que ainda não foram processados com sucesso
+	items, err := pendingJobs(ctx, p.Catalog, objects)
+	if err != nil {
+		return err
+	}
+	added, removed := p.Queue.Sync(items)
+	if added > 0 || removed > 0 {
+		slog.InfoContext(ctx, "fila de processamento atualizada", "added", added, "removed", removed, "queued", p.Queue.Len())
+	}
+	return nil
+}
+
+// pendingJobs retorna os jobs dos vídeos que ainda precisam ser processados.
+// Vídeos enviados direto ao bucket, sem passar pelo upload da API, ganham um
+// job novo aqui.
+func pendingJobs(ctx context.Context, store *catalog.Store, objects []storage.ObjectInfo) ([]scheduler.Item, error) {
+	var items []scheduler.Item
+	for _, object := range objects {
+		videoKey := object.Key
+		if strings.HasSuffix(videoKey, "/") {
+			continue
+		}
 
-	// Canal para sinalizar erros
-	errorChannel := make(chan error, len(videoKeys))
+		job, err := store.GetJob(ctx, catalog.JobID(videoKey))
+		if errors.Is(err, catalog.ErrNotFound) {
+			job = catalog.NewJob(videoKey)
+			err = store.PutJob(ctx, job)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("erro ao obter job de %s: %v", videoKey, err)
+		}
+
+		if !job.Finished() {
+			items = append(items, scheduler.Item{Job: job, Size: object.Size})
+		}
+	}
+	return items, nil
+}
+
+// SetPriority muda a prioridade de um job no catálogo e, se ele estiver na
+// fila, a posição dele. Jobs em processamento não podem ser alterados.
+func (p *Processor) SetPriority(ctx context.Context, id string, priority int) (*catalog.Job, error) {
+	job, err := p.Catalog.UpdateJob(ctx, id, func(job *catalog.Job) error {
+		if job.State == catalog.JobProcessing {
+			return ErrJobProcessing
+		}
+		job.Priority = priority
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if p.Queue.SetPriority(id, priority) {
+		slog.InfoContext(ctx, "prioridade do job alterada na fila", "job_id", id, "priority", priority)
+	}
+	// As outras réplicas reordenam a fila na próxima consulta ao marcador
+	if err := p.Catalog.TouchQueue(ctx, "priority"); err != nil {
+		slog.WarnContext(ctx, "erro ao avisar os workers", "error", err)
+	}
+	return job, nil
+}
 
-	// Iniciar workers
-	const workerCount = 5 // Número de goroutines
-	for i := 0; i < workerCount; i++ {
-		go videoWorker(ctx, videoQueue, errorChannel, s3Client, qualities)
+// RunJob espera a admissão pelo orçamento de CPU, processa o vídeo do job e
+// registra o resultado no catálogo.
+func (p *Processor) RunJob(ctx context.Context, job *catalog.Job) error {
+	threads := p.jobThreads()
+	release, err := p.CPU.Acquire(ctx, threads)
+	if err != nil {
+		return fmt.Errorf("job %s não admitido: %w", job.ID, err)
 	}
+	defer release()
+	return p.runAdmitted(ctx, job, threads)
+}
 
-	// Enviar vídeos para a fila
-	for _, videoKey := range videoKeys {
-		videoQueue <- videoKey
+// runAdmitted processa um job já admitido, com threads threads de CPU. Com
+// várias réplicas, só processa quem obtiver o lease do job; as demais
+// recebem lease.ErrHeld. Com limite por dono, o job também precisa de uma
+// das vagas do dono (ErrOwnerLimit se todas estão ocupadas).
+func (p *Processor) runAdmitted(ctx context.Context, job *catalog.Job, threads int) error {
+	jobLease, err := p.Leases.Acquire(ctx, job.ID)
+	if err != nil {
+		return err
 	}
-	close(videoQueue)
+	defer jobLease.Release(context.WithoutCancel(ctx))
 
-	// Monitorar erros
-	var hasError bool
-	for i := 0; i < len(videoKeys); i++ {
-		if err := <-errorChannel; err != nil {
-			hasError = true
-			fmt.Printf("Erro no processamento: %v\n", err)
+	// Desde a varredura, outra réplica pode ter concluído o job (ou ele pode
+	// ter ido para a dead-letter)
+	current, err := p.Catalog.GetJob(ctx, job.ID)
+	if err == nil {
+		if current.Finished() && !job.Finished() {
+			slog.DebugContext(ctx, "job já encerrado por outra instância", "job_id", job.ID, "state", current.State)
+			return nil
 		}
+		job = current
+	} else if !errors.Is(err, catalog.ErrNotFound) {
+		return fmt.Errorf("erro ao obter job %s: %v", job.ID, err)
 	}
 
-	if hasError {
-		return fmt.Errorf("houve erros no processamento de alguns vídeos")
+	slot, err := p.acquireOwnerSlot(ctx, job.Owner)
+	if err != nil {
+		return err
+	}
+	if slot != nil {
+		defer slot.Release(context.WithoutCancel(ctx))
+		ctx = slot.Keep(ctx)
 	}
 
-	return nil
+	// Se o lease for perdido, o processamento é interrompido
+	ctx = jobLease.Keep(ctx)
+
+	p.busyJobs.Add(1)
+	metrics.JobsByState.WithLabelValues(metrics.JobProcessing).Inc()
+	defer func() {
+		metrics.JobsByState.WithLabelValues(metrics.JobProcessing).Dec()
+		p.busyJobs.Add(-1)
+	}()
+
+	err = p.processJob(ctx, job, threads)
+	if err != nil {
+		metrics.JobsCompleted.WithLabelValues(metrics.JobFailed).Inc()
+	} else {
+		metrics.JobsCompleted.WithLabelValues(metrics.JobSucceeded).Inc()
+	}
+	return err
 }
 
-// Worker que processa vídeos de forma concorrente
-func videoWorker(
-	ctx context.Context,
-	videoQueue <-chan string,
-	errorChannel chan<- error,
-	s3Client *storage.S3Client,
-	qualities []string,
-) {
-	for videoKey := range videoQueue {
-		select {
-		case <-ctx.Done():
-			// Interromper se o contexto for cancelado
-			errorChannel <- fmt.Errorf("processamento cancelado: %s", ctx.Err())
-			return
-		default:
-			err := processSingleVideo(ctx, videoKey, s3Client, qualities)
-			errorChannel <- err
+// acquireOwnerSlot obtém uma das Queue.OwnerLimit vagas do dono, que são
+// leases no bucket: o limite vale para o cluster, não para cada réplica.
+// Retorna nil sem limite ou para jobs sem dono.
+func (p *Processor) acquireOwnerSlot(ctx context.Context, owner string) (*lease.Lease, error) {
+	if p.Queue.OwnerLimit <= 0 || owner == "" {
+		return nil, nil
+	}
+	for i := 0; i < p.Queue.OwnerLimit; i++ {
+		slot, err := p.Leases.Acquire(ctx, "owners/"+url.PathEscape(owner)+"/"+strconv.Itoa(i))
+		if errors.Is(err, lease.ErrHeld) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("erro ao obter vaga do dono %s: %w", owner, err)
 		}
+		return slot, nil
 	}
+	return nil, fmt.Errorf("%w (%s: %d)", ErrOwnerLimit, owner, p.Queue.OwnerLimit)
 }
 
-// Processar um único vídeo
-func processSingleVideo(ctx context.Context, videoKey string, s3Client *storage.S3Client, qualities []string) error {
-	fmt.Printf("Processando vídeo: %s\n", videoKey)
+// processJob processa o vídeo do job e registra o resultado no catálogo.
+func (p *Processor) processJob(ctx context.Context, job *catalog.Job, threads int) error {
+	ctx = logging.With(ctx, "job_id", job.ID, "video_id", job.ID, "video_key", job.VideoKey)
 
-	// Baixar o vídeo para processamento local
-	videoData, err := s3Client.DownloadFile(ctx, videoKey)
+	// O processamento tem um trace próprio, ligado à requisição que criou o job
+	ctx, span := telemetry.Tracer().Start(ctx, "process.video",
+		trace.WithLinks(telemetry.LinkFromContext(job.TraceContext)...),
+		trace.WithAttributes(
+			attribute.String("video.id", job.ID),
+			attribute.String("video.key", job.VideoKey),
+			attribute.Int("job.threads", threads),
+		),
+	)
+
+	job.State = catalog.JobProcessing
+	job.Error = ""
+	job.FFmpegStderr = ""
+	job.FFmpegStage = ""
+	job.FFmpegExitCode = 0
+	job.Probe = nil
+	if err := p.Catalog.PutJob(ctx, job); err != nil {
+		telemetry.EndSpan(span, err)
+		return fmt.Errorf("erro ao atualizar job %s: %v", job.ID, err)
+	}
+
+	// O disco é reservado antes de o prazo do job começar a contar: sem
+	// espaço livre, o job espera aqui
+	scratchLease, err := p.reserveScratch(ctx, job.VideoKey)
+	if err == nil {
+		// Um ffmpeg travado não pode prender o worker para sempre
+		runCtx, cancel := ctx, context.CancelFunc(func() {})
+		if p.JobTimeout > 0 {
+			runCtx, cancel = context.WithTimeout(ctx, p.JobTimeout)
+		}
+		err = p.processSingleVideo(runCtx, job, scratchLease.Workspace, threads)
+		cancel()
+		scratchLease.Release()
+	}
+	telemetry.EndSpan(span, err)
+
+	job.State = catalog.JobSucceeded
+	if err != nil {
+		job.State = catalog.JobFailed
+		job.Error = err.Error()
+
+		var ffErr *services.FFmpegError
+		if errors.As(err, &ffErr) {
+			job.FFmpegStderr = ffErr.Stderr
+			job.FFmpegStage = ffErr.Stage
+			job.FFmpegExitCode = ffErr.ExitCode
+		}
+
+		// Só falhas do conteúdo contam para a dead-letter: uma queda do S3,
+		// disco cheio ou um deploy no meio do job não condenam o original
+		if contentFailure(ctx, err) {
+			job.Attempts++
+		}
+		slog.ErrorContext(ctx, "erro no processamento do vídeo", "error", err, "attempts", job.Attempts)
+
+		// Um original que sempre falha não pode ocupar um worker para sempre
+		if p.MaxAttempts > 0 && job.Attempts >= p.MaxAttempts {
+			job.State = catalog.JobDeadLetter
+			metrics.JobsDeadLettered.Inc()
+			slog.WarnContext(ctx, "job movido para a dead-letter", "attempts", job.Attempts, "exit_code", job.FFmpegExitCode)
+		}
+	} else {
+		job.Attempts = 0
+		slog.InfoContext(ctx, "vídeo processado")
+	}
+	// Sem o lease, o job pertence a outra instância, que registra o resultado
+	if errors.Is(context.Cause(ctx), lease.ErrLost) {
+		return fmt.Errorf("job %s interrompido: %w", job.ID, lease.ErrLost)
+	}
+	if putErr := p.Catalog.PutJob(ctx, job); putErr != nil && err == nil {
+		err = fmt.Errorf("erro ao atualizar job %s: %v", job.ID, putErr)
+	}
+	p.notify(ctx, job)
+	return err
+}
+
+// contentFailure indica se a falha do job vem do original: o ffmpeg falhou
+// (inclusive travado até o prazo do job) ou o ffprobe não o lê. Com o
+// contexto do job cancelado (lease perdido, processo encerrando), não é.
+func contentFailure(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var ffErr *services.FFmpegError
+	return errors.As(err, &ffErr) || errors.Is(err, ErrUnreadableSource)
+}
+
+// notify publica o resultado do job para os webhooks. video.failed só sai
+// quando o job vai para a dead-letter: as falhas anteriores voltam à fila e
+// ainda podem terminar em video.ready.
+func (p *Processor) notify(ctx context.Context, job *catalog.Job) {
+	video := webhook.VideoFromJob(job)
+	switch job.State {
+	case catalog.JobDeadLetter:
+		p.Webhooks.Publish(ctx, webhook.EventFailed, video)
+		return
+	case catalog.JobSucceeded:
+	default:
+		return
+	}
+	if published, err := p.Catalog.GetVideo(ctx, job.ID); err == nil {
+		video.Version = published.LiveVersion
+	}
+	p.Webhooks.Publish(ctx, webhook.EventReady, video)
+}
+
+// runStage executa uma etapa do processamento dentro de um span próprio.
+func runStage(ctx context.Context, name string, fn func(ctx context.Context) error) error {
+	ctx, span := telemetry.StartSpan(ctx, "process."+name)
+	start := time.Now()
+	err := fn(ctx)
+	telemetry.EndSpan(span, err)
+
+	slog.DebugContext(ctx, "etapa concluída", "stage", name, "duration_ms", time.Since(start).Milliseconds(), "ok", err == nil)
+	return err
+}
+
+// reserveScratch reserva o diretório de trabalho do job, com espaço estimado
+// pelo tamanho do original.
+func (p *Processor) reserveScratch(ctx context.Context, videoKey string) (*scratch.Lease, error) {
+	source, err := p.S3Client.StatObject(ctx, videoKey, storage.ObjectOptions{})
 	if err != nil {
-		return fmt.Errorf("erro ao baixar vídeo %s: %v", videoKey, err)
+		return nil, fmt.Errorf("erro ao consultar vídeo %s: %w", videoKey, err)
 	}
 
-	tempFile := filepath.Join(os.TempDir(), filepath.Base(videoKey))
-	err = os.WriteFile(tempFile, videoData, 0644)
+	var reserved *scratch.Lease
+	err = runStage(ctx, "reserve", func(ctx context.Context) error {
+		estimate := scratch.Estimate(source.ContentLength, len(p.Qualities))
+		reserved, err = p.Scratch.Acquire(ctx, filepath.Base(videoKey), estimate)
+		return err
+	})
 	if err != nil {
-		return fmt.Errorf("erro ao salvar vídeo localmente %s: %v", videoKey, err)
+		return nil, fmt.Errorf("erro ao reservar disco para %s: %w", videoKey, err)
+	}
+	return reserved, nil
+}
+
+// Processar um único vídeo dentro do workspace reservado para ele, com o
+// perfil de transcodificação do job
+func (p *Processor) processSingleVideo(ctx context.Context, job *catalog.Job, workspace *services.Workspace, threads int) error {
+	profile, ok := services.LookupProfile(job.Profile)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownProfile, job.Profile)
 	}
-	defer os.Remove(tempFile)
+	qualities := profile.Qualities(p.Qualities)
+	slog.InfoContext(ctx, "processando vídeo", "profile", profile.Name)
 
+	videoKey := job.VideoKey
 	videoID := filepath.Base(videoKey)
-	err = services.TranscodeVideoToHLS(videoID, tempFile, qualities)
+
+	// Baixar o vídeo direto para um arquivo local, sem passar pela memória
+	sourcePath := workspace.Path("source" + filepath.Ext(videoKey))
+	err := runStage(ctx, "download", func(ctx context.Context) error {
+		_, err := p.S3Client.DownloadToFile(ctx, videoKey, sourcePath)
+		return err
+	})
 	if err != nil {
-		return fmt.Errorf("erro ao transcodificar vídeo %s: %v", videoKey, err)
+		return fmt.Errorf("erro ao baixar vídeo %s: %w", videoKey, err)
 	}
 
-	for _, quality := range qualities {
-		playlistPath := filepath.Join(os.Getenv("STORAGE_PATH"), "hls", videoID, quality, "video.m3u8")
-		err := s3Client.UploadFileFromPath(ctx, fmt.Sprintf("videos-transcoded/%s/%s/video.m3u8", videoID, quality), playlistPath)
+	var manifest *services.Manifest
+	err = runStage(ctx, "transcode", func(ctx context.Context) error {
+		manifest, err = services.TranscodeVideoToHLS(ctx, workspace, videoID, sourcePath, qualities, threads, profile)
+		return err
+	})
+	if err != nil {
+		// O ffprobe do original ajuda a separar arquivos corrompidos de
+		// problemas do servidor
+		var probeErr error
+		job.Probe, probeErr = probeForTriage(ctx, sourcePath)
+		if probeErr != nil {
+			return fmt.Errorf("erro ao transcodificar vídeo %s: %w: %w", videoKey, ErrUnreadableSource, err)
+		}
+		return fmt.Errorf("erro ao transcodificar vídeo %s: %w", videoKey, err)
+	}
+
+	// As prévias de navegação são opcionais: sem elas o vídeo é publicado
+	// do mesmo jeito
+	if p.Trickplay.Enabled() {
+		err = runStage(ctx, "trickplay", func(ctx context.Context) error {
+			return services.AddTrickplay(ctx, manifest, sourcePath, p.Trickplay, threads)
+		})
 		if err != nil {
-			return fmt.Errorf("erro ao fazer upload da qualidade %s para %s: %v", quality, videoKey, err)
+			slog.WarnContext(ctx, "vídeo publicado sem prévias de navegação", "error", err)
 		}
 	}
 
-	thumbnailPath := filepath.Join(os.TempDir(), "thumbnail.jpg")
-	err = services.GenerateThumbnail(tempFile, thumbnailPath)
+	err = runStage(ctx, "encrypt", func(ctx context.Context) error {
+		return p.Encryptor.EncryptRenditions(ctx, manifest, qualities)
+	})
+	if err != nil {
+		return fmt.Errorf("erro ao cifrar vídeo %s: %w", videoKey, err)
+	}
+
+	err = runStage(ctx, "upload", func(ctx context.Context) error {
+		_, err := p.Publisher.Publish(ctx, manifest)
+		return err
+	})
 	if err != nil {
-		return fmt.Errorf("erro ao gerar miniatura para vídeo %s: %v", videoKey, err)
+		return fmt.Errorf("erro ao fazer upload de %s: %w", videoKey, err)
 	}
-	defer os.Remove(thumbnailPath)
 
-	err = s3Client.UploadFileFromPath(ctx, fmt.Sprintf("thumbnails/%s.jpg", videoID), thumbnailPath)
+	err = runStage(ctx, "thumbnail", func(ctx context.Context) error {
+		return p.Posters.Generate(ctx, videoID, sourcePath, workspace.Path("poster"))
+	})
 	if err != nil {
-		return fmt.Errorf("erro ao fazer upload da miniatura do vídeo %s: %v", videoKey, err)
+		return fmt.Errorf("erro ao gerar miniatura para vídeo %s: %w", videoKey, err)
+	}
+
+	// Como as prévias de navegação, a prévia animada é opcional
+	if p.Preview.Enabled() {
+		err = runStage(ctx, "preview", func(ctx context.Context) error {
+			dir := workspace.Path("preview")
+			if err := services.GeneratePreview(ctx, sourcePath, dir, p.Preview, threads); err != nil {
+				return err
+			}
+			return p.Posters.PublishPreview(ctx, videoID, dir)
+		})
+		if err != nil {
+			slog.WarnContext(ctx, "vídeo publicado sem prévia animada", "error", err)
+		}
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+// probeForTriage retorna o ffprobe do original, ou o erro dele em JSON junto
+// com o próprio erro.
+func probeForTriage(ctx context.Context, sourcePath string) (json.RawMessage, error) {
+	// O contexto do job pode ter expirado justamente pelo ffmpeg travado
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
+	defer cancel()
+	probe, err := services.ProbeJSON(ctx, sourcePath)
+	if err != nil {
+		probe, _ = json.Marshal(map[string]string{"error": err.Error()})
+	}
+	return probe, err
+}
+
+// DeadLetters retorna os jobs na dead-letter, os mais recentes primeiro.
+func (p *Processor) DeadLetters(ctx context.Context) ([]*catalog.Job, error) {
+	jobs, err := p.Catalog.ListJobs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	dead := []*catalog.Job{}
+	for _, job := range jobs {
+		if job.State == catalog.JobDeadLetter {
+			dead = append(dead, job)
+		}
+	}
+	sort.Slice(dead, func(i, j int) bool {
+		return dead[i].UpdatedAt.After(dead[j].UpdatedAt)
+	})
+	return dead, nil
+}
+
+// RetryDeadLetter devolve à fila um job da dead-letter (ou descartado), com
+// as tentativas zeradas e o perfil de transcodificação informado (vazio =
+// padrão). Os workers são avisados pelo marcador da fila.
+func (p *Processor) RetryDeadLetter(ctx context.Context, id, profile string) (*catalog.Job, error) {
+	if _, ok := services.LookupProfile(profile); !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownProfile, profile)
+	}
+	// Escrita condicional: dois pedidos simultâneos (ou um descarte no meio)
+	// não podem se sobrescrever
+	job, err := p.Catalog.UpdateJob(ctx, id, func(job *catalog.Job) error {
+		if job.State != catalog.JobDeadLetter && job.State != catalog.JobDismissed {
+			return ErrNotDeadLetter
+		}
+		job.State = catalog.JobPending
+		job.Attempts = 0
+		job.Profile = profile
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := p.Catalog.TouchQueue(ctx, "retry"); err != nil {
+		slog.WarnContext(ctx, "erro ao avisar os workers", "error", err)
+	}
+	slog.InfoContext(ctx, "job da dead-letter devolvido à fila", "job_id", id, "profile", profile)
+	return job, nil
+}
+
+// DismissDeadLetter descarta um job da dead-letter: ele sai da lista e não é
+// mais processado, mas o original e o diagnóstico são mantidos.
+func (p *Processor) DismissDeadLetter(ctx context.Context, id string) (*catalog.Job, error) {
+	job, err := p.Catalog.UpdateJob(ctx, id, func(job *catalog.Job) error {
+		if job.State != catalog.JobDeadLetter {
+			return ErrNotDeadLetter
+		}
+		job.State = catalog.JobDismissed
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	slog.InfoContext(ctx, "job da dead-letter descartado", "job_id", id)
+	return job, nil
+}